@@ -4,29 +4,109 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/pyqan/portFwd/internal/portforward"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Profiles []Profile `yaml:"profiles"`
+	Reconnect ReconnectConfig `yaml:"reconnect,omitempty"`
+	Transport string          `yaml:"transport,omitempty"` // "auto" (default), "websocket" or "spdy"
+	Profiles  []Profile       `yaml:"profiles"`
+}
+
+// ReconnectConfig controls automatic reconnection of dropped port-forwards.
+// Zero values fall back to built-in defaults.
+type ReconnectConfig struct {
+	Disabled     bool          `yaml:"disabled,omitempty"`
+	InitialDelay time.Duration `yaml:"initialDelay,omitempty"` // e.g. "1s"
+	MaxDelay     time.Duration `yaml:"maxDelay,omitempty"`     // backoff cap, e.g. "30s"
+	Multiplier   float64       `yaml:"multiplier,omitempty"`   // growth of the delay per attempt, e.g. 2; 1 keeps it constant
+	Jitter       *float64      `yaml:"jitter,omitempty"`       // randomized fraction of the delay, 0..1; unset = default, 0 = none
+	MaxAttempts  int           `yaml:"maxAttempts,omitempty"`  // 0 = default, negative = unlimited
 }
 
 // Profile represents a saved port-forward profile
 type Profile struct {
 	Name        string        `yaml:"name"`
 	Description string        `yaml:"description,omitempty"`
+	PortRange   string        `yaml:"portRange,omitempty"` // automatic local ports are taken from here, e.g. "20000-20999"
+	Context     string        `yaml:"context,omitempty"`   // kube context of forwards that don't name one
 	Forwards    []ForwardSpec `yaml:"forwards"`
 }
 
 // ForwardSpec represents a single port-forward specification
 type ForwardSpec struct {
-	Namespace  string `yaml:"namespace"`
-	Pod        string `yaml:"pod,omitempty"`
-	Service    string `yaml:"service,omitempty"`
-	LocalPort  int    `yaml:"localPort"`
-	RemotePort int    `yaml:"remotePort"`
+	Context     string        `yaml:"context,omitempty"` // kube context from the kubeconfig; the current one if empty
+	Namespace   string        `yaml:"namespace"`
+	Pod         string        `yaml:"pod,omitempty"`
+	Service     string        `yaml:"service,omitempty"`
+	Resource    string        `yaml:"resource,omitempty"`  // kubectl-style target, e.g. "deploy/api" or "sts/db"
+	LocalPort   int           `yaml:"localPort,omitempty"` // 0 picks a free port
+	RemotePort  int           `yaml:"remotePort,omitempty"`
+	Ports       []string      `yaml:"ports,omitempty"`       // several "local:remote" mappings, e.g. "9090:metrics" or "auto:http"; replaces localPort/remotePort
+	Addresses   []string      `yaml:"addresses,omitempty"`   // local bind addresses, e.g. "::1" or "0.0.0.0"; 127.0.0.1 if empty
+	Socket      string        `yaml:"socket,omitempty"`      // listen on this Unix socket instead of localPort
+	SocketMode  string        `yaml:"socketMode,omitempty"`  // octal socket permissions, e.g. "0660" (default 0600)
+	Balance     string        `yaml:"balance,omitempty"`     // "round-robin" or "least-conn" (services only)
+	Probe       *ProbeConfig  `yaml:"probe,omitempty"`       // optional health check through the local port
+	Lazy        bool          `yaml:"lazy,omitempty"`        // open the tunnel on the first connection only
+	IdleTimeout time.Duration `yaml:"idleTimeout,omitempty"` // close a lazy tunnel after this long without traffic, e.g. "10m" (default 5m)
+	Routes      []string      `yaml:"routes,omitempty"`      // HTTP routes of "resource: router/NAME", e.g. "/api=svc/api:8080" or "admin.localhost=deploy/admin:http"
+	TLS         *TLSConfig    `yaml:"tls,omitempty"`         // optional TLS termination or origination
+	Limits      *LimitsConfig `yaml:"limits,omitempty"`      // optional caps on client connections, rates and data
+}
+
+// ProbeConfig is a health check run periodically through a forward's local
+// port. Zero values fall back to built-in defaults.
+type ProbeConfig struct {
+	Type             string        `yaml:"type"`                       // "tcp", "http" or "grpc"
+	Port             string        `yaml:"port,omitempty"`             // remote port of the mapping to probe; the first one if empty
+	Path             string        `yaml:"path,omitempty"`             // HTTP path, default "/"
+	ExpectStatus     int           `yaml:"expectStatus,omitempty"`     // HTTP status to expect; any 2xx/3xx if 0
+	Service          string        `yaml:"service,omitempty"`          // gRPC health service name; the whole server if empty
+	Interval         time.Duration `yaml:"interval,omitempty"`         // e.g. "10s"
+	Timeout          time.Duration `yaml:"timeout,omitempty"`          // e.g. "2s"
+	FailureThreshold int           `yaml:"failureThreshold,omitempty"` // failures in a row before the forward is degraded, default 3
+	ReconnectAfter   int           `yaml:"reconnectAfter,omitempty"`   // failures in a row that re-dial the tunnel; 0 never
+}
+
+// TLSConfig terminates TLS on a forward's local endpoint or originates it
+// toward the pod port
+type TLSConfig struct {
+	Mode       string   `yaml:"mode"`                 // "terminate" or "originate"
+	Cert       string   `yaml:"cert,omitempty"`       // terminate: server certificate, generated from the local CA if empty; originate: client certificate
+	Key        string   `yaml:"key,omitempty"`        // private key of cert
+	ClientCA   string   `yaml:"clientCA,omitempty"`   // terminate: require client certificates signed by this CA (mTLS)
+	Hosts      []string `yaml:"hosts,omitempty"`      // terminate: extra names of the generated certificate
+	ServerName string   `yaml:"serverName,omitempty"` // originate: SNI and expected name; <service>.<namespace>.svc for services if empty
+	CA         string   `yaml:"ca,omitempty"`         // originate: CA the pod's certificate must chain to; system roots if empty
+	Insecure   bool     `yaml:"insecure,omitempty"`   // originate: don't verify the pod's certificate
+}
+
+// LimitsConfig caps what the clients of a forward may use. Sizes are byte
+// counts such as "512KB" or "1MB"; empty or zero settings are unlimited.
+type LimitsConfig struct {
+	MaxConns int    `yaml:"maxConns,omitempty"` // client connections open at once
+	Upload   string `yaml:"upload,omitempty"`   // bytes per second from all clients to the pod, e.g. "1MB"
+	Download string `yaml:"download,omitempty"` // bytes per second from the pod to all clients
+	Budget   string `yaml:"budget,omitempty"`   // total bytes in both directions, e.g. "5GB"; refuses clients once used up
+}
+
+// Target returns the forward target as a kubectl-style reference ("pod/x", "svc/x", "deploy/x")
+func (f ForwardSpec) Target() string {
+	switch {
+	case f.Resource != "":
+		return f.Resource
+	case f.Service != "":
+		return "svc/" + f.Service
+	default:
+		return "pod/" + f.Pod
+	}
 }
 
 // DefaultConfigPath returns the default configuration file path
@@ -135,6 +215,21 @@ func (c *Config) ListProfiles() []string {
 
 // Validate validates the configuration
 func (c *Config) Validate() error {
+	if c.Reconnect.InitialDelay < 0 || c.Reconnect.MaxDelay < 0 {
+		return fmt.Errorf("reconnect delays cannot be negative")
+	}
+	if c.Reconnect.Multiplier != 0 && c.Reconnect.Multiplier < 1 {
+		return fmt.Errorf("reconnect multiplier must be at least 1")
+	}
+	if j := c.Reconnect.Jitter; j != nil && (*j < 0 || *j > 1) {
+		return fmt.Errorf("reconnect jitter must be between 0 and 1")
+	}
+	switch c.Transport {
+	case "", "auto", "websocket", "spdy":
+	default:
+		return fmt.Errorf("invalid transport %q (use auto, websocket or spdy)", c.Transport)
+	}
+
 	seen := make(map[string]bool)
 	for _, p := range c.Profiles {
 		if p.Name == "" {
@@ -145,20 +240,98 @@ func (c *Config) Validate() error {
 		}
 		seen[p.Name] = true
 
+		if _, err := portforward.ParsePortRange(p.PortRange); err != nil {
+			return fmt.Errorf("%v in profile %s", err, p.Name)
+		}
+
 		for _, f := range p.Forwards {
 			if f.Namespace == "" {
 				return fmt.Errorf("namespace cannot be empty in profile %s", p.Name)
 			}
-			if f.Pod == "" && f.Service == "" {
-				return fmt.Errorf("either pod or service must be specified in profile %s", p.Name)
+			targets := 0
+			for _, t := range []string{f.Pod, f.Service, f.Resource} {
+				if t != "" {
+					targets++
+				}
+			}
+			if targets != 1 {
+				return fmt.Errorf("exactly one of pod, service or resource must be specified in profile %s", p.Name)
+			}
+			if f.Socket != "" && (f.LocalPort != 0 || len(f.Ports) > 0) {
+				return fmt.Errorf("socket replaces localPort and ports in profile %s", p.Name)
 			}
-			if f.LocalPort <= 0 || f.LocalPort > 65535 {
-				return fmt.Errorf("invalid local port %d in profile %s", f.LocalPort, p.Name)
+			if len(f.Ports) > 0 && (f.LocalPort != 0 || f.RemotePort != 0) {
+				return fmt.Errorf("use either ports or localPort/remotePort in profile %s", p.Name)
 			}
-			if f.RemotePort <= 0 || f.RemotePort > 65535 {
-				return fmt.Errorf("invalid remote port %d in profile %s", f.RemotePort, p.Name)
+			if len(f.Ports) == 0 {
+				if f.LocalPort < 0 || f.LocalPort > 65535 {
+					return fmt.Errorf("invalid local port %d in profile %s", f.LocalPort, p.Name)
+				}
+				if !strings.HasPrefix(f.Resource, "router/") && (f.RemotePort <= 0 || f.RemotePort > 65535) {
+					return fmt.Errorf("invalid remote port %d in profile %s", f.RemotePort, p.Name)
+				}
 			}
+			if f.Probe != nil {
+				if err := f.Probe.Validate(); err != nil {
+					return fmt.Errorf("%v in profile %s", err, p.Name)
+				}
+			}
+			opts, err := f.Options()
+			if err == nil {
+				err = opts.Validate()
+			}
+			if err != nil {
+				return fmt.Errorf("%v in profile %s", err, p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the probe settings
+func (p *ProbeConfig) Validate() error {
+	switch p.Type {
+	case "tcp", "http", "grpc":
+	default:
+		return fmt.Errorf("invalid probe type %q (use tcp, http or grpc)", p.Type)
+	}
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("probe path %q must start with /", p.Path)
+	}
+	if p.ExpectStatus != 0 && (p.ExpectStatus < 100 || p.ExpectStatus > 599) {
+		return fmt.Errorf("invalid probe expectStatus %d", p.ExpectStatus)
+	}
+	if p.Interval < 0 || p.Timeout < 0 || p.FailureThreshold < 0 || p.ReconnectAfter < 0 {
+		return fmt.Errorf("probe settings cannot be negative")
+	}
+	return nil
+}
+
+// Validate checks the TLS settings
+func (t *TLSConfig) Validate() error {
+	switch t.Mode {
+	case "terminate":
+		if t.ServerName != "" || t.CA != "" || t.Insecure {
+			return fmt.Errorf("tls serverName, ca and insecure only apply to mode originate")
 		}
+	case "originate":
+		if t.ClientCA != "" || len(t.Hosts) > 0 {
+			return fmt.Errorf("tls clientCA and hosts only apply to mode terminate")
+		}
+	default:
+		return fmt.Errorf("invalid tls mode %q (use terminate or originate)", t.Mode)
+	}
+	if (t.Cert == "") != (t.Key == "") {
+		return fmt.Errorf("tls cert and key must be set together")
 	}
 	return nil
 }
+
+// Validate checks the connection limit and parses the sizes
+func (l *LimitsConfig) Validate() error {
+	if l.MaxConns < 0 {
+		return fmt.Errorf("limits maxConns can't be negative")
+	}
+	_, err := portforward.ParseLimits(l.MaxConns, l.Upload, l.Download, l.Budget)
+	return err
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// Options converts the forward to manager options. Each setting is parsed
+// the way the manager expects it; whether they work together is checked by
+// portforward.ForwardOptions.Validate.
+func (f ForwardSpec) Options() (portforward.ForwardOptions, error) {
+	opts := portforward.ForwardOptions{
+		Context:     f.Context,
+		Namespace:   f.Namespace,
+		SocketPath:  f.Socket,
+		Probe:       f.Probe.Options(),
+		Lazy:        f.Lazy,
+		IdleTimeout: f.IdleTimeout,
+		TLS:         f.TLS.Options(),
+	}
+	var err error
+	if opts.ResourceType, opts.ResourceName, err = portforward.ParseResourceRef(f.Target()); err != nil {
+		return opts, err
+	}
+	if opts.Ports, err = portforward.ParsePortMappings(f.Ports, f.LocalPort, f.RemotePort); err != nil {
+		return opts, err
+	}
+	if opts.Addresses, err = portforward.ParseAddresses(f.Addresses); err != nil {
+		return opts, err
+	}
+	if f.Socket != "" {
+		if opts.SocketMode, err = portforward.ParseSocketMode(f.SocketMode); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Balance, err = portforward.ParseBalanceMode(f.Balance); err != nil {
+		return opts, err
+	}
+	if opts.Routes, err = portforward.ParseRoutes(f.Routes); err != nil {
+		return opts, err
+	}
+	if opts.Limits, err = f.Limits.Options(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// Options converts the probe to manager options, nil without a probe
+func (p *ProbeConfig) Options() *portforward.Probe {
+	if p == nil {
+		return nil
+	}
+	return &portforward.Probe{
+		Type:             portforward.ProbeType(p.Type),
+		Port:             p.Port,
+		Path:             p.Path,
+		ExpectStatus:     p.ExpectStatus,
+		Service:          p.Service,
+		Interval:         p.Interval,
+		Timeout:          p.Timeout,
+		FailureThreshold: p.FailureThreshold,
+		ReconnectAfter:   p.ReconnectAfter,
+	}
+}
+
+// NewProbeConfig converts a connection's probe for saving
+func NewProbeConfig(p *portforward.Probe) *ProbeConfig {
+	if p == nil {
+		return nil
+	}
+	return &ProbeConfig{
+		Type:             string(p.Type),
+		Port:             p.Port,
+		Path:             p.Path,
+		ExpectStatus:     p.ExpectStatus,
+		Service:          p.Service,
+		Interval:         p.Interval,
+		Timeout:          p.Timeout,
+		FailureThreshold: p.FailureThreshold,
+		ReconnectAfter:   p.ReconnectAfter,
+	}
+}
+
+// Options converts the TLS settings to manager options, nil without TLS
+func (t *TLSConfig) Options() *portforward.TLSOptions {
+	if t == nil {
+		return nil
+	}
+	return &portforward.TLSOptions{
+		Mode:       portforward.TLSMode(t.Mode),
+		CertFile:   t.Cert,
+		KeyFile:    t.Key,
+		ClientCA:   t.ClientCA,
+		Hosts:      t.Hosts,
+		ServerName: t.ServerName,
+		RootCA:     t.CA,
+		Insecure:   t.Insecure,
+	}
+}
+
+// NewTLSConfig converts a connection's TLS settings for saving
+func NewTLSConfig(t *portforward.TLSOptions) *TLSConfig {
+	if t == nil {
+		return nil
+	}
+	return &TLSConfig{
+		Mode:       string(t.Mode),
+		Cert:       t.CertFile,
+		Key:        t.KeyFile,
+		ClientCA:   t.ClientCA,
+		Hosts:      t.Hosts,
+		ServerName: t.ServerName,
+		CA:         t.RootCA,
+		Insecure:   t.Insecure,
+	}
+}
+
+// Options parses the limits to manager options, nil without limits
+func (l *LimitsConfig) Options() (*portforward.Limits, error) {
+	if l == nil {
+		return nil, nil
+	}
+	limits, err := portforward.ParseLimits(l.MaxConns, l.Upload, l.Download, l.Budget)
+	if err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// NewLimitsConfig converts a connection's limits for saving
+func NewLimitsConfig(l *portforward.Limits) *LimitsConfig {
+	if l == nil {
+		return nil
+	}
+	c := &LimitsConfig{MaxConns: l.MaxConns}
+	if l.Upload > 0 {
+		c.Upload = portforward.FormatSize(l.Upload)
+	}
+	if l.Download > 0 {
+		c.Download = portforward.FormatSize(l.Download)
+	}
+	if l.Budget > 0 {
+		c.Budget = portforward.FormatSize(l.Budget)
+	}
+	return c
+}
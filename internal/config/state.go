@@ -17,12 +17,25 @@ type SessionState struct {
 
 // SavedConnection represents a saved port-forward connection
 type SavedConnection struct {
-	Namespace    string `yaml:"namespace"`
-	ResourceType string `yaml:"resourceType"` // "pod" or "service"
-	ResourceName string `yaml:"resourceName"`
-	LocalPort    int    `yaml:"localPort"`
-	RemotePort   int    `yaml:"remotePort"`
-	WasActive    bool   `yaml:"wasActive"` // was active when saved
+	Context      string        `yaml:"context,omitempty"` // kube context the connection was created in, also when it was the current one
+	Namespace    string        `yaml:"namespace"`
+	ResourceType string        `yaml:"resourceType"` // "pod", "service", "deployment", ...
+	ResourceName string        `yaml:"resourceName"`
+	LocalPort    int           `yaml:"localPort"`
+	RemotePort   int           `yaml:"remotePort"`
+	Ports        []string      `yaml:"ports,omitempty"`     // all "local:remote" mappings when there's more than one
+	Addresses    []string      `yaml:"addresses,omitempty"` // bind addresses other than the default 127.0.0.1
+	SocketPath   string        `yaml:"socketPath,omitempty"`
+	SocketMode   string        `yaml:"socketMode,omitempty"`
+	Balance      string        `yaml:"balance,omitempty"` // "round-robin" or "least-conn" (services only)
+	Probe        *ProbeConfig  `yaml:"probe,omitempty"`
+	Lazy         bool          `yaml:"lazy,omitempty"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout,omitempty"`
+	Routes       []string      `yaml:"routes,omitempty"` // HTTP routes of a router
+	TLS          *TLSConfig    `yaml:"tls,omitempty"`
+	Faults       string        `yaml:"faults,omitempty"` // fault profile, e.g. "latency=200ms,drop=5%"
+	Limits       *LimitsConfig `yaml:"limits,omitempty"`
+	WasActive    bool          `yaml:"wasActive"` // was active when saved
 }
 
 // DefaultStatePath returns the default state file path
@@ -132,14 +132,7 @@ func GetDaemonPID() (int, error) {
 // Helper methods for common operations
 
 // Add sends an add command
-func (c *Client) Add(namespace, resourceType, resourceName string, localPort, remotePort int) (*Response, error) {
-	payload := AddPayload{
-		Namespace:    namespace,
-		ResourceType: resourceType,
-		ResourceName: resourceName,
-		LocalPort:    localPort,
-		RemotePort:   remotePort,
-	}
+func (c *Client) Add(payload AddPayload) (*Response, error) {
 	req, err := NewRequest(CmdAdd, payload)
 	if err != nil {
 		return nil, err
@@ -193,3 +186,22 @@ func (c *Client) Stop(id string) (*Response, error) {
 	}
 	return c.Send(req)
 }
+
+// Record sends a record command that starts or stops recording a connection
+func (c *Client) Record(payload RecordPayload) (*Response, error) {
+	req, err := NewRequest(CmdRecord, payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.Send(req)
+}
+
+// Faults sends a faults command that replaces a connection's fault profile
+func (c *Client) Faults(id, faults string) (*Response, error) {
+	payload := FaultsPayload{ID: id, Faults: faults}
+	req, err := NewRequest(CmdFaults, payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.Send(req)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,27 +22,39 @@ type Daemon struct {
 	k8sClient *k8s.Client
 	manager   *portforward.Manager
 	server    *Server
+	socks     string             // SOCKS proxy listen address, no proxy if empty
+	proxy     *portforward.Proxy // running SOCKS proxy
 	startTime time.Time
 	ctx       context.Context
 	cancel    context.CancelFunc
 }
 
-// NewDaemon creates a new daemon instance
-func NewDaemon() (*Daemon, error) {
+// NewDaemon creates a new daemon instance. With a socks address it also
+// runs a SOCKS5 proxy into the cluster.
+func NewDaemon(configPath string, kubeOptions k8s.Options, socks string) (*Daemon, error) {
 	// Initialize K8s client
-	k8sClient, err := k8s.NewClient()
+	k8sClient, err := k8s.NewClient(kubeOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
 	// Create port-forward manager
-	manager := portforward.NewManager(k8sClient.GetClientset(), k8sClient.GetRestConfig())
+	manager, err := NewManager(k8sClient, cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	d := &Daemon{
 		k8sClient: k8sClient,
 		manager:   manager,
+		socks:     socks,
 		startTime: time.Now(),
 		ctx:       ctx,
 		cancel:    cancel,
@@ -53,6 +66,32 @@ func NewDaemon() (*Daemon, error) {
 	return d, nil
 }
 
+// NewManager creates a port-forward manager configured from cfg, the way the
+// daemon, the TUI and the foreground commands all run it
+func NewManager(k8sClient *k8s.Client, cfg *config.Config) (*portforward.Manager, error) {
+	transport, err := portforward.ParseTransportMode(cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := portforward.NewManager(k8sClient.GetClientset(), k8sClient.GetRestConfig())
+	manager.SetClientFactory(k8sClient.ContextClients)
+	if current, err := k8sClient.GetCurrentContext(); err == nil {
+		manager.SetDefaultContext(current)
+	}
+	manager.SetReconnectPolicy(portforward.ReconnectPolicy{
+		Disabled:     cfg.Reconnect.Disabled,
+		InitialDelay: cfg.Reconnect.InitialDelay,
+		MaxDelay:     cfg.Reconnect.MaxDelay,
+		Multiplier:   cfg.Reconnect.Multiplier,
+		Jitter:       cfg.Reconnect.Jitter,
+		MaxAttempts:  cfg.Reconnect.MaxAttempts,
+	})
+	manager.SetTransport(transport)
+	manager.SetRecordingsDir(GetRecordingsDir())
+	return manager, nil
+}
+
 // Run starts the daemon
 func (d *Daemon) Run() error {
 	logger.Info("daemon", "Starting daemon...")
@@ -77,6 +116,14 @@ func (d *Daemon) Run() error {
 	}
 	defer d.server.Stop()
 
+	if d.socks != "" {
+		proxy, err := d.manager.StartProxy(portforward.ProxyOptions{Address: d.socks})
+		if err != nil {
+			return fmt.Errorf("failed to start SOCKS proxy: %w", err)
+		}
+		d.proxy = proxy
+	}
+
 	logger.Info("daemon", "Daemon started (PID: %d)", os.Getpid())
 
 	// Handle signals for graceful shutdown
@@ -111,6 +158,10 @@ func (d *Daemon) HandleCommand(req *Request) *Response {
 		return d.handleStatus()
 	case CmdShutdown:
 		return d.handleShutdown()
+	case CmdRecord:
+		return d.handleRecord(req.Payload)
+	case CmdFaults:
+		return d.handleFaults(req.Payload)
 	default:
 		return NewErrorResponse(fmt.Sprintf("unknown command: %s", req.Command))
 	}
@@ -122,28 +173,83 @@ func (d *Daemon) handleAdd(payload json.RawMessage) *Response {
 		return NewErrorResponse(fmt.Sprintf("invalid payload: %v", err))
 	}
 
-	logger.Debug("daemon", "Adding port-forward: %s/%s/%s %d->%d",
-		p.Namespace, p.ResourceType, p.ResourceName, p.LocalPort, p.RemotePort)
+	ports, err := portforward.ParsePortMappings(p.Ports, p.LocalPort, p.RemotePort)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	logger.Debug("daemon", "Adding port-forward: %s/%s/%s %s (context %q)",
+		p.Namespace, p.ResourceType, p.ResourceName, portforward.FormatPortMappings(ports), p.Context)
 
 	// Determine resource type
-	resType := portforward.ResourcePod
-	if p.ResourceType == "service" || p.ResourceType == "svc" {
-		resType = portforward.ResourceService
+	resType, err := portforward.ParseResourceType(p.ResourceType)
+	if err != nil {
+		return NewErrorResponse(err.Error())
 	}
 
-	// Start port-forward
-	ctx, cancel := context.WithTimeout(d.ctx, 30*time.Second)
-	defer cancel()
+	balance, err := portforward.ParseBalanceMode(p.Balance)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	portRange, err := portforward.ParsePortRange(p.PortRange)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	socketMode, err := portforward.ParseSocketMode(p.SocketMode)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	routes, err := portforward.ParseRoutes(p.Routes)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 
-	var conn *portforward.Connection
-	var err error
+	idleTimeout, err := parsePayloadDuration("idle timeout", p.IdleTimeout)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	probe, err := p.Probe.Options()
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
 
-	if resType == portforward.ResourceService {
-		conn, err = d.manager.StartPortForwardToService(ctx, p.Namespace, p.ResourceName, p.LocalPort, p.RemotePort)
-	} else {
-		conn, err = d.manager.StartPortForwardToPod(ctx, p.Namespace, p.ResourceName, p.LocalPort, p.RemotePort)
+	limits, err := p.Limits.Options()
+	if err != nil {
+		return NewErrorResponse(err.Error())
 	}
 
+	faults, err := portforward.ParseFaults(p.Faults)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+
+	// Start port-forward
+	ctx, cancel := context.WithTimeout(d.ctx, 30*time.Second)
+	defer cancel()
+
+	conn, err := d.manager.StartWithOptions(ctx, portforward.ForwardOptions{
+		Context:      p.Context,
+		Namespace:    p.Namespace,
+		ResourceType: resType,
+		ResourceName: p.ResourceName,
+		Ports:        ports,
+		PortRange:    portRange,
+		Addresses:    p.Addresses,
+		SocketPath:   p.SocketPath,
+		SocketMode:   socketMode,
+		Balance:      balance,
+		Probe:        probe,
+		Lazy:         p.Lazy,
+		IdleTimeout:  idleTimeout,
+		Routes:       routes,
+		TLS:          p.TLS.Options(),
+		Faults:       &faults,
+		Limits:       limits,
+	})
 	if err != nil {
 		logger.Error("daemon", "Failed to start port-forward: %v", err)
 		return NewErrorResponse(fmt.Sprintf("failed to start port-forward: %v", err))
@@ -153,8 +259,15 @@ func (d *Daemon) handleAdd(payload json.RawMessage) *Response {
 	d.saveState()
 
 	info := ConnectionToInfo(conn)
-	return NewSuccessResponse(fmt.Sprintf("Port-forward started: localhost:%d -> %s:%d",
-		p.LocalPort, p.ResourceName, p.RemotePort), info)
+	message := fmt.Sprintf("Port-forward started: %s %s",
+		p.ResourceName, portforward.FormatPortMappings(conn.Options().Ports))
+	if info.SocketPath != "" {
+		message = fmt.Sprintf("Port-forward started: %s on %s", p.ResourceName, info.SocketPath)
+	}
+	if exposed := portforward.ExposedAddresses(info.Addresses); len(exposed) > 0 {
+		message += fmt.Sprintf("\n⚠ Listening on %s: the forward is reachable from other hosts", strings.Join(exposed, ", "))
+	}
+	return NewSuccessResponse(message, info)
 }
 
 func (d *Daemon) handleRemove(payload json.RawMessage) *Response {
@@ -189,6 +302,54 @@ func (d *Daemon) handleStop(payload json.RawMessage) *Response {
 	return NewSuccessResponse(fmt.Sprintf("Connection stopped: %s", p.ID), nil)
 }
 
+func (d *Daemon) handleRecord(payload json.RawMessage) *Response {
+	var p RecordPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	if p.Stop {
+		logger.Debug("daemon", "Stopping recording of: %s", p.ID)
+		if err := d.manager.StopRecording(p.ID); err != nil {
+			return NewErrorResponse(fmt.Sprintf("failed to stop recording: %v", err))
+		}
+		return NewSuccessResponse(fmt.Sprintf("Recording stopped: %s", p.ID), nil)
+	}
+
+	logger.Debug("daemon", "Recording connection: %s", p.ID)
+	dir, err := d.manager.StartRecording(p.ID, portforward.RecordOptions{
+		Format:       portforward.RecordFormat(p.Format),
+		MaxFileSize:  p.MaxFileSize,
+		MaxTotalSize: p.MaxTotalSize,
+	})
+	if err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to start recording: %v", err))
+	}
+	return NewSuccessResponse(fmt.Sprintf("Recording %s to %s", p.ID, dir), nil)
+}
+
+func (d *Daemon) handleFaults(payload json.RawMessage) *Response {
+	var p FaultsPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return NewErrorResponse(fmt.Sprintf("invalid payload: %v", err))
+	}
+
+	faults, err := portforward.ParseFaults(p.Faults)
+	if err != nil {
+		return NewErrorResponse(err.Error())
+	}
+	logger.Debug("daemon", "Setting faults of %s: %s", p.ID, faults)
+	if err := d.manager.SetFaults(p.ID, faults); err != nil {
+		return NewErrorResponse(fmt.Sprintf("failed to set faults: %v", err))
+	}
+	d.saveState()
+
+	if faults.IsZero() {
+		return NewSuccessResponse(fmt.Sprintf("Fault injection off: %s", p.ID), nil)
+	}
+	return NewSuccessResponse(fmt.Sprintf("Injecting faults into %s: %s", p.ID, faults), nil)
+}
+
 func (d *Daemon) handleList() *Response {
 	connections := d.manager.GetConnections()
 	infos := make([]ConnectionInfo, 0, len(connections))
@@ -212,13 +373,22 @@ func (d *Daemon) handleStatus() *Response {
 		Uptime:      formatDuration(time.Since(d.startTime)),
 		Connections: infos,
 	}
+	if d.proxy != nil {
+		stats := d.proxy.Stats()
+		status.Proxy = &ProxyInfo{
+			Address:  d.proxy.Addr(),
+			Requests: stats.Requests,
+			Active:   stats.Active,
+			Errors:   stats.Errors,
+		}
+	}
 
 	return NewSuccessResponse("Daemon is running", status)
 }
 
 func (d *Daemon) handleShutdown() *Response {
 	logger.Info("daemon", "Shutdown command received")
-	
+
 	// Trigger shutdown in background
 	go func() {
 		time.Sleep(100 * time.Millisecond)
@@ -234,6 +404,10 @@ func (d *Daemon) shutdown() {
 	// Save state before stopping
 	d.saveState()
 
+	if d.proxy != nil {
+		d.proxy.Close()
+	}
+
 	// Stop all connections
 	d.manager.StopAll()
 
@@ -242,7 +416,7 @@ func (d *Daemon) shutdown() {
 
 func (d *Daemon) writePIDFile() error {
 	pidPath := GetPIDPath()
-	
+
 	// Ensure directory exists
 	if err := os.MkdirAll(GetConfigDir(), 0755); err != nil {
 		return err
@@ -266,14 +440,7 @@ func (d *Daemon) saveState() {
 	state.Connections = nil
 
 	for _, conn := range d.manager.GetAllConnectionsForSave() {
-		state.Connections = append(state.Connections, config.SavedConnection{
-			Namespace:    conn.Namespace,
-			ResourceType: conn.ResourceType,
-			ResourceName: conn.ResourceName,
-			LocalPort:    conn.LocalPort,
-			RemotePort:   conn.RemotePort,
-			WasActive:    conn.WasActive,
-		})
+		state.Connections = append(state.Connections, SavedConnection(conn))
 	}
 
 	if err := state.Save(); err != nil {
@@ -298,38 +465,34 @@ func (d *Daemon) restoreConnections() error {
 	failed := 0
 
 	for _, saved := range state.Connections {
-		resType := portforward.ResourcePod
-		if saved.ResourceType == "service" {
-			resType = portforward.ResourceService
+		opts, err := SavedOptions(saved)
+		if err != nil {
+			logger.Warn("daemon", "Skipping saved connection %s/%s: %v", saved.Namespace, saved.ResourceName, err)
+			continue
 		}
 
 		if !saved.WasActive {
 			// Add as stopped connection (for tracking)
-			d.manager.AddStoppedConnection(saved.Namespace, resType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+			d.manager.AddStoppedConnection(opts)
 			logger.Debug("daemon", "Added stopped connection: %s/%s/%s",
 				saved.Namespace, saved.ResourceType, saved.ResourceName)
 			continue
 		}
 
 		// Try to start active connections
-		logger.Debug("daemon", "Restoring: %s/%s/%s %d->%d",
-			saved.Namespace, saved.ResourceType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+		logger.Debug("daemon", "Restoring: %s/%s/%s %s",
+			saved.Namespace, saved.ResourceType, saved.ResourceName, portforward.FormatPortMappings(opts.Ports))
 
 		ctx, cancel := context.WithTimeout(d.ctx, 30*time.Second)
 
-		var err error
-		if resType == portforward.ResourceService {
-			_, err = d.manager.StartPortForwardToService(ctx, saved.Namespace, saved.ResourceName, saved.LocalPort, saved.RemotePort)
-		} else {
-			_, err = d.manager.StartPortForwardToPod(ctx, saved.Namespace, saved.ResourceName, saved.LocalPort, saved.RemotePort)
-		}
+		_, err = d.manager.StartWithOptions(ctx, opts)
 		cancel()
 
 		if err != nil {
 			logger.Warn("daemon", "Failed to restore connection %s/%s/%s: %v",
 				saved.Namespace, saved.ResourceType, saved.ResourceName, err)
 			// Add as stopped connection so user can see it and retry
-			d.manager.AddStoppedConnection(saved.Namespace, resType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+			d.manager.AddStoppedConnection(opts)
 			failed++
 		} else {
 			restored++
@@ -341,7 +504,7 @@ func (d *Daemon) restoreConnections() error {
 }
 
 // StartDaemon starts the daemon process
-func StartDaemon(foreground bool) error {
+func StartDaemon(foreground bool, configPath string, kubeOptions k8s.Options, socks string) error {
 	// Check if already running
 	if IsDaemonRunning() {
 		return fmt.Errorf("daemon is already running")
@@ -349,22 +512,22 @@ func StartDaemon(foreground bool) error {
 
 	if foreground {
 		// Run in foreground (useful for debugging)
-		return runDaemonProcess()
+		return runDaemonProcess(configPath, kubeOptions, socks)
 	}
 
 	// Fork and run in background
-	return forkDaemon()
+	return forkDaemon(configPath, kubeOptions, socks)
 }
 
-func runDaemonProcess() error {
-	daemon, err := NewDaemon()
+func runDaemonProcess(configPath string, kubeOptions k8s.Options, socks string) error {
+	daemon, err := NewDaemon(configPath, kubeOptions, socks)
 	if err != nil {
 		return err
 	}
 	return daemon.Run()
 }
 
-func forkDaemon() error {
+func forkDaemon(configPath string, kubeOptions k8s.Options, socks string) error {
 	// Get current executable
 	executable, err := os.Executable()
 	if err != nil {
@@ -384,11 +547,19 @@ func forkDaemon() error {
 	defer logFile.Close()
 
 	// Use exec.Command for better process management
-	cmd := exec.Command(executable, "daemon", "start", "--foreground")
+	args := []string{"daemon", "start", "--foreground"}
+	if configPath != "" {
+		args = append(args, "--config", configPath)
+	}
+	if socks != "" {
+		args = append(args, "--socks", socks)
+	}
+	args = append(args, kubeOptions.Args()...)
+	cmd := exec.Command(executable, args...)
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 	cmd.Stdin = nil
-	
+
 	// Set process group to detach from controlling terminal
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
@@ -401,10 +572,10 @@ func forkDaemon() error {
 	pid := cmd.Process.Pid
 	fmt.Printf("Daemon started (PID: %d)\n", pid)
 	fmt.Printf("Log file: %s\n", GetLogPath())
-	
+
 	// Wait a bit to check if daemon started successfully
 	time.Sleep(1 * time.Second)
-	
+
 	// Check if process is still running
 	if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
 		return fmt.Errorf("daemon failed to start (check log: %s)", GetLogPath())
@@ -426,12 +597,12 @@ func StopDaemon() error {
 		if err != nil {
 			return fmt.Errorf("cannot determine daemon PID: %w", err)
 		}
-		
+
 		process, err := os.FindProcess(pid)
 		if err != nil {
 			return fmt.Errorf("cannot find process: %w", err)
 		}
-		
+
 		return process.Signal(syscall.SIGTERM)
 	}
 	defer client.Close()
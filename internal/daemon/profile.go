@@ -0,0 +1,37 @@
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/pyqan/portFwd/internal/config"
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// NamespaceProfile builds a profile of the forwards of a namespace plan that
+// started, errs being what StartPlan returned for it. Every forward gets the
+// settings of base plus its service, its ports and, with loopback aliases,
+// its own address. kubeContext is the context the services were found in.
+func NamespaceProfile(name string, plan *portforward.NamespacePlan, errs []error, selector, kubeContext string, base config.ForwardSpec) config.Profile {
+	profile := config.Profile{
+		Name:        name,
+		Description: fmt.Sprintf("All services in %s", plan.Namespace),
+		Context:     kubeContext,
+	}
+	if selector != "" {
+		profile.Description += " matching " + selector
+	}
+	for i, sp := range plan.Services {
+		if errs[i] != nil {
+			continue
+		}
+		fwd := base
+		fwd.Namespace = plan.Namespace
+		fwd.Service = sp.Service
+		fwd.Ports = portforward.PortMappingStrings(sp.Options.Ports)
+		if sp.Address != "" {
+			fwd.Addresses = []string{sp.Address}
+		}
+		profile.Forwards = append(profile.Forwards, fwd)
+	}
+	return profile
+}
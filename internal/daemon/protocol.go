@@ -23,6 +23,11 @@ func GetLogPath() string {
 	return filepath.Join(GetConfigDir(), "daemon.log")
 }
 
+// GetRecordingsDir returns where traffic recordings are written, next to the log
+func GetRecordingsDir() string {
+	return filepath.Join(GetConfigDir(), "recordings")
+}
+
 func GetConfigDir() string {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
@@ -41,6 +46,8 @@ const (
 	CmdStop     CommandType = "stop"
 	CmdStatus   CommandType = "status"
 	CmdShutdown CommandType = "shutdown"
+	CmdRecord   CommandType = "record"
+	CmdFaults   CommandType = "faults"
 )
 
 // Request represents a command from CLI to daemon
@@ -51,11 +58,59 @@ type Request struct {
 
 // AddPayload for add command
 type AddPayload struct {
-	Namespace    string `json:"namespace"`
-	ResourceType string `json:"resource_type"` // "pod" or "service"
-	ResourceName string `json:"resource_name"`
-	LocalPort    int    `json:"local_port"`
-	RemotePort   int    `json:"remote_port"`
+	Context      string   `json:"context,omitempty"` // kube context; the daemon's current one if empty
+	Namespace    string   `json:"namespace"`
+	ResourceType string   `json:"resource_type"` // "pod", "service", "deployment", "statefulset", ...
+	ResourceName string   `json:"resource_name"`
+	LocalPort    int      `json:"local_port"`
+	RemotePort   int      `json:"remote_port"`
+	Ports        []string `json:"ports,omitempty"`        // "local:remote" mappings; replaces local/remote port
+	PortRange    string   `json:"port_range,omitempty"`   // where automatic (0) local ports are picked from, e.g. "20000-20999"
+	Addresses    []string `json:"addresses,omitempty"`    // local bind addresses; 127.0.0.1 if empty
+	SocketPath   string   `json:"socket_path,omitempty"`  // listen on a Unix socket instead; one remote port only
+	SocketMode   string   `json:"socket_mode,omitempty"`  // octal socket permissions, e.g. "0660"
+	Balance      string   `json:"balance,omitempty"`      // "round-robin" or "least-conn" (services only)
+	Lazy         bool     `json:"lazy,omitempty"`         // open the tunnel on the first connection only
+	IdleTimeout  string   `json:"idle_timeout,omitempty"` // close a lazy tunnel after this long without traffic, e.g. "10m"
+	Routes       []string `json:"routes,omitempty"`       // HTTP routes of a router, e.g. "/api=svc/api:8080"
+	Faults       string   `json:"faults,omitempty"`       // fault profile, e.g. "latency=200ms,drop=5%"
+
+	Probe  *ProbePayload  `json:"probe,omitempty"`  // optional health check
+	TLS    *TLSPayload    `json:"tls,omitempty"`    // optional TLS termination or origination
+	Limits *LimitsPayload `json:"limits,omitempty"` // optional caps on client connections, rates and data
+}
+
+// ProbePayload is the health check of an add command
+type ProbePayload struct {
+	Type             string `json:"type"`                        // "tcp", "http" or "grpc"
+	Port             string `json:"port,omitempty"`              // remote port of the mapping to probe
+	Path             string `json:"path,omitempty"`              // HTTP path
+	ExpectStatus     int    `json:"expect_status,omitempty"`     // HTTP status to expect
+	Service          string `json:"service,omitempty"`           // gRPC health service name
+	Interval         string `json:"interval,omitempty"`          // e.g. "10s"
+	Timeout          string `json:"timeout,omitempty"`           // e.g. "2s"
+	FailureThreshold int    `json:"failure_threshold,omitempty"` // failures in a row before the forward is degraded
+	ReconnectAfter   int    `json:"reconnect_after,omitempty"`   // failures in a row that re-dial the tunnel
+}
+
+// TLSPayload is the TLS termination or origination of an add command
+type TLSPayload struct {
+	Mode       string   `json:"mode"` // "terminate" or "originate"
+	Cert       string   `json:"cert,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	ClientCA   string   `json:"client_ca,omitempty"`
+	Hosts      []string `json:"hosts,omitempty"`
+	ServerName string   `json:"server_name,omitempty"`
+	CA         string   `json:"ca,omitempty"`
+	Insecure   bool     `json:"insecure,omitempty"`
+}
+
+// LimitsPayload caps the clients of a forward started by an add command
+type LimitsPayload struct {
+	MaxConns int    `json:"max_conns,omitempty"`
+	Upload   string `json:"upload,omitempty"`   // bytes per second, e.g. "1MB"
+	Download string `json:"download,omitempty"` // bytes per second
+	Budget   string `json:"budget,omitempty"`   // total bytes, e.g. "5GB"
 }
 
 // RemovePayload for remove command
@@ -63,6 +118,147 @@ type RemovePayload struct {
 	ID string `json:"id"`
 }
 
+// RecordPayload for record command
+type RecordPayload struct {
+	ID           string `json:"id"`
+	Stop         bool   `json:"stop,omitempty"`           // stop recording instead of starting
+	Format       string `json:"format,omitempty"`         // "auto" (HAR for HTTP/1.x) or "raw"
+	MaxFileSize  int64  `json:"max_file_size,omitempty"`  // bytes; the default if 0
+	MaxTotalSize int64  `json:"max_total_size,omitempty"` // bytes; the default if 0
+}
+
+// FaultsPayload for faults command
+type FaultsPayload struct {
+	ID     string `json:"id"`
+	Faults string `json:"faults,omitempty"` // fault profile, e.g. "latency=200ms,drop=5%"; empty removes it
+}
+
+// NewProbePayload converts a probe for the add command
+func NewProbePayload(p *portforward.Probe) *ProbePayload {
+	if p == nil {
+		return nil
+	}
+	return &ProbePayload{
+		Type:             string(p.Type),
+		Port:             p.Port,
+		Path:             p.Path,
+		ExpectStatus:     p.ExpectStatus,
+		Service:          p.Service,
+		Interval:         payloadDuration(p.Interval),
+		Timeout:          payloadDuration(p.Timeout),
+		FailureThreshold: p.FailureThreshold,
+		ReconnectAfter:   p.ReconnectAfter,
+	}
+}
+
+// Options parses the probe to manager options, nil without a probe
+func (p *ProbePayload) Options() (*portforward.Probe, error) {
+	if p == nil {
+		return nil, nil
+	}
+	probe := &portforward.Probe{
+		Type:             portforward.ProbeType(p.Type),
+		Port:             p.Port,
+		Path:             p.Path,
+		ExpectStatus:     p.ExpectStatus,
+		Service:          p.Service,
+		FailureThreshold: p.FailureThreshold,
+		ReconnectAfter:   p.ReconnectAfter,
+	}
+	var err error
+	if probe.Interval, err = parsePayloadDuration("probe interval", p.Interval); err != nil {
+		return nil, err
+	}
+	if probe.Timeout, err = parsePayloadDuration("probe timeout", p.Timeout); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+// NewTLSPayload converts TLS settings for the add command
+func NewTLSPayload(t *portforward.TLSOptions) *TLSPayload {
+	if t == nil {
+		return nil
+	}
+	return &TLSPayload{
+		Mode:       string(t.Mode),
+		Cert:       t.CertFile,
+		Key:        t.KeyFile,
+		ClientCA:   t.ClientCA,
+		Hosts:      t.Hosts,
+		ServerName: t.ServerName,
+		CA:         t.RootCA,
+		Insecure:   t.Insecure,
+	}
+}
+
+// Options converts the TLS settings to manager options, nil without TLS
+func (t *TLSPayload) Options() *portforward.TLSOptions {
+	if t == nil {
+		return nil
+	}
+	return &portforward.TLSOptions{
+		Mode:       portforward.TLSMode(t.Mode),
+		CertFile:   t.Cert,
+		KeyFile:    t.Key,
+		ClientCA:   t.ClientCA,
+		Hosts:      t.Hosts,
+		ServerName: t.ServerName,
+		RootCA:     t.CA,
+		Insecure:   t.Insecure,
+	}
+}
+
+// NewLimitsPayload converts limits for the add command
+func NewLimitsPayload(l *portforward.Limits) *LimitsPayload {
+	if l == nil {
+		return nil
+	}
+	p := &LimitsPayload{MaxConns: l.MaxConns}
+	if l.Upload > 0 {
+		p.Upload = portforward.FormatSize(l.Upload)
+	}
+	if l.Download > 0 {
+		p.Download = portforward.FormatSize(l.Download)
+	}
+	if l.Budget > 0 {
+		p.Budget = portforward.FormatSize(l.Budget)
+	}
+	return p
+}
+
+// Options parses the limits to manager options, nil without limits
+func (l *LimitsPayload) Options() (*portforward.Limits, error) {
+	if l == nil {
+		return nil, nil
+	}
+	limits, err := portforward.ParseLimits(l.MaxConns, l.Upload, l.Download, l.Budget)
+	if err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// payloadDuration formats a duration for a payload, empty for the default
+func payloadDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// parsePayloadDuration parses a duration of a payload, 0 if empty
+func parsePayloadDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return d, nil
+}
+
 // Response from daemon to CLI
 type Response struct {
 	Success bool            `json:"success"`
@@ -73,15 +269,40 @@ type Response struct {
 
 // ConnectionInfo for list response
 type ConnectionInfo struct {
-	ID           string `json:"id"`
-	Namespace    string `json:"namespace"`
-	ResourceType string `json:"resource_type"`
-	ResourceName string `json:"resource_name"`
-	LocalPort    int    `json:"local_port"`
-	RemotePort   int    `json:"remote_port"`
-	Status       string `json:"status"`
-	Error        string `json:"error,omitempty"`
-	Duration     string `json:"duration"`
+	ID           string   `json:"id"`
+	Context      string   `json:"context,omitempty"`
+	Namespace    string   `json:"namespace"`
+	ResourceType string   `json:"resource_type"`
+	ResourceName string   `json:"resource_name"`
+	PodName      string   `json:"pod_name,omitempty"`
+	Balance      string   `json:"balance,omitempty"`
+	Backends     []string `json:"backends,omitempty"`
+	LocalPort    int      `json:"local_port"`
+	RemotePort   int      `json:"remote_port"`
+	Ports        []string `json:"ports,omitempty"`
+	Addresses    []string `json:"addresses,omitempty"`
+	SocketPath   string   `json:"socket_path,omitempty"`
+	Status       string   `json:"status"`
+	Error        string   `json:"error,omitempty"`
+	Duration     string   `json:"duration"`
+	Reconnects   int      `json:"reconnects,omitempty"`
+	Probe        string   `json:"probe,omitempty"`       // probe description
+	ProbeError   string   `json:"probe_error,omitempty"` // last failed probe while it keeps failing
+	Lazy         bool     `json:"lazy,omitempty"`
+	IdleTimeout  string   `json:"idle_timeout,omitempty"` // set for lazy forwards
+	Routes       []string `json:"routes,omitempty"`       // set for routers
+	TLS          string   `json:"tls,omitempty"`          // TLS description
+	Recording    string   `json:"recording,omitempty"`    // recording description, empty when off
+	Faults       string   `json:"faults,omitempty"`       // injected fault profile, empty when off
+	Limits       string   `json:"limits,omitempty"`       // limits description, empty without limits
+
+	// Traffic metrics
+	BytesSent     int64  `json:"bytes_sent"`              // local clients -> pod
+	BytesReceived int64  `json:"bytes_received"`          // pod -> local clients
+	OpenConns     int64  `json:"open_conns"`              // client connections open now
+	TotalConns    int64  `json:"total_conns"`             // client connections accepted so far
+	Errors        int64  `json:"errors,omitempty"`        // failed or refused client connections
+	LastActivity  string `json:"last_activity,omitempty"` // RFC 3339, empty if there was none
 }
 
 // StatusInfo for status response
@@ -90,6 +311,15 @@ type StatusInfo struct {
 	PID         int              `json:"pid"`
 	Uptime      string           `json:"uptime"`
 	Connections []ConnectionInfo `json:"connections"`
+	Proxy       *ProxyInfo       `json:"proxy,omitempty"`
+}
+
+// ProxyInfo describes the daemon's SOCKS proxy
+type ProxyInfo struct {
+	Address  string `json:"address"`
+	Requests int64  `json:"requests"`
+	Active   int64  `json:"active"`
+	Errors   int64  `json:"errors"`
 }
 
 // Helper functions for creating requests/responses
@@ -128,20 +358,69 @@ func NewErrorResponse(err string) *Response {
 // Convert portforward.Connection to ConnectionInfo
 func ConnectionToInfo(conn *portforward.Connection) ConnectionInfo {
 	info := conn.GetConnectionInfo()
-	resType := "pod"
-	if info.ResourceType == portforward.ResourceService {
-		resType = "service"
+	resType := string(info.ResourceType)
+	var probe string
+	if info.Probe != nil {
+		probe = info.Probe.String()
+	}
+	var idleTimeout string
+	if info.Lazy {
+		idleTimeout = info.IdleTimeout.String()
+	}
+	var tlsInfo string
+	if info.TLS != nil {
+		tlsInfo = info.TLS.String()
+	}
+	var recording string
+	if info.Recording != nil {
+		recording = info.Recording.String()
+	}
+	var faults string
+	if info.Faults != nil {
+		faults = info.Faults.String()
+	}
+	var limits string
+	if info.Limits != nil {
+		limits = info.Limits.String()
+	}
+	var lastActivity string
+	if !info.Metrics.LastActivity.IsZero() {
+		lastActivity = info.Metrics.LastActivity.Format(time.RFC3339)
 	}
 	return ConnectionInfo{
 		ID:           info.ID,
+		Context:      info.Context,
 		Namespace:    info.Namespace,
 		ResourceType: resType,
 		ResourceName: info.ResourceName,
+		PodName:      info.PodName,
+		Balance:      string(info.Balance),
+		Backends:     info.Backends,
 		LocalPort:    info.LocalPort,
 		RemotePort:   info.RemotePort,
+		Ports:        portforward.PortMappingStrings(info.Ports),
+		Addresses:    info.Addresses,
+		SocketPath:   info.SocketPath,
 		Status:       string(info.Status),
 		Error:        info.Error,
 		Duration:     formatDuration(info.Duration),
+		Reconnects:   info.ReconnectCount,
+		Probe:        probe,
+		ProbeError:   info.ProbeError,
+		Lazy:         info.Lazy,
+		IdleTimeout:  idleTimeout,
+		Routes:       portforward.RouteStrings(info.Routes),
+		TLS:          tlsInfo,
+		Recording:    recording,
+		Faults:       faults,
+		Limits:       limits,
+
+		BytesSent:     info.Metrics.BytesSent,
+		BytesReceived: info.Metrics.BytesReceived,
+		OpenConns:     info.Metrics.OpenConns,
+		TotalConns:    info.Metrics.TotalConns,
+		Errors:        info.Metrics.Errors,
+		LastActivity:  lastActivity,
 	}
 }
 
@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"github.com/pyqan/portFwd/internal/config"
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// SavedOptions converts a connection saved in the session state back to
+// manager options
+func SavedOptions(saved config.SavedConnection) (portforward.ForwardOptions, error) {
+	opts := portforward.ForwardOptions{
+		Context:      saved.Context,
+		Namespace:    saved.Namespace,
+		ResourceName: saved.ResourceName,
+		Addresses:    saved.Addresses,
+		SocketPath:   saved.SocketPath,
+		Probe:        saved.Probe.Options(),
+		Lazy:         saved.Lazy,
+		IdleTimeout:  saved.IdleTimeout,
+		TLS:          saved.TLS.Options(),
+	}
+	var err error
+	if opts.ResourceType, err = portforward.ParseResourceType(saved.ResourceType); err != nil {
+		return opts, err
+	}
+	if opts.Ports, err = portforward.ParsePortMappings(saved.Ports, saved.LocalPort, saved.RemotePort); err != nil {
+		return opts, err
+	}
+	if opts.SocketMode, err = portforward.ParseSocketMode(saved.SocketMode); err != nil {
+		return opts, err
+	}
+	if opts.Balance, err = portforward.ParseBalanceMode(saved.Balance); err != nil {
+		return opts, err
+	}
+	if opts.Routes, err = portforward.ParseRoutes(saved.Routes); err != nil {
+		return opts, err
+	}
+	if opts.Faults, err = faultsFromConfig(saved.Faults); err != nil {
+		return opts, err
+	}
+	if opts.Limits, err = saved.Limits.Options(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// SavedConnection converts a connection for saving in the session state
+func SavedConnection(conn portforward.SavedConnectionInfo) config.SavedConnection {
+	return config.SavedConnection{
+		Context:      conn.Context,
+		Namespace:    conn.Namespace,
+		ResourceType: conn.ResourceType,
+		ResourceName: conn.ResourceName,
+		LocalPort:    conn.LocalPort,
+		RemotePort:   conn.RemotePort,
+		Ports:        conn.Ports,
+		Addresses:    conn.Addresses,
+		SocketPath:   conn.SocketPath,
+		SocketMode:   conn.SocketMode,
+		Balance:      conn.Balance,
+		Probe:        config.NewProbeConfig(conn.Probe),
+		Lazy:         conn.Lazy,
+		IdleTimeout:  conn.IdleTimeout,
+		Routes:       conn.Routes,
+		TLS:          config.NewTLSConfig(conn.TLS),
+		Faults:       faultsToConfig(conn.Faults),
+		Limits:       config.NewLimitsConfig(conn.Limits),
+		WasActive:    conn.WasActive,
+	}
+}
+
+// faultsFromConfig parses a saved fault profile
+func faultsFromConfig(spec string) (*portforward.Faults, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	faults, err := portforward.ParseFaults(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &faults, nil
+}
+
+// faultsToConfig converts a connection's fault profile for saving
+func faultsToConfig(f *portforward.Faults) string {
+	if f == nil {
+		return ""
+	}
+	return f.String()
+}
@@ -0,0 +1,173 @@
+// Package hosts manages named blocks of entries in a hosts file. Every block
+// sits between a begin and an end marker line, so it can be replaced or
+// removed again without touching the rest of the file.
+package hosts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// DefaultPath is the system hosts file
+const DefaultPath = "/etc/hosts"
+
+// lockTimeout is how long an edit waits for another one to finish
+const lockTimeout = 5 * time.Second
+
+const (
+	beginMarker = "# BEGIN portfwd "
+	endMarker   = "# END portfwd "
+)
+
+// Entry maps an IP address to host names
+type Entry struct {
+	IP    string
+	Names []string
+}
+
+// Set replaces the block called name with entries, adding it at the end of
+// the file if it doesn't exist yet
+func Set(path, name string, entries []Entry) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid hosts block name %q", name)
+	}
+	return edit(path, func(lines []string) []string {
+		lines, _ = without(lines, name)
+		lines = append(lines, beginMarker+name)
+		for _, e := range entries {
+			lines = append(lines, e.IP+"\t"+strings.Join(e.Names, " "))
+		}
+		return append(lines, endMarker+name)
+	})
+}
+
+// Remove deletes the block called name; removing a missing block is no error
+func Remove(path, name string) error {
+	return edit(path, func(lines []string) []string {
+		lines, _ = without(lines, name)
+		return lines
+	})
+}
+
+// RemoveAll deletes every portfwd block and returns their names
+func RemoveAll(path string) ([]string, error) {
+	var removed []string
+	err := edit(path, func(lines []string) []string {
+		removed = blockNames(lines)
+		for _, name := range removed {
+			lines, _ = without(lines, name)
+		}
+		return lines
+	})
+	return removed, err
+}
+
+// Blocks returns the names of the portfwd blocks in the file
+func Blocks(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return blockNames(splitLines(string(data))), nil
+}
+
+// edit rewrites the file in place with change while holding an exclusive
+// lock on it. The file is not replaced by a new one, as /etc/hosts is often
+// a bind mount in containers.
+func edit(path string, change func(lines []string) []string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open hosts file: %w", err)
+	}
+	defer f.Close()
+
+	if err := lock(f); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read hosts file: %w", err)
+	}
+
+	before := strings.Join(lines, "\n")
+	lines = change(lines)
+	after := strings.Join(lines, "\n")
+	if after == before {
+		return nil
+	}
+	if after != "" {
+		after += "\n"
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	if _, err := f.WriteAt([]byte(after), 0); err != nil {
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	logger.Info("hosts", "Updated %s", path)
+	return f.Sync()
+}
+
+// lock takes an exclusive lock on f, giving up after lockTimeout
+func lock(f *os.File) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return fmt.Errorf("failed to lock hosts file: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("hosts file %s is locked by another process", f.Name())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// without returns lines without the block called name
+func without(lines []string, name string) ([]string, bool) {
+	result := make([]string, 0, len(lines))
+	inBlock, found := false, false
+	for _, line := range lines {
+		switch {
+		case line == beginMarker+name:
+			inBlock, found = true, true
+		case inBlock && line == endMarker+name:
+			inBlock = false
+		case !inBlock:
+			result = append(result, line)
+		}
+	}
+	return result, found
+}
+
+// blockNames returns the names of the blocks in lines
+func blockNames(lines []string) []string {
+	var names []string
+	for _, line := range lines {
+		if name, ok := strings.CutPrefix(line, beginMarker); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
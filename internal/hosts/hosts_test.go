@@ -0,0 +1,82 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const original = "127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost\n"
+
+func writeHosts(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readHosts(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSetAndRemove(t *testing.T) {
+	path := writeHosts(t)
+
+	api := Entry{IP: "127.1.2.3", Names: []string{"api", "api.team-a"}}
+	if err := Set(path, "team-a", []Entry{api}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	want := original + "# BEGIN portfwd team-a\n127.1.2.3\tapi api.team-a\n# END portfwd team-a\n"
+	if got := readHosts(t, path); got != want {
+		t.Errorf("after set:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Setting again replaces the block instead of adding another one
+	db := Entry{IP: "127.4.5.6", Names: []string{"db"}}
+	if err := Set(path, "team-a", []Entry{db}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := Set(path, "team-b", []Entry{api}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	blocks, err := Blocks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blocks, []string{"team-a", "team-b"}) {
+		t.Errorf("blocks = %v", blocks)
+	}
+
+	if err := Remove(path, "team-a"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	want = original + "# BEGIN portfwd team-b\n127.1.2.3\tapi api.team-a\n# END portfwd team-b\n"
+	if got := readHosts(t, path); got != want {
+		t.Errorf("after remove:\n%s\nwant:\n%s", got, want)
+	}
+
+	removed, err := RemoveAll(path)
+	if err != nil {
+		t.Fatalf("remove all: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"team-b"}) {
+		t.Errorf("removed = %v", removed)
+	}
+	if got := readHosts(t, path); got != original {
+		t.Errorf("file not restored:\n%s", got)
+	}
+}
+
+func TestSetRejectsBadName(t *testing.T) {
+	if err := Set(writeHosts(t), "team a", nil); err == nil {
+		t.Error("expected an error for a name with a space")
+	}
+}
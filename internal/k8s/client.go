@@ -3,8 +3,6 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,15 +10,17 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
 	"github.com/pyqan/portFwd/internal/logger"
 )
 
 // Client wraps Kubernetes client with helper methods
 type Client struct {
-	clientset  *kubernetes.Clientset
-	restConfig *rest.Config
+	clientset    *kubernetes.Clientset
+	restConfig   *rest.Config
+	options      Options
+	clientConfig clientcmd.ClientConfig
 }
 
 // PodInfo contains pod information for display
@@ -54,11 +54,61 @@ type ServicePort struct {
 	Protocol   string
 }
 
+// Options selects the kubeconfig and what to use from it, like kubectl's
+// global flags. Zero values keep the kubeconfig's own settings.
+type Options struct {
+	Kubeconfig        string   // kubeconfig file; the KUBECONFIG list or ~/.kube/config if empty
+	Context           string   // context to use instead of the current one
+	Cluster           string   // cluster to use instead of the context's
+	User              string   // user to use instead of the context's
+	Impersonate       string   // user to act as
+	ImpersonateGroups []string // groups to act as
+}
+
+// Args returns the command-line flags that reproduce o
+func (o Options) Args() []string {
+	var args []string
+	add := func(flag, value string) {
+		if value != "" {
+			args = append(args, "--"+flag, value)
+		}
+	}
+	add("kubeconfig", o.Kubeconfig)
+	add("context", o.Context)
+	add("cluster", o.Cluster)
+	add("user", o.User)
+	add("as", o.Impersonate)
+	for _, group := range o.ImpersonateGroups {
+		add("as-group", group)
+	}
+	return args
+}
+
+// clientConfig returns the deferred-loading client config for o. Like
+// kubectl it merges every file of KUBECONFIG and falls back to the in-cluster
+// config when there is no kubeconfig at all.
+func (o Options) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: o.Context,
+		Context: clientcmdapi.Context{
+			Cluster:  o.Cluster,
+			AuthInfo: o.User,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       o.Impersonate,
+			ImpersonateGroups: o.ImpersonateGroups,
+		},
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
 // NewClient creates a new Kubernetes client
-// Based on: https://github.com/kubernetes/client-go/tree/master/examples/out-of-cluster-client-configuration
-func NewClient() (*Client, error) {
+func NewClient(opts Options) (*Client, error) {
 	logger.Debug("k8s", "Creating new Kubernetes client...")
-	config, err := getKubeConfig()
+	clientConfig := opts.clientConfig()
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
 		logger.Error("k8s", "Failed to get kubeconfig: %v", err)
 		return nil, fmt.Errorf("failed to get kubeconfig: %w", err)
@@ -73,59 +123,32 @@ func NewClient() (*Client, error) {
 	logger.Info("k8s", "Kubernetes client created successfully")
 
 	return &Client{
-		clientset:  clientset,
-		restConfig: config,
+		clientset:    clientset,
+		restConfig:   config,
+		options:      opts,
+		clientConfig: clientConfig,
 	}, nil
 }
 
 // NewClientWithKubeconfig creates a client with specific kubeconfig path
 func NewClientWithKubeconfig(kubeconfigPath string) (*Client, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build config from %s: %w", kubeconfigPath, err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create clientset: %w", err)
-	}
-
-	return &Client{
-		clientset:  clientset,
-		restConfig: config,
-	}, nil
+	return NewClient(Options{Kubeconfig: kubeconfigPath})
 }
 
-// getKubeConfig returns the Kubernetes configuration
-// Based on: https://github.com/kubernetes/client-go/tree/master/examples/out-of-cluster-client-configuration
-
-func getKubeConfig() (*rest.Config, error) {
-	// Try in-cluster config first (when running inside a pod)
-	config, err := rest.InClusterConfig()
-	if err == nil {
-		return config, nil
-	}
-
-	// Fall back to kubeconfig file (out-of-cluster)
-	var kubeconfig string
-
-	// Check KUBECONFIG env var first
-	if envKubeconfig := os.Getenv("KUBECONFIG"); envKubeconfig != "" {
-		kubeconfig = envKubeconfig
-	} else if home := homedir.HomeDir(); home != "" {
-		// Use default location ~/.kube/config
-		kubeconfig = filepath.Join(home, ".kube", "config")
-	} else {
-		return nil, fmt.Errorf("unable to locate kubeconfig file")
-	}
-
-	// Use the current context in kubeconfig
-	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+// ContextClients returns the clientset and REST config of another context
+// of the client's kubeconfig. Impersonation carries over, cluster and user
+// overrides don't. It fits portforward.ClientFactory.
+func (c *Client) ContextClients(contextName string) (kubernetes.Interface, *rest.Config, error) {
+	client, err := NewClient(Options{
+		Kubeconfig:        c.options.Kubeconfig,
+		Context:           contextName,
+		Impersonate:       c.options.Impersonate,
+		ImpersonateGroups: c.options.ImpersonateGroups,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
+		return nil, nil, err
 	}
-
-	return config, nil
+	return client.clientset, client.restConfig, nil
 }
 
 // GetRestConfig returns the REST config for port-forwarding
@@ -309,7 +332,7 @@ type ServiceTargetInfo struct {
 	TargetPort int
 }
 
-// GetPodForService finds a running pod that backs the given service
+// GetPodForService finds a ready pod that backs the given service
 func (c *Client) GetPodForService(ctx context.Context, namespace, serviceName string) (*PodInfo, error) {
 	info, err := c.GetServiceTarget(ctx, namespace, serviceName, 0)
 	if err != nil {
@@ -318,12 +341,11 @@ func (c *Client) GetPodForService(ctx context.Context, namespace, serviceName st
 	return c.GetPod(ctx, namespace, info.PodName)
 }
 
-// GetServiceTarget finds a running pod and resolves targetPort for a service
-// If servicePort is 0, uses the first port defined in the service
+// GetServiceTarget finds a ready pod and its target port for a service using
+// the service's EndpointSlices. If servicePort is 0, uses the first port defined in the service
 func (c *Client) GetServiceTarget(ctx context.Context, namespace, serviceName string, servicePort int) (*ServiceTargetInfo, error) {
 	logger.Debug("k8s", "GetServiceTarget: %s/%s port=%d", namespace, serviceName, servicePort)
-	
-	// Get the service to find its selector and ports
+
 	svc, err := c.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
 	if err != nil {
 		logger.Error("k8s", "GetServiceTarget: failed to get service %s/%s: %v", namespace, serviceName, err)
@@ -331,90 +353,154 @@ func (c *Client) GetServiceTarget(ctx context.Context, namespace, serviceName st
 	}
 	logger.Debug("k8s", "GetServiceTarget: service found, type=%s, clusterIP=%s", svc.Spec.Type, svc.Spec.ClusterIP)
 
-	if len(svc.Spec.Selector) == 0 {
-		logger.Error("k8s", "GetServiceTarget: service %s has no selector", serviceName)
-		return nil, fmt.Errorf("service %s has no selector", serviceName)
+	if _, ok := FindServicePort(svc, servicePort); !ok {
+		logger.Error("k8s", "GetServiceTarget: port %d not found in service %s", servicePort, serviceName)
+		return nil, fmt.Errorf("port %d not found in service %s", servicePort, serviceName)
 	}
 
-	// Find the target port for the given service port
-	var targetPort int
-	for _, port := range svc.Spec.Ports {
-		logger.Debug("k8s", "GetServiceTarget: checking port %d -> %v", port.Port, port.TargetPort)
-		if servicePort == 0 || int(port.Port) == servicePort {
-			// targetPort can be a number or a named port
-			if port.TargetPort.IntValue() != 0 {
-				targetPort = port.TargetPort.IntValue()
-				logger.Debug("k8s", "GetServiceTarget: targetPort (numeric) = %d", targetPort)
-			} else {
-				// Named port - need to resolve from pod
-				targetPort = int(port.Port) // fallback to service port
-				logger.Debug("k8s", "GetServiceTarget: targetPort (fallback) = %d", targetPort)
-			}
-			break
-		}
+	slices, err := ListEndpointSlices(ctx, c.clientset, namespace, serviceName)
+	if err != nil {
+		return nil, err
 	}
+	logger.Debug("k8s", "GetServiceTarget: found %d EndpointSlices", len(slices))
 
-	if targetPort == 0 {
-		logger.Error("k8s", "GetServiceTarget: port %d not found in service %s", servicePort, serviceName)
-		return nil, fmt.Errorf("port %d not found in service %s", servicePort, serviceName)
+	endpoints := MatchEndpoints(svc, servicePort, slices)
+	if err := endpoints.Err(); err != nil {
+		logger.Error("k8s", "GetServiceTarget: %v", err)
+		return nil, err
 	}
 
-	// Build label selector from service selector
-	var selectorParts []string
-	for k, v := range svc.Spec.Selector {
-		selectorParts = append(selectorParts, fmt.Sprintf("%s=%s", k, v))
+	target := endpoints.Ready[0]
+	logger.Info("k8s", "GetServiceTarget: selected pod %s, targetPort=%d", target.PodName, target.Port)
+	return &ServiceTargetInfo{
+		PodName:    target.PodName,
+		Namespace:  namespace,
+		TargetPort: target.Port,
+	}, nil
+}
+
+// GetCurrentContext returns the name of the Kubernetes context in use,
+// taking --context into account
+func (c *Client) GetCurrentContext() (string, error) {
+	if c.options.Context != "" {
+		return c.options.Context, nil
 	}
-	labelSelector := ""
-	for i, part := range selectorParts {
-		if i > 0 {
-			labelSelector += ","
-		}
-		labelSelector += part
+	config, err := c.clientConfig.RawConfig()
+	if err != nil {
+		return "", err
 	}
-	logger.Debug("k8s", "GetServiceTarget: label selector = %s", labelSelector)
+	return config.CurrentContext, nil
+}
 
-	// List pods matching the selector
-	pods, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
-	})
-	if err != nil {
-		logger.Error("k8s", "GetServiceTarget: failed to list pods: %v", err)
-		return nil, fmt.Errorf("failed to list pods for service: %w", err)
+// WorkloadInfo contains workload (deployment, statefulset, ...) information for display
+type WorkloadInfo struct {
+	Name      string
+	Namespace string
+	Kind      string // "deployment", "statefulset", "replicaset", "daemonset" or "job"
+	Ready     string // ready/desired pods, e.g. "2/3"
+	Ports     []ContainerPort
+}
+
+// GetWorkloads returns the workloads of the given kind in a namespace
+func (c *Client) GetWorkloads(ctx context.Context, namespace, kind string) ([]WorkloadInfo, error) {
+	logger.Debug("k8s", "Listing %ss in namespace: %s", kind, namespace)
+	opts := metav1.ListOptions{}
+	result := make([]WorkloadInfo, 0)
+
+	add := func(name string, ready, desired int32, template corev1.PodTemplateSpec) {
+		result = append(result, WorkloadInfo{
+			Name:      name,
+			Namespace: namespace,
+			Kind:      kind,
+			Ready:     fmt.Sprintf("%d/%d", ready, desired),
+			Ports:     templatePorts(template),
+		})
 	}
-	logger.Debug("k8s", "GetServiceTarget: found %d pods matching selector", len(pods.Items))
 
-	// Find a running pod
-	for _, pod := range pods.Items {
-		logger.Debug("k8s", "GetServiceTarget: pod %s phase=%s", pod.Name, pod.Status.Phase)
-		if pod.Status.Phase == corev1.PodRunning {
-			logger.Info("k8s", "GetServiceTarget: selected pod %s, targetPort=%d", pod.Name, targetPort)
-			return &ServiceTargetInfo{
-				PodName:    pod.Name,
-				Namespace:  pod.Namespace,
-				TargetPort: targetPort,
-			}, nil
+	var err error
+	switch kind {
+	case "deployment":
+		list, listErr := c.clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+		if err = listErr; err == nil {
+			for _, d := range list.Items {
+				desired := int32(1)
+				if d.Spec.Replicas != nil {
+					desired = *d.Spec.Replicas
+				}
+				add(d.Name, d.Status.ReadyReplicas, desired, d.Spec.Template)
+			}
+		}
+	case "statefulset":
+		list, listErr := c.clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+		if err = listErr; err == nil {
+			for _, s := range list.Items {
+				desired := int32(1)
+				if s.Spec.Replicas != nil {
+					desired = *s.Spec.Replicas
+				}
+				add(s.Name, s.Status.ReadyReplicas, desired, s.Spec.Template)
+			}
 		}
+	case "replicaset":
+		list, listErr := c.clientset.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+		if err = listErr; err == nil {
+			for _, r := range list.Items {
+				desired := int32(1)
+				if r.Spec.Replicas != nil {
+					desired = *r.Spec.Replicas
+				}
+				add(r.Name, r.Status.ReadyReplicas, desired, r.Spec.Template)
+			}
+		}
+	case "daemonset":
+		list, listErr := c.clientset.AppsV1().DaemonSets(namespace).List(ctx, opts)
+		if err = listErr; err == nil {
+			for _, d := range list.Items {
+				add(d.Name, d.Status.NumberReady, d.Status.DesiredNumberScheduled, d.Spec.Template)
+			}
+		}
+	case "job":
+		list, listErr := c.clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+		if err = listErr; err == nil {
+			for _, j := range list.Items {
+				desired := int32(1)
+				if j.Spec.Parallelism != nil {
+					desired = *j.Spec.Parallelism
+				}
+				ready := j.Status.Active
+				if j.Status.Ready != nil {
+					ready = *j.Status.Ready
+				}
+				add(j.Name, ready, desired, j.Spec.Template)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported workload kind: %s", kind)
+	}
+	if err != nil {
+		logger.Error("k8s", "Failed to list %ss in %s: %v", kind, namespace, err)
+		return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
 	}
 
-	logger.Error("k8s", "GetServiceTarget: no running pods found for service %s", serviceName)
-	return nil, fmt.Errorf("no running pods found for service %s", serviceName)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	logger.Debug("k8s", "Found %d %ss in namespace %s", len(result), kind, namespace)
+	return result, nil
 }
 
-// GetCurrentContext returns the current Kubernetes context name
-func (c *Client) GetCurrentContext() (string, error) {
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
+// templatePorts returns the container ports declared in a pod template
+func templatePorts(template corev1.PodTemplateSpec) []ContainerPort {
+	ports := make([]ContainerPort, 0)
+	for _, container := range template.Spec.Containers {
+		for _, port := range container.Ports {
+			ports = append(ports, ContainerPort{
+				Name:          port.Name,
+				ContainerPort: port.ContainerPort,
+				Protocol:      string(port.Protocol),
+			})
 		}
-		kubeconfig = filepath.Join(home, ".kube", "config")
-	}
-
-	config, err := clientcmd.LoadFromFile(kubeconfig)
-	if err != nil {
-		return "", err
 	}
-
-	return config.CurrentContext, nil
+	return ports
 }
@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKubeconfig writes a kubeconfig with one cluster, user and context per
+// name, the first one current
+func writeKubeconfig(t *testing.T, dir, file string, names ...string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: Config\ncurrent-context: " + names[0] + "\nclusters:\n")
+	for _, n := range names {
+		b.WriteString("- name: " + n + "\n  cluster:\n    server: https://" + n + ".example:6443\n")
+	}
+	b.WriteString("users:\n")
+	for _, n := range names {
+		b.WriteString("- name: " + n + "\n  user:\n    token: " + n + "-token\n")
+	}
+	b.WriteString("contexts:\n")
+	for _, n := range names {
+		b.WriteString("- name: " + n + "\n  context:\n    cluster: " + n + "\n    user: " + n + "\n")
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewClientLoadingRules(t *testing.T) {
+	dir := t.TempDir()
+	first := writeKubeconfig(t, dir, "first", "dev")
+	second := writeKubeconfig(t, dir, "second", "staging", "prod")
+	t.Setenv("KUBECONFIG", first+string(os.PathListSeparator)+second)
+
+	tests := []struct {
+		name        string
+		opts        Options
+		wantContext string
+		wantHost    string
+		wantToken   string
+	}{
+		{
+			name:        "merged KUBECONFIG list",
+			wantContext: "dev",
+			wantHost:    "https://dev.example:6443",
+			wantToken:   "dev-token",
+		},
+		{
+			name:        "context from the second file",
+			opts:        Options{Context: "prod"},
+			wantContext: "prod",
+			wantHost:    "https://prod.example:6443",
+			wantToken:   "prod-token",
+		},
+		{
+			name:        "cluster and user overrides",
+			opts:        Options{Cluster: "staging", User: "prod"},
+			wantContext: "dev",
+			wantHost:    "https://staging.example:6443",
+			wantToken:   "prod-token",
+		},
+		{
+			name:        "explicit kubeconfig",
+			opts:        Options{Kubeconfig: second},
+			wantContext: "staging",
+			wantHost:    "https://staging.example:6443",
+			wantToken:   "staging-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.opts)
+			if err != nil {
+				t.Fatalf("NewClient: %v", err)
+			}
+			if got := client.GetRestConfig().Host; got != tt.wantHost {
+				t.Errorf("host = %s, want %s", got, tt.wantHost)
+			}
+			if got := client.GetRestConfig().BearerToken; got != tt.wantToken {
+				t.Errorf("token = %s, want %s", got, tt.wantToken)
+			}
+			if got, err := client.GetCurrentContext(); err != nil || got != tt.wantContext {
+				t.Errorf("current context = %q, %v, want %q", got, err, tt.wantContext)
+			}
+		})
+	}
+}
+
+func TestContextClientsKeepImpersonation(t *testing.T) {
+	dir := t.TempDir()
+	path := writeKubeconfig(t, dir, "config", "dev", "prod")
+
+	client, err := NewClient(Options{Kubeconfig: path, User: "dev", Impersonate: "auditor", ImpersonateGroups: []string{"readers"}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	_, config, err := client.ContextClients("prod")
+	if err != nil {
+		t.Fatalf("ContextClients: %v", err)
+	}
+	if config.Host != "https://prod.example:6443" || config.BearerToken != "prod-token" {
+		t.Errorf("got %s with token %s, want prod's cluster and user", config.Host, config.BearerToken)
+	}
+	if config.Impersonate.UserName != "auditor" || len(config.Impersonate.Groups) != 1 {
+		t.Errorf("impersonation = %+v, want auditor in readers", config.Impersonate)
+	}
+
+	if _, _, err := client.ContextClients("missing"); err == nil {
+		t.Error("expected an error for a context that isn't in the kubeconfig")
+	}
+}
+
+func TestOptionsArgs(t *testing.T) {
+	opts := Options{Kubeconfig: "/k", Context: "prod", Impersonate: "me", ImpersonateGroups: []string{"a", "b"}}
+	got := strings.Join(opts.Args(), " ")
+	want := "--kubeconfig /k --context prod --as me --as-group a --as-group b"
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// ErrNoReadyEndpoints is returned when a service has no ready pod to forward to
+var ErrNoReadyEndpoints = errors.New("no ready endpoints")
+
+// Endpoint is a pod behind a service together with the resolved target port
+type Endpoint struct {
+	PodName string
+	Port    int
+}
+
+// ServiceEndpoints lists the pods behind one service port
+type ServiceEndpoints struct {
+	Service  string
+	Port     int        // service port the endpoints were matched for
+	Ready    []Endpoint // ready, non-terminating pods, sorted by name
+	NotReady []string   // pods that exist but are unready or terminating
+}
+
+// Err explains why there is nothing to forward to, or returns nil if there is
+func (e ServiceEndpoints) Err() error {
+	if len(e.Ready) > 0 {
+		return nil
+	}
+	if len(e.NotReady) > 0 {
+		return fmt.Errorf("%w for service %s port %d: %d pod(s) not ready (%s)",
+			ErrNoReadyEndpoints, e.Service, e.Port, len(e.NotReady), strings.Join(e.NotReady, ", "))
+	}
+	return fmt.Errorf("%w for service %s port %d: no pods match the service", ErrNoReadyEndpoints, e.Service, e.Port)
+}
+
+// FindServicePort returns the port spec for servicePort, or the first port if servicePort is 0
+func FindServicePort(svc *corev1.Service, servicePort int) (corev1.ServicePort, bool) {
+	for _, port := range svc.Spec.Ports {
+		if servicePort == 0 || int(port.Port) == servicePort {
+			return port, true
+		}
+	}
+	return corev1.ServicePort{}, false
+}
+
+// MatchEndpoints picks the endpoints of svc that serve servicePort from its
+// EndpointSlices. Only ready, non-terminating pod endpoints end up in Ready.
+// If the service doesn't define servicePort it is taken as the target port.
+func MatchEndpoints(svc *corev1.Service, servicePort int, slices []*discoveryv1.EndpointSlice) ServiceEndpoints {
+	result := ServiceEndpoints{Service: svc.Name, Port: servicePort}
+
+	spec, found := FindServicePort(svc, servicePort)
+	if found {
+		result.Port = int(spec.Port)
+	}
+	protocol := spec.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+
+	seen := make(map[string]bool)
+	for _, slice := range slices {
+		// Slices are split by port set, so the port applies to every endpoint in it
+		port := 0
+		for _, p := range slice.Ports {
+			if p.Port == nil {
+				continue
+			}
+			if p.Protocol != nil && *p.Protocol != protocol {
+				continue
+			}
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if (found && name == spec.Name) || (!found && int(*p.Port) == servicePort) {
+				port = int(*p.Port)
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" || seen[ep.TargetRef.Name] {
+				continue
+			}
+			seen[ep.TargetRef.Name] = true
+
+			if isEndpointReady(ep) {
+				result.Ready = append(result.Ready, Endpoint{PodName: ep.TargetRef.Name, Port: port})
+			} else {
+				result.NotReady = append(result.NotReady, ep.TargetRef.Name)
+			}
+		}
+	}
+
+	sort.Slice(result.Ready, func(i, j int) bool {
+		return result.Ready[i].PodName < result.Ready[j].PodName
+	})
+	sort.Strings(result.NotReady)
+	return result
+}
+
+// isEndpointReady reports whether an endpoint may receive new connections.
+// A nil Ready condition means unknown and is treated as ready, as kube-proxy does.
+func isEndpointReady(ep discoveryv1.Endpoint) bool {
+	if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+		return false
+	}
+	return ep.Conditions.Ready == nil || *ep.Conditions.Ready
+}
+
+// ListEndpointSlices returns the EndpointSlices that belong to a service
+func ListEndpointSlices(ctx context.Context, clientset kubernetes.Interface, namespace, serviceName string) ([]*discoveryv1.EndpointSlice, error) {
+	list, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + serviceName,
+	})
+	if err != nil {
+		logger.Error("k8s", "Failed to list EndpointSlices for %s/%s: %v", namespace, serviceName, err)
+		return nil, fmt.Errorf("failed to list endpoints for service: %w", err)
+	}
+
+	slices := make([]*discoveryv1.EndpointSlice, 0, len(list.Items))
+	for i := range list.Items {
+		slices = append(slices, &list.Items[i])
+	}
+	return slices, nil
+}
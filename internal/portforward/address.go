@@ -0,0 +1,100 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultAddresses are the local addresses a forward listens on unless told otherwise
+var DefaultAddresses = []string{"127.0.0.1"}
+
+// ParseAddresses validates bind addresses given as IPs (e.g. "::1", "0.0.0.0")
+// or "localhost". Without any, DefaultAddresses are returned.
+func ParseAddresses(addresses []string) ([]string, error) {
+	if len(addresses) == 0 {
+		return append([]string(nil), DefaultAddresses...), nil
+	}
+
+	result := make([]string, 0, len(addresses))
+	seen := make(map[string]bool)
+	for _, addr := range addresses {
+		addr = strings.TrimSpace(addr)
+		if addr != "localhost" && net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid bind address %q (use an IP address or localhost)", addr)
+		}
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		result = append(result, addr)
+	}
+	return result, nil
+}
+
+// IsLoopbackAddress reports whether addr only accepts connections from this host
+func IsLoopbackAddress(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ExposedAddresses returns the addresses that are reachable from other hosts
+func ExposedAddresses(addresses []string) []string {
+	var exposed []string
+	for _, addr := range addresses {
+		if !IsLoopbackAddress(addr) {
+			exposed = append(exposed, addr)
+		}
+	}
+	return exposed
+}
+
+// isDefaultAddresses reports whether addresses are DefaultAddresses
+func isDefaultAddresses(addresses []string) bool {
+	if len(addresses) != len(DefaultAddresses) {
+		return false
+	}
+	for i := range addresses {
+		if addresses[i] != DefaultAddresses[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// listenAddress joins a bind address and port ("[::1]:8080")
+func listenAddress(addr string, port int) string {
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// listenTCP listens on port of a bind address. Like kubectl, "localhost"
+// means both 127.0.0.1 and ::1 and only fails when neither can be bound.
+// Port 0 binds the same OS-picked port on both.
+func listenTCP(addr string, port int) ([]net.Listener, error) {
+	hosts := []string{addr}
+	if addr == "localhost" {
+		hosts = []string{"127.0.0.1", "::1"}
+	}
+
+	var listeners []net.Listener
+	var firstErr error
+	for _, host := range hosts {
+		listener, err := net.Listen("tcp", listenAddress(host, port))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		listeners = append(listeners, listener)
+		port = listener.Addr().(*net.TCPAddr).Port
+	}
+	if len(listeners) == 0 {
+		return nil, firstErr
+	}
+	return listeners, nil
+}
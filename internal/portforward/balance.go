@@ -0,0 +1,361 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/pyqan/portFwd/internal/k8s"
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// BalanceMode selects how a service forward spreads local client connections
+type BalanceMode string
+
+const (
+	BalanceNone       BalanceMode = ""            // single pod, like kubectl
+	BalanceRoundRobin BalanceMode = "round-robin" // rotate through ready pods
+	BalanceLeastConn  BalanceMode = "least-conn"  // pod with fewest open connections
+)
+
+// ParseBalanceMode parses a balance mode as used in flags and profiles
+func ParseBalanceMode(s string) (BalanceMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none", "off":
+		return BalanceNone, nil
+	case "round-robin", "roundrobin", "rr":
+		return BalanceRoundRobin, nil
+	case "least-conn", "leastconn", "least-connections", "lc":
+		return BalanceLeastConn, nil
+	default:
+		return BalanceNone, fmt.Errorf("unknown balance mode %q (use round-robin or least-conn)", s)
+	}
+}
+
+// backendPool holds one tunnel per ready pod and picks one for each client
+type backendPool struct {
+	mode     BalanceMode
+	mu       sync.Mutex
+	backends []*tunnel
+	next     int
+
+	// Clients refused since the pool ran out of backends, so that is
+	// logged once when it happens and once when it's over
+	refusing atomic.Bool
+	refused  atomic.Int64
+}
+
+func newBackendPool(mode BalanceMode) *backendPool {
+	return &backendPool{mode: mode}
+}
+
+// pick returns the tunnel the next client connection should use
+func (p *backendPool) pick() *tunnel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.backends)
+	if n == 0 {
+		return nil
+	}
+
+	start := p.next % n
+	p.next = (start + 1) % n
+
+	if p.mode != BalanceLeastConn {
+		return p.backends[start]
+	}
+
+	// Least connections, ties broken in round-robin order
+	best := p.backends[start]
+	for i := 1; i < n; i++ {
+		t := p.backends[(start+i)%n]
+		if t.activeConns() < best.activeConns() {
+			best = t
+		}
+	}
+	return best
+}
+
+func (p *backendPool) get(pod string) *tunnel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.backends {
+		if t.pod == pod {
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *backendPool) add(t *tunnel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backends = append(p.backends, t)
+	sort.Slice(p.backends, func(i, j int) bool {
+		return p.backends[i].pod < p.backends[j].pod
+	})
+}
+
+func (p *backendPool) remove(t *tunnel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.backends {
+		if p.backends[i] == t {
+			p.backends = append(p.backends[:i], p.backends[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *backendPool) list() []*tunnel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*tunnel(nil), p.backends...)
+}
+
+func (p *backendPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.backends {
+		t.Close()
+	}
+	p.backends = nil
+}
+
+// runBalancedPortForward runs a service forward that owns the local listener
+// and keeps one tunnel per ready pod, spreading client connections over them.
+// Like runPortForward it returns once the forward ends.
+func (m *Manager) runBalancedPortForward(ctx context.Context, conn *Connection) (established bool, err error) {
+	conn.AddLog("Finding endpoints for service...")
+	svc, _, err := m.lookupService(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+
+	attemptCtx, cancelAttempt := context.WithCancel(ctx)
+	defer cancelAttempt()
+
+	// Wake the reconcile loop whenever the endpoints of the service change
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	informer, err := m.startEndpointSliceInformer(attemptCtx, conn.cluster, conn.Namespace, svc.Name, cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ Failed to watch endpoints: %v", err))
+		return false, err
+	}
+	if !cache.WaitForCacheSync(attemptCtx.Done(), informer.HasSynced) {
+		return false, fmt.Errorf("failed to list endpoints for service")
+	}
+
+	// One listener per port mapping and bind address
+	mappings := conn.portMappings()
+	listeners, err := openListeners(conn)
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Error("portforward", "Listen failed for %s: %v", conn.ID, err)
+		return false, err
+	}
+	defer closeListeners(listeners)
+
+	pool := newBackendPool(conn.Balance)
+	defer pool.closeAll()
+
+	// reconcile makes the pool match the pods ready on every mapped port and
+	// returns the per-mapping endpoint sets, or why there are no such pods
+	reconcile := func() ([]k8s.ServiceEndpoints, error) {
+		var slices []*discoveryv1.EndpointSlice
+		for _, obj := range informer.GetStore().List() {
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				slices = append(slices, slice)
+			}
+		}
+		targets, sets, matchErr := matchServiceTargets(mappings, svc, slices)
+
+		ready := make(map[string][]int)
+		for _, target := range targets {
+			ready[target.pod] = target.ports
+		}
+
+		for _, t := range pool.list() {
+			if ports, ok := ready[t.pod]; ok && equalPorts(ports, t.ports) && !t.isClosed() {
+				continue
+			}
+			pool.remove(t)
+			t.Close()
+			conn.AddLog(fmt.Sprintf("− Backend removed: %s", t.pod))
+			logger.Info("portforward", "Backend removed from %s: %s", conn.ID, t.pod)
+		}
+
+		for _, target := range targets {
+			if pool.get(target.pod) != nil {
+				continue
+			}
+			name, ports := target.pod, target.ports
+			t, err := m.dialTunnel(attemptCtx, conn.cluster, conn.Namespace, name, ports)
+			if err != nil {
+				conn.AddLog(fmt.Sprintf("✗ Tunnel to %s failed: %v", name, err))
+				logger.Error("portforward", "Tunnel to %s/%s failed: %v", conn.Namespace, name, err)
+				continue
+			}
+			pool.add(t)
+			conn.AddLog(fmt.Sprintf("+ Backend added: %s %v over %s", name, ports, t.transport))
+			logger.Info("portforward", "Backend added to %s: %s %v", conn.ID, name, ports)
+
+			// Re-check the pool as soon as this tunnel drops
+			go func(t *tunnel) {
+				select {
+				case <-t.closed():
+					notify()
+				case <-attemptCtx.Done():
+				}
+			}(t)
+		}
+
+		backends := make([]string, 0)
+		for _, t := range pool.list() {
+			backends = append(backends, t.pod)
+		}
+
+		conn.mu.Lock()
+		conn.Backends = backends
+		if conn.Status != StatusStopped && established {
+			if len(backends) == 0 {
+				conn.Status = StatusReconnecting
+				conn.Error = k8s.ErrNoReadyEndpoints.Error()
+			} else if conn.Status != StatusDegraded {
+				// Probes decide when a degraded forward is healthy again
+				conn.Status = StatusActive
+				conn.Error = ""
+			}
+		}
+		conn.mu.Unlock()
+		m.notifyChange()
+		return sets, matchErr
+	}
+
+	sets, err := reconcile()
+	for _, set := range sets {
+		logNotReady(conn, set)
+	}
+	if len(pool.list()) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no tunnel to any ready pod could be opened")
+		}
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Error("portforward", "No backends for service %s: %v", conn.ResourceName, err)
+		return false, err
+	}
+
+	acceptErr := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go m.serveBalanced(listener, conn, pool, acceptErr)
+	}
+	probesDone := make(chan struct{})
+	defer close(probesDone)
+	go conn.serveProbes(pool.pick, probesDone)
+
+	established = true
+	conn.mu.Lock()
+	conn.Status = StatusActive
+	conn.Error = ""
+	backendCount := len(conn.Backends)
+	conn.mu.Unlock()
+	for _, listener := range listeners {
+		conn.AddLog(fmt.Sprintf("✓ Listening on %s, balancing over %d pods (%s)", listener.Addr(), backendCount, conn.Balance))
+	}
+	logger.Info("portforward", "Balanced forward ready: %s (%d backends)", conn.ID, backendCount)
+	conn.markReady()
+	m.notifyChange()
+	probeFailed := m.watchProbe(attemptCtx, conn)
+
+	// Periodic resync re-dials tunnels that failed to open earlier
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-changed:
+			reconcile()
+		case <-ticker.C:
+			reconcile()
+		case err := <-probeFailed:
+			// Backends are up but don't answer - start over with fresh tunnels
+			conn.AddLog(fmt.Sprintf("⟳ %v, re-dialing tunnels", err))
+			logger.Warn("portforward", "Probe gave up on %s: %v", conn.ID, err)
+			return true, err
+		case err := <-acceptErr:
+			conn.AddLog(fmt.Sprintf("✗ Listener error: %v", err))
+			logger.Error("portforward", "Listener error: %s - %v", conn.ID, err)
+			return true, err
+		case <-conn.stopChan:
+			conn.AddLog("Stop signal received")
+			logger.Debug("portforward", "Stop signal received for: %s", conn.ID)
+			return true, nil
+		case <-ctx.Done():
+			conn.AddLog("Shutting down...")
+			return true, nil
+		}
+	}
+}
+
+// serveBalanced accepts local clients of a listener and hands each one to a
+// backend tunnel
+func (m *Manager) serveBalanced(listener localListener, conn *Connection, pool *backendPool, errChan chan<- error) {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		backend := pool.pick()
+		if backend == nil {
+			if pool.refusing.CompareAndSwap(false, true) {
+				conn.AddLog("✗ No ready backends, refusing clients")
+				logger.Warn("portforward", "No ready backends for %s, refusing clients", conn.ID)
+			}
+			pool.refused.Add(1)
+			conn.metrics.refused()
+			client.Close()
+			continue
+		}
+		if pool.refusing.CompareAndSwap(true, false) {
+			n := pool.refused.Swap(0)
+			conn.AddLog(fmt.Sprintf("✓ Backends ready again, %d clients were refused", n))
+			logger.Info("portforward", "Backends ready again for %s after %d refused clients", conn.ID, n)
+		}
+
+		logger.Debug("portforward", "Handling connection for %s via %s", listener.Addr(), backend.pod)
+		go conn.serveClient(client, backend, listener.mapping)
+	}
+}
+
+// equalPorts reports whether two per-mapping port lists are the same
+func equalPorts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
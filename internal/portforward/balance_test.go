@@ -0,0 +1,121 @@
+package portforward_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+// namePod routes port 8080 of a pod to a server that greets every client
+// with the pod name and keeps the connection open until the client closes it
+func namePod(t *testing.T, dialer *portforwardtest.Dialer, pod string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.WriteString(c, pod)
+				io.Copy(io.Discard, c)
+			}()
+		}
+	}()
+	dialer.Route(namespace, pod, 8080, l.Addr().String())
+}
+
+// startBalancedForward starts a forward balanced over the ready pods web-a
+// and web-b
+func startBalancedForward(t *testing.T, mode portforward.BalanceMode) *portforward.Connection {
+	t.Helper()
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	labels := map[string]string{"app": "web"}
+	m, dialer := newTestManager(t,
+		webService(),
+		runningPod("web-a", labels, httpPort),
+		runningPod("web-b", labels, httpPort),
+		endpointSlice(map[string]bool{"web-a": true, "web-b": true}),
+	)
+	namePod(t, dialer, "web-a")
+	namePod(t, dialer, "web-b")
+
+	opts := forwardService("web", 80)
+	opts.Balance = mode
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if backends := conn.GetConnectionInfo().Backends; len(backends) != 2 {
+		t.Fatalf("backends = %v, want web-a and web-b", backends)
+	}
+	return conn
+}
+
+// greeting connects through conn and returns the client and the name of
+// the pod that answered
+func greeting(t *testing.T, conn *portforward.Connection) (net.Conn, string) {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", localAddr(conn), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	name := make([]byte, len("web-a"))
+	if _, err := io.ReadFull(c, name); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+	return c, string(name)
+}
+
+func TestBalanceRoundRobin(t *testing.T) {
+	conn := startBalancedForward(t, portforward.BalanceRoundRobin)
+
+	want := []string{"web-a", "web-b", "web-a", "web-b"}
+	for i, pod := range want {
+		c, got := greeting(t, conn)
+		c.Close()
+		if got != pod {
+			t.Errorf("client %d went to %s, want %s", i, got, pod)
+		}
+	}
+}
+
+func TestBalanceLeastConn(t *testing.T) {
+	conn := startBalancedForward(t, portforward.BalanceLeastConn)
+
+	// Hold a connection to web-a open; a short one goes to web-b
+	if _, got := greeting(t, conn); got != "web-a" {
+		t.Fatalf("first client went to %s, want web-a", got)
+	}
+	c, got := greeting(t, conn)
+	if got != "web-b" {
+		t.Fatalf("second client went to %s, want web-b", got)
+	}
+	c.Close()
+	waitFor(t, "closed client", func() bool { return conn.GetMetrics().OpenConns == 1 })
+
+	// Round-robin would pick web-a next, but web-b is idle
+	for i := 0; i < 2; i++ {
+		c, got := greeting(t, conn)
+		if got != "web-b" {
+			t.Errorf("client %d went to %s, want the idle web-b", i+3, got)
+		}
+		c.Close()
+		waitFor(t, "closed client", func() bool { return conn.GetMetrics().OpenConns == 1 })
+	}
+}
@@ -0,0 +1,97 @@
+package portforward
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// ClientFactory builds the API clients of a kube context (a context name from
+// the kubeconfig)
+type ClientFactory func(kubeContext string) (kubernetes.Interface, *rest.Config, error)
+
+// cluster is the API access of one kube context
+type cluster struct {
+	context    string // empty for the manager's default clients
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+}
+
+// clientPool holds the clients of every kube context in use. The default
+// context ("") is the one the manager was created with; others are built by
+// the factory on first use and kept for the life of the manager.
+type clientPool struct {
+	mu             sync.Mutex
+	clusters       map[string]*cluster
+	factory        ClientFactory
+	defaultContext string // name of the default clients' context, if known
+}
+
+func newClientPool(clientset kubernetes.Interface, restConfig *rest.Config) *clientPool {
+	return &clientPool{
+		clusters: map[string]*cluster{
+			"": {clientset: clientset, restConfig: restConfig},
+		},
+	}
+}
+
+// setFactory sets how clients of other contexts are built
+func (p *clientPool) setFactory(factory ClientFactory) {
+	p.mu.Lock()
+	p.factory = factory
+	p.mu.Unlock()
+}
+
+// setDefaultContext names the context of the default clients
+func (p *clientPool) setDefaultContext(name string) {
+	p.mu.Lock()
+	p.defaultContext = name
+	p.mu.Unlock()
+}
+
+// normalize returns "" for the default context's name, so that forwards
+// naming it share the default clients and IDs
+func (p *clientPool) normalize(kubeContext string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if kubeContext == p.defaultContext {
+		return ""
+	}
+	return kubeContext
+}
+
+// name returns the context name of kubeContext, the default one's for ""
+func (p *clientPool) name(kubeContext string) string {
+	if kubeContext != "" {
+		return kubeContext
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defaultContext
+}
+
+// get returns the clients of a kube context, building them if needed
+func (p *clientPool) get(kubeContext string) (*cluster, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.clusters[kubeContext]; ok {
+		return c, nil
+	}
+	if p.factory == nil {
+		return nil, fmt.Errorf("unknown kube context %q", kubeContext)
+	}
+
+	clientset, restConfig, err := p.factory(kubeContext)
+	if err != nil {
+		return nil, fmt.Errorf("kube context %q: %w", kubeContext, err)
+	}
+	c := &cluster{context: kubeContext, clientset: clientset, restConfig: restConfig}
+	p.clusters[kubeContext] = c
+	logger.Info("portforward", "Connected to kube context %s (%s)", kubeContext, restConfig.Host)
+	return c, nil
+}
@@ -0,0 +1,183 @@
+package portforward
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// EventType says what happened to a connection
+type EventType string
+
+const (
+	EventConnectionAdded EventType = "connection_added" // a connection was created, running or stopped
+	EventStatusChanged   EventType = "status_changed"   // OldStatus -> Status
+	EventLogAppended     EventType = "log_appended"     // Log was added to the connection's log
+	EventReconnecting    EventType = "reconnecting"     // a dropped tunnel is re-dialed after Delay
+	EventRemoved         EventType = "removed"          // the connection was deleted
+	EventMetricsTick     EventType = "metrics_tick"     // periodic traffic snapshot of a running connection
+)
+
+// MetricsTickInterval is how often subscribers get a MetricsTick per running connection
+const MetricsTickInterval = time.Second
+
+// eventBuffer is how many events a subscriber can fall behind before new
+// ones are dropped for it
+const eventBuffer = 256
+
+// Event is a change to a connection, delivered by Subscribe
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Connection ConnectionInfo // snapshot taken when the event happened
+
+	OldStatus Status        // StatusChanged: status before the change
+	Log       string        // LogAppended: the new log line
+	Attempt   int           // Reconnecting: attempt number, 0 for an immediate re-dial
+	Delay     time.Duration // Reconnecting: wait before the attempt
+	Err       string        // Reconnecting: why the tunnel dropped
+}
+
+// subscriber is one Subscribe call
+type subscriber struct {
+	ch      chan Event
+	dropped int
+}
+
+// eventHub fans events out to subscribers without ever blocking on them
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[*subscriber]struct{})}
+}
+
+// publish hands ev to every subscriber that has room for it
+func (h *eventHub) publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		h.send(sub, ev)
+	}
+}
+
+// send delivers ev to sub, or drops it if sub is too far behind. Callers
+// hold h.mu.
+func (h *eventHub) send(sub *subscriber, ev Event) {
+	select {
+	case sub.ch <- ev:
+		if sub.dropped > 0 {
+			logger.Warn("portforward", "Event subscriber caught up after %d dropped events", sub.dropped)
+			sub.dropped = 0
+		}
+	default:
+		sub.dropped++
+	}
+}
+
+// hasSubscribers reports whether events are worth building
+func (h *eventHub) hasSubscribers() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+// Subscribe returns a channel of connection events that is closed when ctx
+// ends. Events are never waited for: a subscriber that falls too far behind
+// misses events until it catches up, so it should re-read GetConnections if
+// it needs the full picture.
+func (m *Manager) Subscribe(ctx context.Context) <-chan Event {
+	sub := &subscriber{ch: make(chan Event, eventBuffer)}
+	m.events.mu.Lock()
+	m.events.subscribers[sub] = struct{}{}
+	m.events.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(MetricsTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, conn := range m.GetConnections() {
+					info := conn.GetConnectionInfo()
+					if !info.Status.IsRunning() {
+						continue
+					}
+					m.events.mu.Lock()
+					m.events.send(sub, Event{Type: EventMetricsTick, Time: time.Now(), Connection: info})
+					m.events.mu.Unlock()
+				}
+			case <-ctx.Done():
+				m.events.mu.Lock()
+				delete(m.events.subscribers, sub)
+				close(sub.ch)
+				m.events.mu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return sub.ch
+}
+
+// publishStatusChanges publishes a StatusChanged event for every connection
+// whose status differs from the last one published
+func (m *Manager) publishStatusChanges() {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	for _, conn := range m.GetConnections() {
+		info := conn.GetConnectionInfo()
+		old, seen := m.publishedStatus[conn.ID]
+		if !seen || old == info.Status {
+			// Unseen connections are announced by publishAdded
+			continue
+		}
+		m.publishedStatus[conn.ID] = info.Status
+		m.events.publish(Event{Type: EventStatusChanged, Connection: info, OldStatus: old})
+	}
+}
+
+// publishAdded publishes a ConnectionAdded event for a new connection
+func (m *Manager) publishAdded(conn *Connection) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	info := conn.GetConnectionInfo()
+	m.publishedStatus[conn.ID] = info.Status
+	m.events.publish(Event{Type: EventConnectionAdded, Connection: info})
+}
+
+// publishRemoved publishes a Removed event for a deleted connection
+func (m *Manager) publishRemoved(conn *Connection) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+
+	delete(m.publishedStatus, conn.ID)
+	m.events.publish(Event{Type: EventRemoved, Connection: conn.GetConnectionInfo()})
+}
+
+// publishReconnecting publishes a Reconnecting event for a dropped tunnel
+// that is dialed again after delay
+func (m *Manager) publishReconnecting(conn *Connection, attempt int, delay time.Duration, err error) {
+	ev := Event{Type: EventReconnecting, Connection: conn.GetConnectionInfo(), Attempt: attempt, Delay: delay}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	m.events.publish(ev)
+}
+
+// publishLog publishes a LogAppended event for a new line of c's log
+func (c *Connection) publishLog(line string) {
+	if c.manager == nil || !c.manager.events.hasSubscribers() {
+		return
+	}
+	c.manager.events.publish(Event{Type: EventLogAppended, Connection: c.GetConnectionInfo(), Log: line})
+}
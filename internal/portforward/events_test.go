@@ -0,0 +1,122 @@
+package portforward_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// nextEvent returns the next event of typ for connection id, skipping others
+func nextEvent(t *testing.T, events <-chan portforward.Event, typ portforward.EventType, id string) portforward.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed while waiting for %s", typ)
+			}
+			if ev.Type == typ && ev.Connection.ID == id {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", typ)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := m.Subscribe(ctx)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	added := nextEvent(t, events, portforward.EventConnectionAdded, conn.ID)
+	if added.Connection.Namespace != namespace || added.Connection.ResourceName != "web" {
+		t.Errorf("added snapshot = %+v", added.Connection)
+	}
+	if added.Connection.Status != portforward.StatusActive {
+		ev := nextEvent(t, events, portforward.EventStatusChanged, conn.ID)
+		if ev.Connection.Status != portforward.StatusActive {
+			t.Errorf("status = %s, want active", ev.Connection.Status)
+		}
+	}
+	if ev := nextEvent(t, events, portforward.EventLogAppended, conn.ID); ev.Log == "" {
+		t.Error("log event without a line")
+	}
+	tick := nextEvent(t, events, portforward.EventMetricsTick, conn.ID)
+	if !tick.Connection.Status.IsRunning() {
+		t.Errorf("metrics tick for a %s connection", tick.Connection.Status)
+	}
+
+	dialer.DropPod(namespace, "web")
+	if ev := nextEvent(t, events, portforward.EventReconnecting, conn.ID); ev.Err == "" {
+		t.Error("reconnecting event without a cause")
+	}
+
+	if err := m.StopPortForward(conn.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	for {
+		ev := nextEvent(t, events, portforward.EventStatusChanged, conn.ID)
+		if ev.Connection.Status == portforward.StatusStopped {
+			if !ev.OldStatus.IsRunning() {
+				t.Errorf("old status = %s, want a running one", ev.OldStatus)
+			}
+			break
+		}
+	}
+
+	if err := m.RemoveConnection(conn.ID); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	nextEvent(t, events, portforward.EventRemoved, conn.ID)
+
+	cancel()
+	waitFor(t, "the channel to close", func() bool {
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	})
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.Subscribe(ctx) // never read
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			conn.AddLog("noise")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on a subscriber that doesn't read")
+	}
+}
@@ -0,0 +1,319 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// Faults is a fault profile applied to the client connections of a forward,
+// for testing how clients cope with a bad network
+type Faults struct {
+	Latency   time.Duration `json:"latency,omitempty"`   // delay added to every chunk in both directions
+	Jitter    time.Duration `json:"jitter,omitempty"`    // random extra delay of up to this much per chunk
+	Bandwidth int64         `json:"bandwidth,omitempty"` // bytes per second in each direction of a client connection, 0 for no cap
+	Reset     float64       `json:"reset,omitempty"`     // probability per chunk that the client connection is reset
+	Drop      float64       `json:"drop,omitempty"`      // probability that a new client connection is closed right away
+	Stall     float64       `json:"stall,omitempty"`     // probability that a new client connection stays open but is never forwarded
+}
+
+// IsZero reports whether the profile injects no faults
+func (f Faults) IsZero() bool {
+	return f == Faults{}
+}
+
+// Validate checks that durations aren't negative and probabilities are in [0, 1]
+func (f Faults) Validate() error {
+	if f.Latency < 0 || f.Jitter < 0 {
+		return fmt.Errorf("latency and jitter can't be negative")
+	}
+	if f.Bandwidth < 0 {
+		return fmt.Errorf("bandwidth can't be negative")
+	}
+	for name, p := range map[string]float64{"reset": f.Reset, "drop": f.Drop, "stall": f.Stall} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("%s probability must be between 0 and 100%%", name)
+		}
+	}
+	if f.Drop+f.Stall > 1 {
+		return fmt.Errorf("drop and stall probabilities add up to more than 100%%")
+	}
+	return nil
+}
+
+// String describes the profile in the form ParseFaults reads, e.g.
+// "latency=200ms,jitter=50ms,bandwidth=64KB,drop=5%"
+func (f Faults) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency="+f.Latency.String())
+	}
+	if f.Jitter > 0 {
+		parts = append(parts, "jitter="+f.Jitter.String())
+	}
+	if f.Bandwidth > 0 {
+		parts = append(parts, "bandwidth="+FormatSize(f.Bandwidth))
+	}
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"reset", f.Reset}, {"drop", f.Drop}, {"stall", f.Stall}} {
+		if p.value > 0 {
+			parts = append(parts, p.name+"="+strconv.FormatFloat(p.value*100, 'g', 4, 64)+"%")
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseFaults parses a fault profile of comma-separated key=value pairs:
+// latency and jitter take durations, bandwidth a byte count per second
+// ("64KB", "1MB/s"), and reset, drop and stall a probability ("5%" or
+// "0.05"). An empty spec is a profile without faults.
+func ParseFaults(spec string) (Faults, error) {
+	var f Faults
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Faults{}, fmt.Errorf("invalid fault %q (want key=value)", item)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "latency":
+			f.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			f.Jitter, err = time.ParseDuration(value)
+		case "bandwidth":
+			f.Bandwidth, err = ParseBytes(strings.TrimSuffix(strings.ToLower(value), "/s"))
+		case "reset":
+			f.Reset, err = parseProbability(value)
+		case "drop":
+			f.Drop, err = parseProbability(value)
+		case "stall":
+			f.Stall, err = parseProbability(value)
+		default:
+			return Faults{}, fmt.Errorf("unknown fault %q (use latency, jitter, bandwidth, reset, drop or stall)", key)
+		}
+		if err != nil {
+			return Faults{}, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	return f, f.Validate()
+}
+
+// parseProbability parses "5%" or "0.05"
+func parseProbability(s string) (float64, error) {
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		return p / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// SetFaults replaces the fault profile of a connection; a zero profile
+// removes it. The change applies to open client connections too.
+func (m *Manager) SetFaults(id string, faults Faults) error {
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+	conn, err := m.connection(id)
+	if err != nil {
+		return err
+	}
+
+	conn.mu.Lock()
+	if faults.IsZero() {
+		conn.Faults = nil
+	} else {
+		conn.Faults = &faults
+	}
+	conn.mu.Unlock()
+
+	if faults.IsZero() {
+		conn.AddLog("↯ Fault injection off")
+		logger.Info("portforward", "Faults cleared: %s", id)
+	} else {
+		conn.AddLog(fmt.Sprintf("↯ Injecting faults: %s", faults))
+		logger.Info("portforward", "Faults for %s: %s", id, faults)
+	}
+	m.notifyChange()
+	return nil
+}
+
+// currentFaults returns the connection's fault profile, nil if there is none
+func (c *Connection) currentFaults() *Faults {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Faults
+}
+
+// admit applies the fault profile to a new client connection. It returns
+// nil if the client was dropped, which counts as an error, or is to be
+// stalled, in which case stalled is set and the caller must hand the client
+// to stall while it still holds it open. Otherwise it returns the client
+// wrapped so its chunks are delayed, paced and possibly reset.
+func (c *Connection) admit(client net.Conn) (admitted net.Conn, stalled bool) {
+	faults := c.currentFaults()
+	if faults == nil {
+		return client, false
+	}
+
+	switch r := rand.Float64(); {
+	case r < faults.Drop:
+		c.metrics.errors.Add(1)
+		c.AddLog(fmt.Sprintf("↯ Dropped connection from %s (fault)", client.RemoteAddr()))
+		client.Close()
+		return nil, false
+	case r < faults.Drop+faults.Stall:
+		c.AddLog(fmt.Sprintf("↯ Stalling connection from %s (fault)", client.RemoteAddr()))
+		return nil, true
+	}
+	return &faultyConn{Conn: client, conn: c}, false
+}
+
+// stallTimeout is how long a stalled client connection is held at most
+const stallTimeout = 10 * time.Minute
+
+// stall keeps a client connection open without forwarding or answering
+// anything, also after the client has finished sending, until the forward
+// is stopped or stallTimeout has passed. It returns once the client is
+// closed, so the client counts as open, and keeps a lazy tunnel from going
+// idle, while it lasts.
+func (c *Connection) stall(client net.Conn) {
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+	timer := time.NewTimer(stallTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.stopChan:
+	case <-timer.C:
+	}
+}
+
+// errFaultReset is returned for a client connection reset by a fault
+var errFaultReset = errors.New("connection reset by fault injection")
+
+// faultyConn applies the connection's current fault profile to every chunk
+// read from (client -> pod) or written to (pod -> client) a client
+type faultyConn struct {
+	net.Conn
+	conn  *Connection
+	read  pacer
+	write pacer
+}
+
+func (f *faultyConn) Read(p []byte) (int, error) {
+	faults := f.conn.currentFaults()
+	if faults != nil && faults.Bandwidth > 0 {
+		p = p[:min(len(p), chunkSize(faults.Bandwidth))]
+	}
+	n, err := f.Conn.Read(p)
+	if n > 0 && faults != nil {
+		if ferr := f.inject(faults, &f.read, n); ferr != nil {
+			return 0, ferr
+		}
+	}
+	return n, err
+}
+
+func (f *faultyConn) Write(p []byte) (int, error) {
+	faults := f.conn.currentFaults()
+	if faults == nil {
+		return f.Conn.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if faults.Bandwidth > 0 {
+			chunk = p[:min(len(p), chunkSize(faults.Bandwidth))]
+		}
+		if err := f.inject(faults, &f.write, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := f.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// inject resets the client connection or delays an n byte chunk
+func (f *faultyConn) inject(faults *Faults, pace *pacer, n int) error {
+	if faults.Reset > 0 && rand.Float64() < faults.Reset {
+		f.conn.AddLog(fmt.Sprintf("↯ Reset connection from %s (fault)", f.RemoteAddr()))
+		resetConn(f.Conn)
+		return errFaultReset
+	}
+	delay := faults.Latency
+	if faults.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(faults.Jitter) + 1))
+	}
+	if wait := pace.wait(n, faults.Bandwidth); wait > delay {
+		delay = wait
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return nil
+}
+
+// resetConn closes c with a TCP reset instead of a normal close where it can
+func resetConn(c net.Conn) {
+	for {
+		switch conn := c.(type) {
+		case interface{ SetLinger(int) error }:
+			conn.SetLinger(0)
+			c.Close()
+			return
+		case interface{ NetConn() net.Conn }:
+			c = conn.NetConn()
+		default:
+			c.Close()
+			return
+		}
+	}
+}
+
+// chunkSize is how much goes through at once under a bandwidth cap: a tenth
+// of a second's worth, so transfers are paced smoothly
+func chunkSize(bandwidth int64) int {
+	return int(max(bandwidth/10, 512))
+}
+
+// pacer spaces chunks out to a bandwidth cap
+type pacer struct {
+	mu   sync.Mutex
+	next time.Time // when the next chunk may go
+}
+
+// wait returns how long to wait before passing on n bytes at bandwidth
+// bytes per second
+func (p *pacer) wait(n int, bandwidth int64) time.Duration {
+	if bandwidth <= 0 {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	start := p.next
+	p.next = p.next.Add(time.Duration(float64(n) / float64(bandwidth) * float64(time.Second)))
+	return start.Sub(now)
+}
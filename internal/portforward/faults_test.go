@@ -0,0 +1,158 @@
+package portforward_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+func TestParseFaults(t *testing.T) {
+	f, err := portforward.ParseFaults("latency=200ms, jitter=50ms,bandwidth=64KB/s,reset=1%,drop=0.05,stall=2.5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := portforward.Faults{Latency: 200 * time.Millisecond, Jitter: 50 * time.Millisecond, Bandwidth: 64 << 10, Reset: 0.01, Drop: 0.05, Stall: 0.025}
+	if f != want {
+		t.Errorf("ParseFaults = %+v, want %+v", f, want)
+	}
+	if again, err := portforward.ParseFaults(f.String()); err != nil || again != f {
+		t.Errorf("ParseFaults(%q) = %+v, %v", f.String(), again, err)
+	}
+	if f, err := portforward.ParseFaults(""); err != nil || !f.IsZero() {
+		t.Errorf("empty spec = %+v, %v", f, err)
+	}
+
+	for _, bad := range []string{"latency", "latency=fast", "loss=5%", "drop=150%", "reset=-1", "drop=60%,stall=60%", "bandwidth=lots"} {
+		if _, err := portforward.ParseFaults(bad); err == nil {
+			t.Errorf("ParseFaults(%q): expected an error", bad)
+		}
+	}
+}
+
+// exchange sends msg through the forward and returns what came back before
+// the connection ended or failed
+func exchange(addr, msg string, timeout time.Duration) (string, error) {
+	c, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(timeout))
+	if _, err := io.WriteString(c, msg); err != nil {
+		return "", err
+	}
+	c.(*net.TCPConn).CloseWrite()
+	got, err := io.ReadAll(c)
+	return string(got), err
+}
+
+// withFaults sets the fault profile of a forward started by startEchoForward
+func withFaults(faults portforward.Faults) func(*portforward.ForwardOptions) {
+	return func(opts *portforward.ForwardOptions) { opts.Faults = &faults }
+}
+
+func TestFaultLatencyAndBandwidth(t *testing.T) {
+	_, conn := startEchoForward(t, withFaults(portforward.Faults{Latency: 100 * time.Millisecond}))
+	start := time.Now()
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("round trip took %s, want at least 200ms", elapsed)
+	}
+
+	// 32 KB each way at 64 KB/s take half a second
+	m, conn := startEchoForward(t, withFaults(portforward.Faults{Bandwidth: 64 << 10}))
+	msg := strings.Repeat("x", 32<<10)
+	start = time.Now()
+	if got := roundTrip(t, localAddr(conn), msg); got != msg {
+		t.Errorf("got %d bytes", len(got))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("capped transfer took %s", elapsed)
+	}
+
+	// Removing the profile lifts the cap: 512 KB each way would take 16s
+	// capped, so anything well below that can't have been paced
+	if err := m.SetFaults(conn.ID, portforward.Faults{}); err != nil {
+		t.Fatal(err)
+	}
+	if conn.GetConnectionInfo().Faults != nil {
+		t.Error("faults still reported after clearing")
+	}
+	msg = strings.Repeat("x", 512<<10)
+	start = time.Now()
+	if got := roundTrip(t, localAddr(conn), msg); got != msg {
+		t.Errorf("got %d bytes", len(got))
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("uncapped transfer took %s", elapsed)
+	}
+}
+
+func TestFaultDropAndReset(t *testing.T) {
+	m, conn := startEchoForward(t, withFaults(portforward.Faults{Drop: 1}))
+	if got, _ := exchange(localAddr(conn), "hello", 2*time.Second); got != "" {
+		t.Errorf("dropped connection answered %q", got)
+	}
+	if errs := conn.GetMetrics().Errors; errs != 1 {
+		t.Errorf("errors after a drop = %d, want 1", errs)
+	}
+
+	if err := m.SetFaults(conn.ID, portforward.Faults{Reset: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := exchange(localAddr(conn), "hello", 2*time.Second); got != "" {
+		t.Errorf("reset connection answered %q", got)
+	}
+
+	logs := strings.Join(conn.GetLogs(), "\n")
+	for _, want := range []string{"Dropped connection", "Reset connection", "Injecting faults: reset=100%"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+
+	if err := m.SetFaults(conn.ID, portforward.Faults{Drop: 2}); err == nil {
+		t.Error("invalid profile: expected an error")
+	}
+	if err := m.SetFaults("missing", portforward.Faults{}); err == nil {
+		t.Error("unknown connection: expected an error")
+	}
+}
+
+func TestFaultStall(t *testing.T) {
+	m, conn := startEchoForward(t, withFaults(portforward.Faults{Stall: 1}))
+	if info := conn.GetConnectionInfo(); info.Faults == nil || info.Faults.Stall != 1 {
+		t.Fatalf("faults = %+v", info.Faults)
+	}
+
+	// A stalled connection stays open without an answer
+	_, err := exchange(localAddr(conn), "hello", 300*time.Millisecond)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("stalled read: %v, want a timeout", err)
+	}
+
+	// ... until the forward is stopped
+	c, err := net.Dial("tcp", localAddr(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// Both stalled connections are held, and count as open
+	waitFor(t, "stall", func() bool { return strings.Count(strings.Join(conn.GetLogs(), "\n"), "Stalling connection") == 2 })
+	if open := conn.GetMetrics().OpenConns; open != 2 {
+		t.Errorf("open connections while stalled = %d, want 2", open)
+	}
+	m.StopPortForward(conn.ID)
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("stalled connection still open after stop")
+	}
+}
@@ -0,0 +1,220 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// DefaultIdleTimeout is how long a lazy tunnel stays open without any traffic
+const DefaultIdleTimeout = 5 * time.Minute
+
+// acceptedClient is a local client connection of a lazy forward
+type acceptedClient struct {
+	net.Conn
+	mapping int
+}
+
+// lazyDial is the outcome of opening a lazy forward's tunnel
+type lazyDial struct {
+	tunnel   *tunnel
+	selector string // label selector of the pod's owner, empty for a plain pod
+	err      error
+}
+
+// dialLazy resolves the lazy forward's pod and opens a tunnel to it in the
+// background. The result arrives on the returned channel.
+func (m *Manager) dialLazy(ctx context.Context, conn *Connection) <-chan lazyDial {
+	dialed := make(chan lazyDial, 1)
+	go func() {
+		pod, ports, selector, err := m.resolveTarget(ctx, conn, conn.portMappings())
+		if err != nil {
+			dialed <- lazyDial{err: err}
+			return
+		}
+		t, err := m.dialTunnel(ctx, conn.cluster, conn.Namespace, pod, ports)
+		dialed <- lazyDial{tunnel: t, selector: selector, err: err}
+	}()
+	return dialed
+}
+
+// runLazyPortForward keeps the local listeners of a lazy forward open but
+// only dials a tunnel once a client connects, and closes it again after the
+// connection's IdleTimeout without traffic. Like runPortForward it returns
+// once the forward ends.
+func (m *Manager) runLazyPortForward(ctx context.Context, conn *Connection) (established bool, err error) {
+	listeners, err := openListeners(conn)
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Error("portforward", "Listen failed for %s: %v", conn.ID, err)
+		return false, err
+	}
+	defer closeListeners(listeners)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	clients := make(chan acceptedClient)
+	acceptErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l localListener) {
+			for {
+				client, err := l.Accept()
+				if err != nil {
+					acceptErr <- err
+					return
+				}
+				select {
+				case clients <- acceptedClient{Conn: client, mapping: l.mapping}:
+				case <-done:
+					client.Close()
+					return
+				}
+			}
+		}(l)
+	}
+
+	var t *tunnel
+	var tunnelClosed <-chan bool
+	var failover <-chan string
+	cancelWatch := func() {}
+
+	// Clients that connect while the tunnel is being dialed wait for that
+	// one attempt
+	var waiting []acceptedClient
+	var dialed <-chan lazyDial
+	cancelDial := func() {}
+	closeTunnel := func(msg string) {
+		cancelWatch()
+		t.Close()
+		t, tunnelClosed, failover = nil, nil, nil
+		conn.mu.Lock()
+		if conn.Status != StatusStopped {
+			conn.Status = StatusListening
+		}
+		conn.mu.Unlock()
+		conn.AddLog(msg)
+		m.notifyChange()
+	}
+	defer func() {
+		cancelWatch()
+		if t != nil {
+			t.Close()
+		}
+		cancelDial()
+		if dialed != nil {
+			// A tunnel that opened just as the forward ended isn't used
+			go func(dialed <-chan lazyDial) {
+				if d := <-dialed; d.tunnel != nil {
+					d.tunnel.Close()
+				}
+			}(dialed)
+		}
+		for _, client := range waiting {
+			client.Close()
+		}
+	}()
+
+	established = true
+	conn.mu.Lock()
+	conn.Status = StatusListening
+	conn.Error = ""
+	conn.mu.Unlock()
+	for _, l := range listeners {
+		conn.AddLog(fmt.Sprintf("✓ Listening on %s, tunnel opens on the first connection", l.Addr()))
+	}
+	logger.Info("portforward", "Lazy forward listening: %s", conn.ID)
+	conn.markReady()
+	m.notifyChange()
+
+	// Idle tunnels are looked for once a second
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case client := <-clients:
+			if t != nil {
+				go conn.serveClient(client.Conn, t, client.mapping)
+				continue
+			}
+			waiting = append(waiting, client)
+			if dialed == nil {
+				dialCtx, cancel := context.WithCancel(ctx)
+				cancelDial = cancel
+				dialed = m.dialLazy(dialCtx, conn)
+			}
+
+		case d := <-dialed:
+			cancelDial()
+			dialed, cancelDial = nil, func() {}
+			queued := waiting
+			waiting = nil
+			if d.err != nil {
+				for _, client := range queued {
+					conn.metrics.refused()
+					client.Close()
+				}
+				conn.mu.Lock()
+				conn.Error = d.err.Error()
+				conn.mu.Unlock()
+				conn.AddLog(fmt.Sprintf("✗ Failed to open tunnel, refusing %d client(s): %v", len(queued), d.err))
+				logger.Error("portforward", "On-demand tunnel for %s failed: %v", conn.ID, d.err)
+				m.notifyChange()
+				continue
+			}
+
+			t = d.tunnel
+			tunnelClosed = t.closed()
+			if d.selector != "" {
+				// Follow the pod so the next client goes to its replacement
+				watchCtx, cancel := context.WithCancel(ctx)
+				cancelWatch = cancel
+				failover = m.watchPod(watchCtx, conn.cluster, conn.Namespace, d.selector, t.pod)
+			}
+			conn.mu.Lock()
+			conn.Status = StatusActive
+			conn.Error = ""
+			conn.PodName = t.pod
+			conn.mu.Unlock()
+			conn.AddLog(fmt.Sprintf("⚡ Opened tunnel to pod %s %v over %s", t.pod, t.ports, t.transport))
+			logger.Info("portforward", "On-demand tunnel opened: %s -> %s", conn.ID, t.pod)
+			m.notifyChange()
+			for _, client := range queued {
+				go conn.serveClient(client.Conn, t, client.mapping)
+			}
+
+		case <-ticker.C:
+			if t == nil || conn.metrics.open.Load() > 0 {
+				continue
+			}
+			if idle := time.Since(conn.GetMetrics().LastActivity); idle >= conn.IdleTimeout {
+				closeTunnel(fmt.Sprintf("☾ Closed tunnel to %s after %s idle", t.pod, conn.IdleTimeout))
+				logger.Info("portforward", "Idle tunnel closed: %s", conn.ID)
+			}
+
+		case <-tunnelClosed:
+			closeTunnel(fmt.Sprintf("⚠ Tunnel to %s dropped, reopening on the next connection", t.pod))
+
+		case reason := <-failover:
+			closeTunnel(fmt.Sprintf("⇄ Pod %s %s, the next connection goes to another pod", t.pod, reason))
+
+		case err := <-acceptErr:
+			conn.AddLog(fmt.Sprintf("✗ Listener error: %v", err))
+			logger.Error("portforward", "Listener error: %s - %v", conn.ID, err)
+			return true, err
+
+		case <-conn.stopChan:
+			conn.AddLog("Stop signal received")
+			logger.Debug("portforward", "Stop signal received for: %s", conn.ID)
+			return true, nil
+
+		case <-ctx.Done():
+			conn.AddLog("Shutting down...")
+			return true, nil
+		}
+	}
+}
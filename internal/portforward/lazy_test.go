@@ -0,0 +1,145 @@
+package portforward_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+// startLazyForward starts a lazy forward to an echo pod that closes its
+// tunnel after idle
+func startLazyForward(t *testing.T, idle time.Duration) (*portforward.Manager, *portforwardtest.Dialer, *portforward.Connection) {
+	t.Helper()
+	m, dialer := newTestManager(t, runningPod("db-0", nil))
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	opts := forwardPod("db-0", 5432)
+	opts.Lazy = true
+	opts.IdleTimeout = idle
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return m, dialer, conn
+}
+
+func TestLazyOpensOnFirstClient(t *testing.T) {
+	_, dialer, conn := startLazyForward(t, time.Minute)
+	if info := conn.GetConnectionInfo(); info.Status != portforward.StatusListening {
+		t.Errorf("status = %s, want listening", info.Status)
+	}
+	if n := dialer.Dials(namespace, "db-0"); n != 0 {
+		t.Fatalf("dialed %d tunnels before any client", n)
+	}
+
+	// The first client opens the tunnel, later ones reuse it
+	for i := 0; i < 3; i++ {
+		if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+			t.Errorf("client %d: got %q", i, got)
+		}
+	}
+	if n := dialer.Dials(namespace, "db-0"); n != 1 {
+		t.Errorf("dials = %d, want 1", n)
+	}
+	if info := conn.GetConnectionInfo(); info.Status != portforward.StatusActive || info.PodName != "db-0" {
+		t.Errorf("status = %s on pod %q, want active on db-0", info.Status, info.PodName)
+	}
+}
+
+func TestLazyClosesIdleTunnel(t *testing.T) {
+	_, dialer, conn := startLazyForward(t, 100*time.Millisecond)
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+
+	// Idle tunnels are looked for once a second
+	waitFor(t, "idle teardown", func() bool { return conn.GetConnectionInfo().Status == portforward.StatusListening })
+	if logs := strings.Join(conn.GetLogs(), "\n"); !strings.Contains(logs, "Closed tunnel to db-0 after 100ms idle") {
+		t.Errorf("logs lack the teardown:\n%s", logs)
+	}
+
+	// The local port stays open and the next client dials again
+	if got := roundTrip(t, localAddr(conn), "again"); got != "again" {
+		t.Errorf("got %q", got)
+	}
+	if n := dialer.Dials(namespace, "db-0"); n != 2 {
+		t.Errorf("dials = %d, want 2", n)
+	}
+}
+
+func TestLazyClientsShareOneDial(t *testing.T) {
+	_, dialer, conn := startLazyForward(t, time.Minute)
+	release := dialer.BlockPod(namespace, "db-0")
+	defer release()
+	dialer.FailPod(namespace, "db-0", errors.New("pod is gone"))
+
+	var clients []net.Conn
+	for i := 0; i < 3; i++ {
+		c, err := net.DialTimeout("tcp", localAddr(conn), 2*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	waitFor(t, "dial", func() bool { return dialer.Dials(namespace, "db-0") == 1 })
+	time.Sleep(100 * time.Millisecond)
+	release()
+
+	// The one failed attempt answers every waiting client
+	for i, c := range clients {
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("client %d: read = %v, want EOF", i, err)
+		}
+	}
+	if n := dialer.Dials(namespace, "db-0"); n != 1 {
+		t.Errorf("dials = %d, want 1", n)
+	}
+	if logs := strings.Join(conn.GetLogs(), "\n"); !strings.Contains(logs, "refusing 3 client(s)") {
+		t.Errorf("logs lack the refusal:\n%s", logs)
+	}
+
+	// The next client dials again
+	dialer.FailPod(namespace, "db-0", nil)
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLazyStopDuringDial(t *testing.T) {
+	m, dialer, conn := startLazyForward(t, time.Minute)
+	release := dialer.BlockPod(namespace, "db-0")
+	defer release()
+
+	client, err := net.DialTimeout("tcp", localAddr(conn), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	waitFor(t, "dial", func() bool { return dialer.Dials(namespace, "db-0") == 1 })
+
+	// Stopping doesn't wait for the hanging dial
+	if err := m.StopPortForward(conn.ID); err != nil {
+		t.Fatal(err)
+	}
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("waiting client: read = %v, want EOF", err)
+	}
+	waitFor(t, "closed listener", func() bool {
+		c, err := net.Dial("tcp", localAddr(conn))
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	})
+}
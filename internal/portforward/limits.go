@@ -0,0 +1,183 @@
+package portforward
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Limits caps what the clients of a forward may use, to protect the pod
+// behind it. Zero fields are unlimited.
+type Limits struct {
+	MaxConns int   `json:"max_conns,omitempty"` // client connections open at once
+	Upload   int64 `json:"upload,omitempty"`    // bytes per second from all clients to the pod
+	Download int64 `json:"download,omitempty"`  // bytes per second from the pod to all clients
+	Budget   int64 `json:"budget,omitempty"`    // bytes in both directions until the forward is started again
+}
+
+// ParseLimits builds limits from a connection count and byte sizes such as
+// "1MB" (see ParseBytes); empty sizes are unlimited
+func ParseLimits(maxConns int, upload, download, budget string) (Limits, error) {
+	limits := Limits{MaxConns: maxConns}
+	for _, size := range []struct {
+		name  string
+		value string
+		dst   *int64
+	}{{"upload", upload, &limits.Upload}, {"download", download, &limits.Download}, {"budget", budget, &limits.Budget}} {
+		if size.value == "" {
+			continue
+		}
+		n, err := ParseBytes(strings.TrimSuffix(strings.ToLower(size.value), "/s"))
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid %s limit: %w", size.name, err)
+		}
+		*size.dst = n
+	}
+	return limits, limits.Validate()
+}
+
+// IsZero reports whether nothing is limited
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Validate checks that no limit is negative
+func (l Limits) Validate() error {
+	if l.MaxConns < 0 || l.Upload < 0 || l.Download < 0 || l.Budget < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	return nil
+}
+
+// String describes the limits, e.g. "10 connections, ↑1MB/s, budget 5GB"
+func (l Limits) String() string {
+	var parts []string
+	if l.MaxConns > 0 {
+		parts = append(parts, fmt.Sprintf("%d connections", l.MaxConns))
+	}
+	if l.Upload > 0 {
+		parts = append(parts, "↑"+FormatSize(l.Upload)+"/s")
+	}
+	if l.Download > 0 {
+		parts = append(parts, "↓"+FormatSize(l.Download)+"/s")
+	}
+	if l.Budget > 0 {
+		parts = append(parts, "budget "+FormatSize(l.Budget))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// limiter enforces a connection's limits
+type limiter struct {
+	limits    Limits
+	conns     atomic.Int64 // client connections holding a slot
+	up        pacer
+	down      pacer
+	exhausted atomic.Bool // the budget ran out and that was logged
+}
+
+func newLimiter(limits *Limits) *limiter {
+	if limits == nil {
+		return nil
+	}
+	return &limiter{limits: *limits}
+}
+
+// budgetUsed reports whether the connection has used up its data budget
+func (c *Connection) budgetUsed() bool {
+	l := c.limiter
+	if l.limits.Budget == 0 || c.metrics.bytesSent.Load()+c.metrics.bytesReceived.Load() < l.limits.Budget {
+		return false
+	}
+	if l.exhausted.CompareAndSwap(false, true) {
+		c.AddLog(fmt.Sprintf("⛔ Data budget of %s used up, refusing client connections", FormatBytes(l.limits.Budget)))
+	}
+	return true
+}
+
+// acquire admits a new client connection within the connection's limits.
+// A client over a limit is closed, logged with the reason and counted as an
+// error; otherwise release must be called once the client is done.
+func (c *Connection) acquire(client net.Conn) (release func(), ok bool) {
+	l := c.limiter
+	if l == nil {
+		return func() {}, true
+	}
+
+	var reason string
+	if c.budgetUsed() {
+		reason = fmt.Sprintf("data budget of %s used up", FormatBytes(l.limits.Budget))
+	} else if n := l.conns.Add(1); l.limits.MaxConns > 0 && n > int64(l.limits.MaxConns) {
+		l.conns.Add(-1)
+		reason = fmt.Sprintf("%d connections open (limit %d)", n-1, l.limits.MaxConns)
+	} else {
+		return func() { l.conns.Add(-1) }, true
+	}
+
+	c.metrics.errors.Add(1)
+	c.AddLog(fmt.Sprintf("⛔ Refused connection from %s: %s", client.RemoteAddr(), reason))
+	client.Close()
+	return nil, false
+}
+
+// limit wraps client so its traffic is paced to the connection's rate
+// limits and stops when the data budget is used up
+func (c *Connection) limit(client net.Conn) net.Conn {
+	l := c.limiter
+	if l == nil || (l.limits.Upload == 0 && l.limits.Download == 0 && l.limits.Budget == 0) {
+		return client
+	}
+	return &limitedConn{Conn: client, conn: c}
+}
+
+// errBudgetUsed is returned for client connections cut off by the data budget
+var errBudgetUsed = errors.New("data budget used up")
+
+// limitedConn applies a connection's rate limits and data budget to the
+// chunks read from (client -> pod) or written to (pod -> client) a client
+type limitedConn struct {
+	net.Conn
+	conn *Connection
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	l := c.conn.limiter
+	if c.conn.budgetUsed() {
+		c.Conn.Close()
+		return 0, errBudgetUsed
+	}
+	if l.limits.Upload > 0 {
+		p = p[:min(len(p), chunkSize(l.limits.Upload))]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		time.Sleep(l.up.wait(n, l.limits.Upload))
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	l := c.conn.limiter
+	written := 0
+	for len(p) > 0 {
+		if c.conn.budgetUsed() {
+			c.Conn.Close()
+			return written, errBudgetUsed
+		}
+		chunk := p
+		if l.limits.Download > 0 {
+			chunk = p[:min(len(p), chunkSize(l.limits.Download))]
+		}
+		time.Sleep(l.down.wait(len(chunk), l.limits.Download))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
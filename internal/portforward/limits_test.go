@@ -0,0 +1,138 @@
+package portforward_test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+func TestParseLimits(t *testing.T) {
+	l, err := portforward.ParseLimits(10, "1MB/s", "512KB", "5GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := portforward.Limits{MaxConns: 10, Upload: 1 << 20, Download: 512 << 10, Budget: 5 << 30}
+	if l != want {
+		t.Errorf("ParseLimits = %+v, want %+v", l, want)
+	}
+	if s := l.String(); s != "10 connections, ↑1MB/s, ↓512KB/s, budget 5GB" {
+		t.Errorf("String = %q", s)
+	}
+	if l, err := portforward.ParseLimits(0, "", "", ""); err != nil || !l.IsZero() {
+		t.Errorf("no limits = %+v, %v", l, err)
+	}
+
+	for _, bad := range []struct {
+		maxConns int
+		upload   string
+		budget   string
+	}{{-1, "", ""}, {0, "fast", ""}, {0, "", "-5MB"}} {
+		if _, err := portforward.ParseLimits(bad.maxConns, bad.upload, "", bad.budget); err == nil {
+			t.Errorf("ParseLimits(%+v): expected an error", bad)
+		}
+	}
+}
+
+// withLimits sets the limits of a forward started by startEchoForward
+func withLimits(limits portforward.Limits) func(*portforward.ForwardOptions) {
+	return func(opts *portforward.ForwardOptions) { opts.Limits = &limits }
+}
+
+func TestLimitMaxConns(t *testing.T) {
+	_, conn := startEchoForward(t, withLimits(portforward.Limits{MaxConns: 1}))
+	if info := conn.GetConnectionInfo(); info.Limits == nil || info.Limits.MaxConns != 1 {
+		t.Fatalf("limits = %+v", info.Limits)
+	}
+
+	// Hold the only slot with an open client
+	first, err := net.Dial("tcp", localAddr(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(first, "a")
+	if _, err := io.ReadFull(first, make([]byte, 1)); err != nil {
+		t.Fatalf("first client: %v", err)
+	}
+
+	if got, _ := exchange(localAddr(conn), "hello", 2*time.Second); got != "" {
+		t.Errorf("client over the limit answered %q", got)
+	}
+	logs := strings.Join(conn.GetLogs(), "\n")
+	if !strings.Contains(logs, "Refused connection") || !strings.Contains(logs, "limit 1") {
+		t.Errorf("logs lack the refusal:\n%s", logs)
+	}
+	if errs := conn.GetMetrics().Errors; errs != 1 {
+		t.Errorf("errors = %d, want 1", errs)
+	}
+
+	// Closing the first client frees its slot
+	first.Close()
+	waitFor(t, "free slot", func() bool { return conn.GetMetrics().OpenConns == 0 })
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestLimitBandwidth(t *testing.T) {
+	// 64 KB at 64 KB/s take a second, whichever direction is capped. Only
+	// the lower bound is checked, as a loaded machine is slower, not faster.
+	msg := strings.Repeat("x", 64<<10)
+	for _, limits := range []portforward.Limits{{Upload: 64 << 10}, {Download: 64 << 10}} {
+		_, conn := startEchoForward(t, withLimits(limits))
+		start := time.Now()
+		if got := roundTrip(t, localAddr(conn), msg); got != msg {
+			t.Errorf("%s: got %d bytes", limits, len(got))
+		}
+		if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+			t.Errorf("%s: transfer took %s", limits, elapsed)
+		}
+	}
+}
+
+func TestLimitBudget(t *testing.T) {
+	_, conn := startEchoForward(t, withLimits(portforward.Limits{Budget: 1 << 10}))
+
+	// The client that uses up the budget is cut off...
+	got, _ := exchange(localAddr(conn), strings.Repeat("x", 2<<10), 2*time.Second)
+	if len(got) >= 2<<10 {
+		t.Errorf("got the whole answer past the budget")
+	}
+
+	// ... and later ones are refused
+	if got, _ := exchange(localAddr(conn), "hello", 2*time.Second); got != "" {
+		t.Errorf("client past the budget answered %q", got)
+	}
+	logs := strings.Join(conn.GetLogs(), "\n")
+	for _, want := range []string{"Data budget of 1.0 KB used up", "Refused connection", "Limits: budget 1KB"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestProbesBypassLimits(t *testing.T) {
+	// The echo pod answers an HTTP probe with its own request, so every
+	// probe fails after sending and receiving a few hundred bytes
+	_, conn := startEchoForward(t, func(opts *portforward.ForwardOptions) {
+		opts.Limits = &portforward.Limits{MaxConns: 1, Budget: 1 << 10}
+		opts.Probe = &portforward.Probe{
+			Type:             portforward.ProbeHTTP,
+			Interval:         10 * time.Millisecond,
+			Timeout:          time.Second,
+			FailureThreshold: 1000,
+		}
+	})
+	waitFor(t, "probes", func() bool { return conn.GetConnectionInfo().ProbeFailures >= 10 })
+
+	if m := conn.GetMetrics(); m.TotalConns != 0 || m.BytesSent != 0 || m.BytesReceived != 0 {
+		t.Errorf("probes show up in the metrics: %+v", m)
+	}
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q after the probes", got)
+	}
+}
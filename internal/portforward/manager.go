@@ -1,23 +1,24 @@
 package portforward
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"net"
+	"os"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 
+	"github.com/pyqan/portFwd/internal/k8s"
 	"github.com/pyqan/portFwd/internal/logger"
 )
 
@@ -36,24 +37,59 @@ const (
 	StatusError        Status = "error"
 	StatusStarting     Status = "starting"
 	StatusReconnecting Status = "reconnecting"
+	StatusDegraded     Status = "degraded"  // tunnel is up but health probes fail
+	StatusListening    Status = "listening" // lazy forward waiting for a client, no tunnel open
 )
 
+// IsRunning reports whether a connection in this status is being forwarded
+// (or about to be) and has to be stopped before it can be removed
+func (s Status) IsRunning() bool {
+	switch s {
+	case StatusActive, StatusStarting, StatusReconnecting, StatusDegraded, StatusListening:
+		return true
+	}
+	return false
+}
+
 // ResourceType for port-forward target
 type ResourceType string
 
 const (
-	ResourcePod     ResourceType = "pod"
-	ResourceService ResourceType = "service"
+	ResourcePod         ResourceType = "pod"
+	ResourceService     ResourceType = "service"
+	ResourceDeployment  ResourceType = "deployment"
+	ResourceStatefulSet ResourceType = "statefulset"
+	ResourceReplicaSet  ResourceType = "replicaset"
+	ResourceDaemonSet   ResourceType = "daemonset"
+	ResourceJob         ResourceType = "job"
+	ResourceRouter      ResourceType = "router" // HTTP routes to other resources on one local port
 )
 
 // Connection represents a single port-forward connection
 type Connection struct {
 	ID             string
+	Context        string // kube context, empty for the manager's default
 	Namespace      string
 	ResourceType   ResourceType
-	ResourceName   string // pod name or service name
+	ResourceName   string // pod, service or workload name
+	PodName        string // pod backing the current tunnel
 	LocalPort      int
 	RemotePort     int
+	Ports          []PortMapping // all forwarded ports; LocalPort/RemotePort mirror the first
+	Addresses      []string      // local bind addresses
+	SocketPath     string        // listen on this Unix socket instead of TCP ports
+	SocketMode     os.FileMode   // permissions of the socket file
+	Balance        BalanceMode   // service forwards only
+	Backends       []string      // pods with a live tunnel when balancing
+	Probe          *Probe        // optional health check
+	ProbeFailures  int           // probe failures in a row
+	ProbeError     string        // error of the last failed probe
+	Lazy           bool          // open the tunnel on the first client, close it when idle
+	IdleTimeout    time.Duration // lazy forwards only
+	Routes         []Route       // routers only
+	TLS            *TLSOptions   // optional TLS termination or origination
+	Faults         *Faults       // injected network faults, nil for none
+	Limits         *Limits       // client connection, rate and data limits, nil for none
 	Status         Status
 	Error          string
 	StartedAt      time.Time
@@ -64,50 +100,145 @@ type Connection struct {
 
 	stopChan   chan struct{}
 	readyChan  chan struct{}
+	readyOnce  sync.Once
 	stopOnce   sync.Once
 	cancelFunc context.CancelFunc
 	manager    *Manager
+	cluster    *cluster        // API clients of Context, set when started
+	tlsConfig  *tls.Config     // built from TLS when started
+	recorder   *recording      // traffic recording, nil when off
+	limiter    *limiter        // enforces Limits, nil without limits
+	reserved   []localListener // automatic ports bound when allocated, until the first tunnel serves them
+	probes     chan net.Conn   // probe connections for the tunnel that's up, see dialProbe
+	metrics    connMetrics
 	mu         sync.RWMutex
 }
 
+// ForwardOptions describes a port-forward to start
+type ForwardOptions struct {
+	Context      string // kube context, empty for the manager's default
+	Namespace    string
+	ResourceType ResourceType
+	ResourceName string
+	LocalPort    int
+	RemotePort   int
+	Ports        []PortMapping // all port mappings; if empty LocalPort/RemotePort is the only one
+	PortRange    PortRange     // where automatic (0) local ports are picked from; any free port if zero
+	Addresses    []string      // local bind addresses, DefaultAddresses if empty
+	SocketPath   string        // listen on a Unix socket instead; needs exactly one port mapping
+	SocketMode   os.FileMode   // socket file permissions, DefaultSocketMode if 0
+	Balance      BalanceMode   // spread client connections over all ready pods of a service
+	Probe        *Probe        // health check run through the local endpoint
+	Lazy         bool          // only listen until a client connects, close the tunnel again when idle
+	IdleTimeout  time.Duration // idle time before a lazy tunnel is closed, DefaultIdleTimeout if 0
+	Routes       []Route       // HTTP routes of a router (ResourceRouter)
+	TLS          *TLSOptions   // terminate TLS on the local endpoint or originate it toward the pod
+	Faults       *Faults       // network faults injected into client connections
+	Limits       *Limits       // caps on client connections, rates and data
+}
+
+// PortMappings returns all port mappings of opts
+func (o ForwardOptions) PortMappings() []PortMapping {
+	if len(o.Ports) > 0 {
+		return append([]PortMapping(nil), o.Ports...)
+	}
+	return []PortMapping{{Local: o.LocalPort, Remote: o.RemotePort}}
+}
+
+// ConnectionID returns the ID of the connection started with opts. Forwards
+// in a kube context other than the default end in "@context".
+func ConnectionID(opts ForwardOptions) string {
+	ports := FormatPortMappings(opts.PortMappings())
+	if opts.SocketPath != "" {
+		ports = opts.SocketPath + "->" + opts.PortMappings()[0].RemoteString()
+	}
+	id := fmt.Sprintf("%s/%s/%s:%s", opts.Namespace, opts.ResourceType.ShortName(), opts.ResourceName, ports)
+	if opts.Context != "" {
+		id += "@" + opts.Context
+	}
+	return id
+}
+
 // Manager manages multiple port-forward connections
 type Manager struct {
-	connections map[string]*Connection
-	clientset   *kubernetes.Clientset
-	restConfig  *rest.Config
-	mu          sync.RWMutex
-	onChange    func()
+	connections     map[string]*Connection
+	clients         *clientPool
+	reconnectPolicy ReconnectPolicy
+	transport       TransportMode
+	dialer          TunnelDialer // replaces the API dialers if set
+	tlsDir          string       // local CA and generated certificates, DefaultTLSDir if empty
+	recordingsDir   string       // traffic recordings, DefaultRecordingsDir if empty
+	mu              sync.RWMutex
+	events          *eventHub
+	statusMu        sync.Mutex        // serializes status change events
+	publishedStatus map[string]Status // last status published per connection ID
 }
 
-// NewManager creates a new port-forward manager
-func NewManager(clientset *kubernetes.Clientset, restConfig *rest.Config) *Manager {
+// NewManager creates a new port-forward manager. Forwards without a kube
+// context use clientset and restConfig.
+func NewManager(clientset kubernetes.Interface, restConfig *rest.Config) *Manager {
 	return &Manager{
-		connections: make(map[string]*Connection),
-		clientset:   clientset,
-		restConfig:  restConfig,
+		connections:     make(map[string]*Connection),
+		clients:         newClientPool(clientset, restConfig),
+		reconnectPolicy: DefaultReconnectPolicy(),
+		transport:       TransportAuto,
+		events:          newEventHub(),
+		publishedStatus: make(map[string]Status),
 	}
 }
 
-// SetOnChange sets a callback function that is called when connections change
-func (m *Manager) SetOnChange(fn func()) {
-	m.onChange = fn
+// SetReconnectPolicy sets the backoff policy used to re-dial dropped connections.
+// Zero fields fall back to DefaultReconnectPolicy. Only affects new connections.
+func (m *Manager) SetReconnectPolicy(policy ReconnectPolicy) {
+	m.mu.Lock()
+	m.reconnectPolicy = policy.normalize()
+	m.mu.Unlock()
+}
+
+// SetTransport sets how new tunnels reach the API server. It replaces a
+// dialer set with SetDialer.
+func (m *Manager) SetTransport(mode TransportMode) {
+	m.mu.Lock()
+	m.transport = mode
+	m.dialer = nil
+	m.mu.Unlock()
 }
 
+// SetDialer sets the dialer new tunnels of all kube contexts are opened with
+func (m *Manager) SetDialer(dialer TunnelDialer) {
+	m.mu.Lock()
+	m.dialer = dialer
+	m.mu.Unlock()
+}
+
+// SetDefaultContext names the kube context of the clients the manager was
+// created with. Forwards naming it use those clients, and saved connections
+// remember it so they come back in the same cluster.
+func (m *Manager) SetDefaultContext(name string) {
+	m.clients.setDefaultContext(name)
+}
+
+// SetClientFactory sets how the clients of kube contexts other than the
+// default are built. Without one, only the default context can be used.
+func (m *Manager) SetClientFactory(factory ClientFactory) {
+	m.clients.setFactory(factory)
+}
+
+// notifyChange publishes the status changes made since the last call
 func (m *Manager) notifyChange() {
-	if m.onChange != nil {
-		m.onChange()
-	}
+	m.publishStatusChanges()
 }
 
 // AddLog adds a log entry to connection
 func (c *Connection) AddLog(msg string) {
+	line := fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg)
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	timestamp := time.Now().Format("15:04:05")
-	c.Logs = append(c.Logs, fmt.Sprintf("[%s] %s", timestamp, msg))
+	c.Logs = append(c.Logs, line)
 	if len(c.Logs) > 100 {
 		c.Logs = c.Logs[len(c.Logs)-100:]
 	}
+	c.mu.Unlock()
+	c.publishLog(line)
 }
 
 // GetLogs returns connection logs
@@ -119,35 +250,238 @@ func (c *Connection) GetLogs() []string {
 	return result
 }
 
+// Options returns the options the connection was started with
+func (c *Connection) Options() ForwardOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return ForwardOptions{
+		Context:      c.Context,
+		Namespace:    c.Namespace,
+		ResourceType: c.ResourceType,
+		ResourceName: c.ResourceName,
+		LocalPort:    c.LocalPort,
+		RemotePort:   c.RemotePort,
+		Ports:        append([]PortMapping(nil), c.Ports...),
+		Addresses:    append([]string(nil), c.Addresses...),
+		SocketPath:   c.SocketPath,
+		SocketMode:   c.SocketMode,
+		Balance:      c.Balance,
+		Probe:        c.Probe,
+		Lazy:         c.Lazy,
+		IdleTimeout:  c.IdleTimeout,
+		Routes:       append([]Route(nil), c.Routes...),
+		TLS:          c.TLS,
+		Faults:       c.Faults,
+		Limits:       c.Limits,
+	}
+}
+
+// localEndpoint returns where clients connect to for port mapping p
+func (c *Connection) localEndpoint(p PortMapping) string {
+	if c.SocketPath != "" {
+		return "unix:" + c.SocketPath
+	}
+	return listenAddress(c.Addresses[0], p.Local)
+}
+
+// portMappings returns a copy of the connection's port mappings
+func (c *Connection) portMappings() []PortMapping {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]PortMapping(nil), c.Ports...)
+}
+
 // StartPortForwardToPod starts a port-forward to a pod
 func (m *Manager) StartPortForwardToPod(ctx context.Context, namespace, podName string, localPort, remotePort int) (*Connection, error) {
-	return m.startPortForward(ctx, namespace, ResourcePod, podName, localPort, remotePort)
+	return m.StartWithOptions(ctx, ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: ResourcePod,
+		ResourceName: podName,
+		LocalPort:    localPort,
+		RemotePort:   remotePort,
+	})
 }
 
 // StartPortForwardToService starts a port-forward to a service
 func (m *Manager) StartPortForwardToService(ctx context.Context, namespace, serviceName string, localPort, remotePort int) (*Connection, error) {
-	return m.startPortForward(ctx, namespace, ResourceService, serviceName, localPort, remotePort)
+	return m.StartWithOptions(ctx, ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: ResourceService,
+		ResourceName: serviceName,
+		LocalPort:    localPort,
+		RemotePort:   remotePort,
+	})
+}
+
+// StartWithOptions starts a port-forward described by opts. Automatic (0)
+// local ports are bound while starting; the returned connection's Ports
+// hold the ones it listens on. ctx only bounds the start, the connection
+// runs until it's stopped.
+func (m *Manager) StartWithOptions(ctx context.Context, opts ForwardOptions) (*Connection, error) {
+	return m.startPortForward(ctx, opts)
+}
+
+// Validate checks opts for settings that can't work together, without
+// looking at the cluster
+func (opts ForwardOptions) Validate() error {
+	ports := opts.PortMappings()
+	seenLocal := make(map[int]bool)
+	for _, p := range ports {
+		if p.Local == 0 {
+			continue
+		}
+		if seenLocal[p.Local] {
+			return fmt.Errorf("local port %d is mapped more than once", p.Local)
+		}
+		seenLocal[p.Local] = true
+	}
+
+	if _, err := ParseResourceType(string(opts.ResourceType)); err != nil {
+		return err
+	}
+	if opts.ResourceType == ResourceRouter {
+		if len(opts.Routes) == 0 {
+			return fmt.Errorf("a router needs at least one route")
+		}
+		if len(ports) != 1 {
+			return fmt.Errorf("a router listens on exactly one local port")
+		}
+		if opts.Lazy || opts.Probe != nil || opts.SocketPath != "" {
+			return fmt.Errorf("routers can't be lazy, probed or listen on a Unix socket")
+		}
+		if opts.TLS != nil && opts.TLS.Mode == TLSOriginate {
+			return fmt.Errorf("routers can only terminate TLS")
+		}
+	} else if len(opts.Routes) > 0 {
+		return fmt.Errorf("routes need a router forward (router/NAME)")
+	}
+	if opts.Balance != BalanceNone && opts.ResourceType != ResourceService {
+		return fmt.Errorf("load balancing is only supported for services")
+	}
+	if _, err := ParseAddresses(opts.Addresses); err != nil {
+		return err
+	}
+	if opts.SocketPath != "" && len(ports) != 1 {
+		return fmt.Errorf("a Unix socket forward needs exactly one remote port")
+	}
+	if opts.Lazy {
+		if opts.Balance != BalanceNone {
+			return fmt.Errorf("lazy tunnels can't be combined with load balancing")
+		}
+		if opts.Probe != nil {
+			return fmt.Errorf("health probes would keep a lazy tunnel open; use one or the other")
+		}
+	}
+	if opts.IdleTimeout < 0 {
+		return fmt.Errorf("invalid idle timeout %s", opts.IdleTimeout)
+	}
+	if opts.Probe != nil {
+		if _, err := ParseProbeType(string(opts.Probe.Type)); err != nil {
+			return err
+		}
+		if _, err := probeMapping(opts.Probe, ports); err != nil {
+			return err
+		}
+	}
+	if opts.TLS != nil {
+		if _, err := opts.TLS.normalize(opts.Namespace, opts.ResourceType, opts.ResourceName); err != nil {
+			return err
+		}
+	}
+	if opts.Faults != nil {
+		if err := opts.Faults.Validate(); err != nil {
+			return err
+		}
+	}
+	if opts.Limits != nil {
+		if err := opts.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // startPortForward starts a new port-forward connection
-func (m *Manager) startPortForward(ctx context.Context, namespace string, resourceType ResourceType, resourceName string, localPort, remotePort int) (*Connection, error) {
-	prefix := "pod"
-	if resourceType == ResourceService {
-		prefix = "svc"
+func (m *Manager) startPortForward(ctx context.Context, opts ForwardOptions) (*Connection, error) {
+	namespace, resourceName := opts.Namespace, opts.ResourceName
+	ports := opts.PortMappings()
+	prefix := opts.ResourceType.ShortName()
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.ResourceType == ResourceRouter {
+		ports = routerPorts(ports)
+	}
+	addresses, err := ParseAddresses(opts.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SocketPath != "" {
+		if opts.SocketPath, err = normalizeSocketPath(opts.SocketPath); err != nil {
+			return nil, err
+		}
+		if opts.SocketMode == 0 {
+			opts.SocketMode = DefaultSocketMode
+		}
+	}
+	if opts.Lazy && opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if opts.Probe != nil {
+		probe := opts.Probe.normalize()
+		opts.Probe = &probe
+	}
+	var tlsConfig *tls.Config
+	var tlsLines []string
+	if opts.TLS != nil {
+		tlsOpts, err := opts.TLS.normalize(namespace, opts.ResourceType, resourceName)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig, tlsLines, err = m.tlsConfig(tlsOpts, addresses); err != nil {
+			return nil, err
+		}
+		opts.TLS = &tlsOpts
+	}
+	if opts.Faults != nil && opts.Faults.IsZero() {
+		opts.Faults = nil
 	}
-	id := fmt.Sprintf("%s/%s/%s:%d->%d", namespace, prefix, resourceName, localPort, remotePort)
+	if opts.Limits != nil && opts.Limits.IsZero() {
+		opts.Limits = nil
+	}
+	opts.Context = m.clients.normalize(opts.Context)
+	cl, err := m.clients.get(opts.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	requested := ports
+	var reserved []localListener
+	if opts.SocketPath == "" {
+		ports, reserved, err = m.allocateLocalPorts(requested, opts.PortRange, addresses)
+		if err != nil {
+			m.mu.Unlock()
+			logger.Error("portforward", "Local port allocation failed: %v", err)
+			return nil, err
+		}
+	}
+	opts.Ports = ports
+	localPort, remotePort := ports[0].Local, ports[0].Remote
+	id := ConnectionID(opts)
 
 	logger.Debug("portforward", "Starting port-forward: %s", id)
 	logger.Debug("portforward", "  Namespace: %s, Resource: %s/%s", namespace, prefix, resourceName)
-	logger.Debug("portforward", "  Ports: localhost:%d -> %d", localPort, remotePort)
+	logger.Debug("portforward", "  Ports: %s", FormatPortMappings(ports))
 
-	m.mu.Lock()
 	if existing, ok := m.connections[id]; ok {
 		existing.mu.RLock()
 		status := existing.Status
 		existing.mu.RUnlock()
-		if status == StatusActive || status == StatusStarting {
+		if status.IsRunning() {
 			m.mu.Unlock()
+			closeListeners(reserved)
 			logger.Warn("portforward", "Connection already active: %s", id)
 			return nil, fmt.Errorf("port-forward already active for %s", id)
 		}
@@ -159,21 +493,40 @@ func (m *Manager) startPortForward(ctx context.Context, namespace string, resour
 		delete(m.connections, id)
 	}
 
-	// Create cancellable context for this connection
-	connCtx, cancelFunc := context.WithCancel(ctx)
+	// Create cancellable context for this connection, which outlives ctx
+	connCtx, cancelFunc := context.WithCancel(context.WithoutCancel(ctx))
+	autoReconnect := !m.reconnectPolicy.Disabled
 
 	conn := &Connection{
 		ID:            id,
+		Context:       opts.Context,
 		Namespace:     namespace,
-		ResourceType:  resourceType,
+		ResourceType:  opts.ResourceType,
 		ResourceName:  resourceName,
 		LocalPort:     localPort,
 		RemotePort:    remotePort,
+		Ports:         ports,
+		Addresses:     addresses,
+		SocketPath:    opts.SocketPath,
+		SocketMode:    opts.SocketMode,
+		Balance:       opts.Balance,
+		Probe:         opts.Probe,
+		Lazy:          opts.Lazy,
+		IdleTimeout:   opts.IdleTimeout,
+		Routes:        append([]Route(nil), opts.Routes...),
+		TLS:           opts.TLS,
+		Faults:        opts.Faults,
+		Limits:        opts.Limits,
+		tlsConfig:     tlsConfig,
+		limiter:       newLimiter(opts.Limits),
+		reserved:      reserved,
+		probes:        make(chan net.Conn),
 		Status:        StatusStarting,
 		StartedAt:     time.Now(),
 		Logs:          make([]string, 0),
-		AutoReconnect: true,
+		AutoReconnect: autoReconnect,
 		manager:       m,
+		cluster:       cl,
 		stopChan:      make(chan struct{}),
 		readyChan:     make(chan struct{}),
 		cancelFunc:    cancelFunc,
@@ -181,17 +534,49 @@ func (m *Manager) startPortForward(ctx context.Context, namespace string, resour
 
 	conn.AddLog("Starting port-forward...")
 	conn.AddLog(fmt.Sprintf("Target: %s/%s/%s", namespace, prefix, resourceName))
-	conn.AddLog(fmt.Sprintf("Ports: localhost:%d -> %d", localPort, remotePort))
+	if opts.Context != "" {
+		conn.AddLog(fmt.Sprintf("Kube context: %s", opts.Context))
+	}
+	if opts.SocketPath != "" {
+		conn.AddLog(fmt.Sprintf("Socket: %s (mode %s)", opts.SocketPath, FormatSocketMode(opts.SocketMode)))
+	}
+	for _, addr := range ExposedAddresses(addresses) {
+		conn.AddLog(fmt.Sprintf("⚠ Listening on %s: the forward is reachable from other hosts", addr))
+		logger.Warn("portforward", "%s listens on non-loopback address %s", id, addr)
+	}
+	for i, p := range ports {
+		conn.AddLog(fmt.Sprintf("Ports: %s -> %s", conn.localEndpoint(p), p.RemoteString()))
+		if requested[i].Local == 0 && opts.SocketPath == "" {
+			conn.AddLog(fmt.Sprintf("Allocated local port %d", p.Local))
+			logger.Info("portforward", "Allocated local port %d for %s", p.Local, id)
+		}
+	}
+	if opts.Balance != BalanceNone {
+		conn.AddLog(fmt.Sprintf("Load balancing: %s", opts.Balance))
+	}
+	if opts.Probe != nil {
+		conn.AddLog(fmt.Sprintf("Health probe: %s", opts.Probe))
+	}
+	if opts.Lazy {
+		conn.AddLog(fmt.Sprintf("On demand: tunnel opens on the first connection and closes after %s idle", opts.IdleTimeout))
+	}
+	for _, r := range opts.Routes {
+		conn.AddLog(fmt.Sprintf("Route: %s -> %s", r.Match(), r.Target()))
+	}
+	for _, line := range tlsLines {
+		conn.AddLog(line)
+	}
+	if opts.Limits != nil {
+		conn.AddLog(fmt.Sprintf("Limits: %s", opts.Limits))
+	}
 
 	m.connections[id] = conn
 	m.mu.Unlock()
-	m.notifyChange()
+	m.publishAdded(conn)
 
 	// Start port-forward in goroutine with cancellable context
 	errChan := make(chan error, 1)
-	go func() {
-		errChan <- m.runPortForward(connCtx, conn)
-	}()
+	go m.superviseConnection(connCtx, conn, errChan)
 
 	// Wait for ready or error
 	logger.Debug("portforward", "Waiting for port-forward ready signal (timeout: 30s)...")
@@ -215,265 +600,224 @@ func (m *Manager) startPortForward(ctx context.Context, namespace string, resour
 	}
 }
 
-// runPortForward runs the port-forward (like kubectl does)
-func (m *Manager) runPortForward(ctx context.Context, conn *Connection) error {
-	var podName string
-	var targetPort int = conn.RemotePort
+// superviseConnection runs the port-forward and re-dials it with backoff
+// whenever an established tunnel drops. A failure of the very first attempt is
+// reported on startErr so that startPortForward can return it to the caller.
+func (m *Manager) superviseConnection(ctx context.Context, conn *Connection, startErr chan<- error) {
+	defer func() { closeListeners(conn.takeReserved()) }()
 
-	logger.Debug("portforward", "runPortForward started for %s", conn.ID)
+	m.mu.RLock()
+	policy := m.reconnectPolicy
+	m.mu.RUnlock()
 
-	if conn.ResourceType == ResourceService {
-		// For service, we need to find a backing pod (like kubectl does)
-		conn.AddLog("Finding pod for service...")
-		logger.Debug("portforward", "Looking up service: %s/%s", conn.Namespace, conn.ResourceName)
+	run := m.runPortForward
+	if conn.ResourceType == ResourceRouter {
+		run = m.runRouter
+	} else if conn.Balance != BalanceNone {
+		run = m.runBalancedPortForward
+	} else if conn.Lazy {
+		run = m.runLazyPortForward
+	}
 
-		svc, err := m.clientset.CoreV1().Services(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
-		if err != nil {
-			conn.AddLog(fmt.Sprintf("✗ Service not found: %v", err))
-			logger.Error("portforward", "Service lookup failed: %s/%s - %v", conn.Namespace, conn.ResourceName, err)
-			conn.mu.Lock()
-			conn.Status = StatusError
-			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
-		}
-		conn.AddLog(fmt.Sprintf("Service: %s", svc.Name))
-		logger.Debug("portforward", "Service found: %s, Type: %s, ClusterIP: %s", svc.Name, svc.Spec.Type, svc.Spec.ClusterIP)
+	everEstablished := false
+	attempt := 0
 
-		// Find pod using service selector first (we need it to resolve named ports)
-		selector := svc.Spec.Selector
-		if len(selector) == 0 {
-			err := fmt.Errorf("service has no selector")
-			conn.AddLog(fmt.Sprintf("✗ %v", err))
-			logger.Error("portforward", "Service %s has no selector", conn.ResourceName)
-			conn.mu.Lock()
-			conn.Status = StatusError
-			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
+	for {
+		established, err := run(ctx, conn)
+		if conn.isStopped(ctx) {
+			return
 		}
 
-		var labelSelector []string
-		for k, v := range selector {
-			labelSelector = append(labelSelector, fmt.Sprintf("%s=%s", k, v))
+		if !everEstablished && !established {
+			m.failConnection(conn, err)
+			startErr <- err
+			return
 		}
-		selectorStr := strings.Join(labelSelector, ",")
-		logger.Debug("portforward", "Service selector: %s", selectorStr)
-
-		pods, err := m.clientset.CoreV1().Pods(conn.Namespace).List(ctx, metav1.ListOptions{
-			LabelSelector: selectorStr,
-		})
-		if err != nil || len(pods.Items) == 0 {
-			err := fmt.Errorf("no pods found for service")
-			conn.AddLog(fmt.Sprintf("✗ %v", err))
-			logger.Error("portforward", "No pods found for selector: %s", selectorStr)
-			conn.mu.Lock()
-			conn.Status = StatusError
-			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
+		if established {
+			everEstablished = true
+			attempt = 0
 		}
-		logger.Debug("portforward", "Found %d pods matching selector", len(pods.Items))
-
-		// Find first running pod
-		var runningPod *corev1.Pod
-		for i := range pods.Items {
-			logger.Debug("portforward", "  Pod: %s, Phase: %s", pods.Items[i].Name, pods.Items[i].Status.Phase)
-			if pods.Items[i].Status.Phase == corev1.PodRunning {
-				runningPod = &pods.Items[i]
-				podName = runningPod.Name
-				conn.AddLog(fmt.Sprintf("Using pod: %s", podName))
-				logger.Debug("portforward", "Selected running pod: %s", podName)
-				break
-			}
+
+		// The backing pod of a service went away, or the health probe gave up
+		// on the tunnel: re-dial also without auto-reconnect, but still back
+		// off so a pod flapping between ready and unready isn't re-dialed in
+		// a tight loop
+		redial := errors.Is(err, errPodFailover) || errors.Is(err, errProbeFailed)
+		if !redial && !conn.AutoReconnect {
+			m.failConnection(conn, err)
+			return
 		}
 
-		if podName == "" {
-			err := fmt.Errorf("no running pods found for service")
-			conn.AddLog(fmt.Sprintf("✗ %v", err))
-			logger.Error("portforward", "No running pods found for service %s", conn.ResourceName)
-			conn.mu.Lock()
-			conn.Status = StatusError
-			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
+		attempt++
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			conn.AddLog(fmt.Sprintf("✗ Giving up after %d reconnect attempts", policy.MaxAttempts))
+			logger.Error("portforward", "Giving up on %s after %d reconnect attempts: %v", conn.ID, policy.MaxAttempts, err)
+			m.failConnection(conn, fmt.Errorf("giving up after %d reconnect attempts: %v", policy.MaxAttempts, err))
+			return
 		}
 
-		// Resolve targetPort from service spec
-		// TargetPort can be: number, named port, or empty (defaults to Port)
-		logger.Debug("portforward", "Resolving targetPort for service port %d", conn.RemotePort)
-		for _, port := range svc.Spec.Ports {
-			logger.Debug("portforward", "  Service port spec: Port=%d, TargetPort=%v, Protocol=%s",
-				port.Port, port.TargetPort, port.Protocol)
-			if int(port.Port) == conn.RemotePort {
-				if port.TargetPort.IntValue() != 0 {
-					// TargetPort is a number
-					targetPort = port.TargetPort.IntValue()
-					logger.Debug("portforward", "  TargetPort is numeric: %d", targetPort)
-				} else if port.TargetPort.String() != "" && port.TargetPort.String() != "0" {
-					// TargetPort is a named port - resolve from pod spec
-					namedPort := port.TargetPort.String()
-					conn.AddLog(fmt.Sprintf("Resolving named port: %s", namedPort))
-					logger.Debug("portforward", "  TargetPort is named: %s, resolving from pod spec...", namedPort)
-					for _, container := range runningPod.Spec.Containers {
-						for _, cp := range container.Ports {
-							logger.Debug("portforward", "    Container %s port: %s -> %d",
-								container.Name, cp.Name, cp.ContainerPort)
-							if cp.Name == namedPort {
-								targetPort = int(cp.ContainerPort)
-								conn.AddLog(fmt.Sprintf("Resolved %s -> %d", namedPort, targetPort))
-								logger.Debug("portforward", "  Resolved named port %s -> %d", namedPort, targetPort)
-								break
-							}
-						}
-					}
-				}
-				// If still not resolved, targetPort stays as conn.RemotePort
-				conn.AddLog(fmt.Sprintf("Service port %d -> pod port %d", port.Port, targetPort))
-				logger.Info("portforward", "Port mapping: service:%d -> pod:%d", port.Port, targetPort)
-				break
-			}
+		delay := policy.Backoff(attempt)
+		attemptsStr := fmt.Sprintf("%d", attempt)
+		if policy.MaxAttempts > 0 {
+			attemptsStr = fmt.Sprintf("%d/%d", attempt, policy.MaxAttempts)
 		}
-	} else {
-		// Port-forward to pod directly
-		conn.AddLog("Checking pod status...")
-		logger.Debug("portforward", "Looking up pod: %s/%s", conn.Namespace, conn.ResourceName)
-		pod, err := m.clientset.CoreV1().Pods(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+
+		conn.mu.Lock()
+		conn.Status = StatusReconnecting
+		conn.ReconnectCount++
 		if err != nil {
-			conn.AddLog(fmt.Sprintf("✗ Pod not found: %v", err))
-			logger.Error("portforward", "Pod lookup failed: %s/%s - %v", conn.Namespace, conn.ResourceName, err)
-			conn.mu.Lock()
-			conn.Status = StatusError
 			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
 		}
-
-		logger.Debug("portforward", "Pod found: %s, Phase: %s, IP: %s", pod.Name, pod.Status.Phase, pod.Status.PodIP)
-		if pod.Status.Phase != corev1.PodRunning {
-			err := fmt.Errorf("pod is not running: %s", pod.Status.Phase)
-			conn.AddLog(fmt.Sprintf("✗ %v", err))
-			logger.Error("portforward", "Pod not running: %s, Phase: %s", pod.Name, pod.Status.Phase)
-			conn.mu.Lock()
-			conn.Status = StatusError
-			conn.Error = err.Error()
-			conn.mu.Unlock()
-			m.notifyChange()
-			return err
+		conn.mu.Unlock()
+		conn.AddLog(fmt.Sprintf("⟳ Reconnecting in %s (attempt %s)", delay.Round(100*time.Millisecond), attemptsStr))
+		logger.Info("portforward", "Reconnecting %s in %s (attempt %s)", conn.ID, delay, attemptsStr)
+		m.notifyChange()
+		m.publishReconnecting(conn, attempt, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-conn.stopChan:
+			return
+		case <-ctx.Done():
+			return
 		}
-		conn.AddLog(fmt.Sprintf("Pod status: %s", pod.Status.Phase))
-		podName = conn.ResourceName
 	}
+}
 
-	// Build request URL for pod port-forward
-	req := m.clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Namespace(conn.Namespace).
-		Name(podName).
-		SubResource("portforward")
-
-	apiURL := req.URL().String()
-	conn.AddLog(fmt.Sprintf("URL: %s", apiURL))
-	conn.AddLog(fmt.Sprintf("Forwarding: localhost:%d -> %s:%d", conn.LocalPort, podName, targetPort))
-	logger.Debug("portforward", "API URL: %s", apiURL)
-	logger.Debug("portforward", "Creating SPDY transport...")
-
-	// Create SPDY transport
-	transport, upgrader, err := spdy.RoundTripperFor(m.restConfig)
-	if err != nil {
-		conn.AddLog(fmt.Sprintf("✗ Transport error: %v", err))
-		logger.Error("portforward", "SPDY RoundTripper creation failed: %v", err)
-		conn.mu.Lock()
+// failConnection moves a connection to the error state
+func (m *Manager) failConnection(conn *Connection, err error) {
+	if err == nil {
+		err = fmt.Errorf("port-forward closed unexpectedly")
+	}
+	conn.mu.Lock()
+	if conn.Status != StatusStopped {
 		conn.Status = StatusError
 		conn.Error = err.Error()
-		conn.mu.Unlock()
-		m.notifyChange()
-		return err
+		conn.StoppedAt = time.Now()
+	}
+	conn.mu.Unlock()
+	m.notifyChange()
+}
+
+// isStopped reports whether the connection was stopped or its context cancelled
+func (c *Connection) isStopped(ctx context.Context) bool {
+	select {
+	case <-c.stopChan:
+		return true
+	default:
 	}
-	logger.Debug("portforward", "SPDY transport created successfully")
-
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
-	logger.Debug("portforward", "SPDY dialer created")
-
-	// Port mapping - use targetPort (resolved from service if applicable)
-	ports := []string{fmt.Sprintf("%d:%d", conn.LocalPort, targetPort)}
-	conn.AddLog(fmt.Sprintf("Port mapping: %s", ports[0]))
-	logger.Debug("portforward", "Port mapping: %s", ports[0])
-
-	// Create log writers
-	outWriter := &logWriter{conn: conn}
-	errWriter := &logWriter{conn: conn}
-
-	// Create port forwarder - bind to 127.0.0.1 only (like kubectl with --address)
-	logger.Debug("portforward", "Creating port forwarder on 127.0.0.1...")
-	fw, err := portforward.NewOnAddresses(
-		dialer,
-		[]string{"127.0.0.1"},
-		ports,
-		conn.stopChan,
-		conn.readyChan,
-		outWriter,
-		errWriter,
-	)
+	return ctx.Err() != nil
+}
+
+// markReady signals startPortForward that the first tunnel is up
+func (c *Connection) markReady() {
+	c.readyOnce.Do(func() {
+		close(c.readyChan)
+	})
+}
+
+// runPortForward runs a single port-forward attempt (like kubectl does).
+// It returns once the tunnel ends; established reports whether the tunnel
+// became ready before that happened.
+func (m *Manager) runPortForward(ctx context.Context, conn *Connection) (established bool, err error) {
+	var failover <-chan string
+	var probeFailed <-chan error
+	mappings := conn.portMappings()
+
+	// Per-attempt context for watchers started below
+	attemptCtx, cancelAttempt := context.WithCancel(ctx)
+	defer cancelAttempt()
+
+	logger.Debug("portforward", "runPortForward started for %s", conn.ID)
+
+	podName, targetPorts, selector, err := m.resolveTarget(ctx, conn, mappings)
 	if err != nil {
-		conn.AddLog(fmt.Sprintf("✗ Failed to create forwarder: %v", err))
-		logger.Error("portforward", "Failed to create port forwarder: %v", err)
-		conn.mu.Lock()
-		conn.Status = StatusError
-		conn.Error = err.Error()
-		conn.mu.Unlock()
-		m.notifyChange()
-		return err
+		return false, err
+	}
+	if selector != "" {
+		// Follow the pod so the tunnel can fail over when it is rolled or evicted
+		failover = m.watchPod(attemptCtx, conn.cluster, conn.Namespace, selector, podName)
 	}
 
-	conn.AddLog("Starting tunnel...")
-	logger.Debug("portforward", "Port forwarder created, starting tunnel...")
+	for i, p := range mappings {
+		conn.AddLog(fmt.Sprintf("Forwarding: %s -> %s:%d", conn.localEndpoint(p), podName, targetPorts[i]))
+	}
 
-	// Run port forwarding in a goroutine
+	// Port mappings - use target ports (resolved from service or pod spec)
+	ports := make([]string, len(mappings))
+	for i, p := range mappings {
+		ports[i] = fmt.Sprintf("%d:%d", p.Local, targetPorts[i])
+	}
+	if conn.SocketPath != "" {
+		ports = []string{fmt.Sprintf("%s:%d", conn.SocketPath, targetPorts[0])}
+	}
+	conn.AddLog(fmt.Sprintf("Port mapping: %s", strings.Join(ports, ", ")))
+	logger.Debug("portforward", "Port mapping: %v", ports)
+
+	// Each attempt gets its own ready and stop channels: the forwarder closes
+	// readyChan, and attemptStop lets a failover tear down just this tunnel
+	readyChan := make(chan struct{})
+	attemptStop := make(chan struct{})
+	var attemptStopOnce sync.Once
+	stopAttempt := func() {
+		attemptStopOnce.Do(func() { close(attemptStop) })
+	}
+	defer stopAttempt()
+	go func() {
+		select {
+		case <-conn.stopChan:
+			stopAttempt()
+		case <-attemptStop:
+		}
+	}()
+
+	// The manager owns the local listeners (TCP ports or a Unix socket) so
+	// every client connection can be counted in the connection's metrics
+	conn.AddLog("Starting tunnel...")
 	errChan := make(chan error, 1)
 	go func() {
-		logger.Debug("portforward", "ForwardPorts() goroutine started for %s", conn.ID)
-		err := fw.ForwardPorts()
-		logger.Debug("portforward", "ForwardPorts() returned for %s: %v", conn.ID, err)
-		errChan <- err
+		errChan <- m.forwardTunnel(attemptCtx, conn, podName, targetPorts, attemptStop, readyChan)
 	}()
 
 	// Wait for ready or error
 	logger.Debug("portforward", "Waiting for tunnel ready signal...")
 	select {
-	case <-conn.readyChan:
+	case <-readyChan:
 		conn.AddLog("✓ Tunnel ready")
-		logger.Info("portforward", "Tunnel ready: %s (localhost:%d -> %s:%d)", conn.ID, conn.LocalPort, podName, targetPort)
+		logger.Info("portforward", "Tunnel ready: %s (%s on %s)", conn.ID, strings.Join(ports, ", "), podName)
 		conn.mu.Lock()
+		reconnected := conn.Status == StatusReconnecting
+		reconnects := conn.ReconnectCount
+		prevPod := conn.PodName
 		conn.Status = StatusActive
+		conn.Error = ""
+		conn.PodName = podName
 		conn.mu.Unlock()
+		if prevPod != "" && prevPod != podName {
+			conn.AddLog(fmt.Sprintf("⇄ Switched from pod %s to pod %s", prevPod, podName))
+			logger.Info("portforward", "Failover: %s moved from pod %s to %s", conn.ID, prevPod, podName)
+		}
+		if reconnected {
+			conn.AddLog(fmt.Sprintf("✓ Reconnected (total reconnects: %d)", reconnects))
+		}
+		conn.markReady()
 		m.notifyChange()
+		probeFailed = m.watchProbe(attemptCtx, conn)
 
 	case err := <-errChan:
 		conn.AddLog(fmt.Sprintf("✗ Forward error: %v", err))
 		logger.Error("portforward", "Tunnel failed during startup: %s - %v", conn.ID, err)
-		conn.mu.Lock()
-		conn.Status = StatusError
-		conn.Error = err.Error()
-		conn.StoppedAt = time.Now()
-		conn.mu.Unlock()
-		m.notifyChange()
-		return err
+		return false, err
 
 	case <-conn.stopChan:
 		conn.AddLog("Stop signal received during startup")
 		logger.Debug("portforward", "Stop signal received during tunnel startup: %s", conn.ID)
-		return nil
+		return false, nil
 
 	case <-ctx.Done():
 		conn.AddLog("Context cancelled during startup")
 		logger.Debug("portforward", "Context cancelled during tunnel startup: %s", conn.ID)
-		return ctx.Err()
+		return false, ctx.Err()
 	}
 
 	// Wait for forward to complete, stop signal, or context cancellation
@@ -481,22 +825,41 @@ func (m *Manager) runPortForward(ctx context.Context, conn *Connection) error {
 	select {
 	case err = <-errChan:
 		conn.mu.Lock()
-		if conn.Status != StatusStopped {
-			if err != nil {
-				conn.Status = StatusError
-				conn.Error = err.Error()
-				conn.AddLog(fmt.Sprintf("✗ Forward error: %v", err))
-				logger.Error("portforward", "Tunnel error: %s - %v", conn.ID, err)
-			} else {
-				conn.Status = StatusStopped
-				conn.AddLog("Port-forward stopped")
-				logger.Info("portforward", "Tunnel stopped normally: %s", conn.ID)
+		stopped := conn.Status == StatusStopped
+		conn.mu.Unlock()
+		if !stopped {
+			if err == nil {
+				err = fmt.Errorf("tunnel closed unexpectedly")
 			}
-			conn.StoppedAt = time.Now()
+			conn.AddLog(fmt.Sprintf("✗ Forward error: %v", err))
+			logger.Error("portforward", "Tunnel error: %s - %v", conn.ID, err)
 		}
-		conn.mu.Unlock()
-		m.notifyChange()
-		return err
+		return true, err
+
+	case reason := <-failover:
+		// Backing pod is going away - tear down this tunnel so the
+		// supervisor can re-dial another pod on the same local port
+		conn.AddLog(fmt.Sprintf("⇄ Pod %s %s, moving tunnel to another pod", podName, reason))
+		logger.Info("portforward", "Pod %s %s, failing over: %s", podName, reason, conn.ID)
+		stopAttempt()
+		select {
+		case <-errChan:
+		case <-time.After(5 * time.Second):
+			logger.Warn("portforward", "Timeout waiting for tunnel to close: %s", conn.ID)
+		}
+		return true, fmt.Errorf("%w: pod %s %s", errPodFailover, podName, reason)
+
+	case err := <-probeFailed:
+		// The tunnel is up but the pod port doesn't answer - re-dial it
+		conn.AddLog(fmt.Sprintf("⟳ %v, re-dialing tunnel", err))
+		logger.Warn("portforward", "Probe gave up on %s: %v", conn.ID, err)
+		stopAttempt()
+		select {
+		case <-errChan:
+		case <-time.After(5 * time.Second):
+			logger.Warn("portforward", "Timeout waiting for tunnel to close: %s", conn.ID)
+		}
+		return true, err
 
 	case <-conn.stopChan:
 		// Stop signal received
@@ -509,36 +872,221 @@ func (m *Manager) runPortForward(ctx context.Context, conn *Connection) error {
 		}
 		conn.mu.Unlock()
 		m.notifyChange()
-		return nil
+		return true, nil
 
 	case <-ctx.Done():
 		// Context cancelled - exit immediately
 		conn.AddLog("Shutting down...")
 		logger.Debug("portforward", "Context cancelled, shutting down tunnel: %s", conn.ID)
-		return nil
+		return true, nil
 	}
 }
 
-// logWriter writes to connection logs
-type logWriter struct {
-	conn *Connection
-	buf  bytes.Buffer
+// resolveTarget picks the pod a tunnel for conn goes to and the pod port of
+// each mapping. For services and workloads it also returns the label
+// selector of their pods, so the caller can follow the chosen pod.
+func (m *Manager) resolveTarget(ctx context.Context, conn *Connection, mappings []PortMapping) (podName string, targetPorts []int, selector string, err error) {
+	if conn.ResourceType == ResourceService {
+		// For service, we need to find a backing pod (like kubectl does)
+		conn.AddLog("Finding pod for service...")
+		svc, selectorStr, err := m.lookupService(ctx, conn)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		targets, err := m.serviceTargets(ctx, conn, svc)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		// Targets are sorted, so the first ready one is a stable choice
+		podName = targets[0].pod
+		targetPorts = targets[0].ports
+		conn.AddLog(fmt.Sprintf("Using pod: %s", podName))
+		for i, p := range mappings {
+			conn.AddLog(fmt.Sprintf("Service port %s -> pod port %d", p.RemoteString(), targetPorts[i]))
+		}
+		logger.Info("portforward", "Selected ready endpoint %s (ports %v)", podName, targetPorts)
+
+		selector = selectorStr
+	} else if conn.ResourceType.IsWorkload() {
+		// For workloads, pick a ready pod from the pod template selector (like kubectl)
+		conn.AddLog(fmt.Sprintf("Finding pod for %s...", conn.ResourceType))
+		selectorStr, err := m.lookupWorkload(ctx, conn)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		pod, err := m.pickWorkloadPod(ctx, conn, selectorStr)
+		if err != nil {
+			return "", nil, "", err
+		}
+		podName = pod.Name
+		conn.AddLog(fmt.Sprintf("Using pod: %s", podName))
+
+		if targetPorts, err = containerPorts(conn, pod, mappings); err != nil {
+			return "", nil, "", err
+		}
+
+		selector = selectorStr
+	} else {
+		// Port-forward to pod directly
+		conn.AddLog("Checking pod status...")
+		logger.Debug("portforward", "Looking up pod: %s/%s", conn.Namespace, conn.ResourceName)
+		pod, err := conn.cluster.clientset.CoreV1().Pods(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err != nil {
+			conn.AddLog(fmt.Sprintf("✗ Pod not found: %v", err))
+			logger.Error("portforward", "Pod lookup failed: %s/%s - %v", conn.Namespace, conn.ResourceName, err)
+			return "", nil, "", err
+		}
+
+		logger.Debug("portforward", "Pod found: %s, Phase: %s, IP: %s", pod.Name, pod.Status.Phase, pod.Status.PodIP)
+		if pod.Status.Phase != corev1.PodRunning {
+			err := fmt.Errorf("pod is not running: %s", pod.Status.Phase)
+			conn.AddLog(fmt.Sprintf("✗ %v", err))
+			logger.Error("portforward", "Pod not running: %s, Phase: %s", pod.Name, pod.Status.Phase)
+			return "", nil, "", err
+		}
+		conn.AddLog(fmt.Sprintf("Pod status: %s", pod.Status.Phase))
+		podName = conn.ResourceName
+
+		if targetPorts, err = containerPorts(conn, pod, mappings); err != nil {
+			return "", nil, "", err
+		}
+	}
+
+	return podName, targetPorts, selector, nil
 }
 
-func (w *logWriter) Write(p []byte) (n int, err error) {
-	w.buf.Write(p)
-	for {
-		line, err := w.buf.ReadString('\n')
-		if err == io.EOF {
-			w.buf.WriteString(line)
-			break
+// lookupService fetches the connection's service and returns it together
+// with the label selector of its pods
+func (m *Manager) lookupService(ctx context.Context, conn *Connection) (*corev1.Service, string, error) {
+	logger.Debug("portforward", "Looking up service: %s/%s", conn.Namespace, conn.ResourceName)
+
+	svc, err := conn.cluster.clientset.CoreV1().Services(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ Service not found: %v", err))
+		logger.Error("portforward", "Service lookup failed: %s/%s - %v", conn.Namespace, conn.ResourceName, err)
+		return nil, "", err
+	}
+	conn.AddLog(fmt.Sprintf("Service: %s", svc.Name))
+	logger.Debug("portforward", "Service found: %s, Type: %s, ClusterIP: %s", svc.Name, svc.Spec.Type, svc.Spec.ClusterIP)
+
+	// Find pods using service selector (we need them to resolve named ports)
+	selector := svc.Spec.Selector
+	if len(selector) == 0 {
+		err := fmt.Errorf("service has no selector")
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Error("portforward", "Service %s has no selector", conn.ResourceName)
+		return nil, "", err
+	}
+
+	var labelSelector []string
+	for k, v := range selector {
+		labelSelector = append(labelSelector, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(labelSelector)
+	selectorStr := strings.Join(labelSelector, ",")
+	logger.Debug("portforward", "Service selector: %s", selectorStr)
+
+	return svc, selectorStr, nil
+}
+
+// podTarget is a pod together with the target port of every port mapping
+type podTarget struct {
+	pod   string
+	ports []int
+}
+
+// serviceTargets reads the service's EndpointSlices and returns the pods that
+// are ready on every port mapping, or an error explaining why there are none
+func (m *Manager) serviceTargets(ctx context.Context, conn *Connection, svc *corev1.Service) ([]podTarget, error) {
+	slices, err := k8s.ListEndpointSlices(ctx, conn.cluster.clientset, conn.Namespace, svc.Name)
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		return nil, err
+	}
+	logger.Debug("portforward", "Found %d EndpointSlices for service %s", len(slices), svc.Name)
+
+	targets, sets, err := matchServiceTargets(conn.portMappings(), svc, slices)
+	for _, set := range sets {
+		logNotReady(conn, set)
+	}
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Error("portforward", "%v", err)
+		return nil, err
+	}
+	return targets, nil
+}
+
+// matchServiceTargets matches EndpointSlices against every port mapping and
+// returns the pods ready on all of them, sorted by name, together with the
+// per-mapping endpoint sets
+func matchServiceTargets(mappings []PortMapping, svc *corev1.Service, slices []*discoveryv1.EndpointSlice) ([]podTarget, []k8s.ServiceEndpoints, error) {
+	sets := make([]k8s.ServiceEndpoints, len(mappings))
+	for i, p := range mappings {
+		servicePort, err := resolveServicePort(svc, p)
+		if err != nil {
+			return nil, nil, err
 		}
-		line = strings.TrimSpace(line)
-		if line != "" {
-			w.conn.AddLog(line)
+		sets[i] = k8s.MatchEndpoints(svc, servicePort, slices)
+		if err := sets[i].Err(); err != nil {
+			return nil, sets, err
 		}
 	}
-	return len(p), nil
+
+	var targets []podTarget
+	for _, ep := range sets[0].Ready {
+		target := podTarget{pod: ep.PodName, ports: []int{ep.Port}}
+		for _, set := range sets[1:] {
+			port := 0
+			for _, other := range set.Ready {
+				if other.PodName == ep.PodName {
+					port = other.Port
+					break
+				}
+			}
+			if port == 0 {
+				target.ports = nil
+				break
+			}
+			target.ports = append(target.ports, port)
+		}
+		if target.ports != nil {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, sets, fmt.Errorf("%w for service %s: no pod is ready on all forwarded ports", k8s.ErrNoReadyEndpoints, svc.Name)
+	}
+	return targets, sets, nil
+}
+
+// containerPorts resolves the remote side of every port mapping against pod
+func containerPorts(conn *Connection, pod *corev1.Pod, mappings []PortMapping) ([]int, error) {
+	ports := make([]int, len(mappings))
+	for i, p := range mappings {
+		port, err := resolveContainerPort(pod, p)
+		if err != nil {
+			conn.AddLog(fmt.Sprintf("✗ %v", err))
+			return nil, err
+		}
+		if p.RemoteName != "" {
+			conn.AddLog(fmt.Sprintf("Resolved %s -> %d", p.RemoteName, port))
+		}
+		ports[i] = port
+	}
+	return ports, nil
+}
+
+// logNotReady records the pods that were skipped because they are not ready
+func logNotReady(conn *Connection, endpoints k8s.ServiceEndpoints) {
+	if len(endpoints.NotReady) == 0 {
+		return
+	}
+	conn.AddLog(fmt.Sprintf("Skipping %d not-ready pod(s): %s", len(endpoints.NotReady), strings.Join(endpoints.NotReady, ", ")))
+	logger.Debug("portforward", "Not-ready endpoints for %s: %v", conn.ID, endpoints.NotReady)
 }
 
 // StopPortForward stops a port-forward connection
@@ -574,6 +1122,7 @@ func (m *Manager) StopPortForward(id string) error {
 		logger.Debug("portforward", "Closing stop channel for: %s", id)
 		close(conn.stopChan)
 	})
+	conn.stopRecording()
 
 	logger.Info("portforward", "Connection stopped: %s", id)
 	m.notifyChange()
@@ -583,10 +1132,6 @@ func (m *Manager) StopPortForward(id string) error {
 // StopAll stops all port-forward connections (for graceful shutdown)
 func (m *Manager) StopAll() {
 	logger.Debug("portforward", "StopAll called")
-	// Disable onChange to prevent blocking on Bubble Tea's Send() during shutdown
-	m.mu.Lock()
-	m.onChange = nil
-	m.mu.Unlock()
 
 	m.mu.RLock()
 	connections := make([]*Connection, 0, len(m.connections))
@@ -603,7 +1148,7 @@ func (m *Manager) StopAll() {
 	// Stop all connections
 	for _, conn := range connections {
 		conn.mu.Lock()
-		wasActive := conn.Status == StatusActive || conn.Status == StatusStarting
+		wasActive := conn.Status.IsRunning()
 		if conn.Status != StatusStopped {
 			conn.Status = StatusStopped
 			conn.StoppedAt = time.Now()
@@ -615,6 +1160,7 @@ func (m *Manager) StopAll() {
 		if conn.cancelFunc != nil {
 			conn.cancelFunc()
 		}
+		conn.stopRecording()
 
 		// Close stop channel
 		conn.stopOnce.Do(func() {
@@ -645,6 +1191,7 @@ func (m *Manager) StopAll() {
 	case <-time.After(2 * time.Second):
 		logger.Warn("portforward", "Timeout waiting for connections to stop, forcing exit")
 	}
+	m.notifyChange()
 }
 
 // GetConnection returns a specific connection
@@ -681,7 +1228,7 @@ func (m *Manager) GetActiveConnections() []*Connection {
 	result := make([]*Connection, 0)
 	for _, conn := range m.connections {
 		conn.mu.RLock()
-		if conn.Status == StatusActive {
+		if conn.Status == StatusActive || conn.Status == StatusDegraded || conn.Status == StatusListening {
 			result = append(result, conn)
 		}
 		conn.mu.RUnlock()
@@ -692,10 +1239,9 @@ func (m *Manager) GetActiveConnections() []*Connection {
 // RemoveConnection removes a stopped connection from the manager
 func (m *Manager) RemoveConnection(id string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	conn, ok := m.connections[id]
 	if !ok {
+		m.mu.Unlock()
 		return fmt.Errorf("connection not found: %s", id)
 	}
 
@@ -703,26 +1249,47 @@ func (m *Manager) RemoveConnection(id string) error {
 	status := conn.Status
 	conn.mu.RUnlock()
 
-	if status == StatusActive || status == StatusStarting {
+	if status.IsRunning() {
+		m.mu.Unlock()
 		return fmt.Errorf("cannot remove active connection")
 	}
 
 	delete(m.connections, id)
-	m.notifyChange()
+	m.mu.Unlock()
+	m.publishRemoved(conn)
 	return nil
 }
 
 // ConnectionInfo returns display info for a connection
 type ConnectionInfo struct {
-	ID           string
-	Namespace    string
-	ResourceType ResourceType
-	ResourceName string
-	LocalPort    int
-	RemotePort   int
-	Status       Status
-	Error        string
-	Duration     time.Duration
+	ID             string
+	Context        string
+	Namespace      string
+	ResourceType   ResourceType
+	ResourceName   string
+	PodName        string
+	LocalPort      int
+	RemotePort     int
+	Ports          []PortMapping
+	Addresses      []string
+	SocketPath     string
+	Balance        BalanceMode
+	Backends       []string
+	Probe          *Probe
+	ProbeFailures  int
+	ProbeError     string
+	Lazy           bool
+	IdleTimeout    time.Duration
+	Routes         []Route
+	TLS            *TLSOptions
+	Faults         *Faults
+	Limits         *Limits
+	Recording      *RecordingInfo // nil when not recording
+	Status         Status
+	Error          string
+	Duration       time.Duration
+	ReconnectCount int
+	Metrics        Metrics
 }
 
 // GetConnectionInfo returns info about a connection
@@ -731,32 +1298,64 @@ func (c *Connection) GetConnectionInfo() ConnectionInfo {
 	defer c.mu.RUnlock()
 
 	var duration time.Duration
-	if c.Status == StatusActive {
+	if c.Status == StatusActive || c.Status == StatusDegraded || c.Status == StatusListening {
 		duration = time.Since(c.StartedAt)
 	} else if !c.StoppedAt.IsZero() {
 		duration = c.StoppedAt.Sub(c.StartedAt)
 	}
 
 	return ConnectionInfo{
-		ID:           c.ID,
-		Namespace:    c.Namespace,
-		ResourceType: c.ResourceType,
-		ResourceName: c.ResourceName,
-		LocalPort:    c.LocalPort,
-		RemotePort:   c.RemotePort,
-		Status:       c.Status,
-		Error:        c.Error,
-		Duration:     duration,
+		ID:             c.ID,
+		Context:        c.Context,
+		Namespace:      c.Namespace,
+		ResourceType:   c.ResourceType,
+		ResourceName:   c.ResourceName,
+		PodName:        c.PodName,
+		LocalPort:      c.LocalPort,
+		RemotePort:     c.RemotePort,
+		Ports:          append([]PortMapping(nil), c.Ports...),
+		Addresses:      append([]string(nil), c.Addresses...),
+		SocketPath:     c.SocketPath,
+		Balance:        c.Balance,
+		Backends:       append([]string(nil), c.Backends...),
+		Probe:          c.Probe,
+		ProbeFailures:  c.ProbeFailures,
+		ProbeError:     c.ProbeError,
+		Lazy:           c.Lazy,
+		IdleTimeout:    c.IdleTimeout,
+		Routes:         append([]Route(nil), c.Routes...),
+		TLS:            c.TLS,
+		Faults:         c.Faults,
+		Limits:         c.Limits,
+		Recording:      c.recordingInfo(),
+		Status:         c.Status,
+		Error:          c.Error,
+		Duration:       duration,
+		ReconnectCount: c.ReconnectCount,
+		Metrics:        c.metrics.snapshot(),
 	}
 }
 
 // SavedConnectionInfo represents connection info for saving
 type SavedConnectionInfo struct {
+	Context      string // kube context, also when it is the default one
 	Namespace    string
 	ResourceType string
 	ResourceName string
 	LocalPort    int
 	RemotePort   int
+	Ports        []string // "local:remote" for each mapping when there's more than one, or a named one
+	Addresses    []string // bind addresses unless they're the defaults
+	SocketPath   string
+	SocketMode   string // octal, set with SocketPath
+	Balance      string
+	Probe        *Probe
+	Lazy         bool
+	IdleTimeout  time.Duration
+	Routes       []string // routers only, in the form accepted by ParseRoute
+	TLS          *TLSOptions
+	Faults       *Faults
+	Limits       *Limits
 	WasActive    bool
 }
 
@@ -768,13 +1367,42 @@ func (m *Manager) GetAllConnectionsForSave() []SavedConnectionInfo {
 	result := make([]SavedConnectionInfo, 0)
 	for _, conn := range m.connections {
 		conn.mu.RLock()
+		var ports []string
+		if len(conn.Ports) > 1 || conn.Ports[0].RemoteName != "" {
+			ports = PortMappingStrings(conn.Ports)
+		}
+		var addresses []string
+		if !isDefaultAddresses(conn.Addresses) {
+			addresses = append(addresses, conn.Addresses...)
+		}
+		var socketMode string
+		if conn.SocketPath != "" {
+			socketMode = FormatSocketMode(conn.SocketMode)
+		}
+		var routes []string
+		if len(conn.Routes) > 0 {
+			routes = RouteStrings(conn.Routes)
+		}
 		result = append(result, SavedConnectionInfo{
+			Context:      m.clients.name(conn.Context),
 			Namespace:    conn.Namespace,
 			ResourceType: string(conn.ResourceType),
 			ResourceName: conn.ResourceName,
 			LocalPort:    conn.LocalPort,
 			RemotePort:   conn.RemotePort,
-			WasActive:    conn.Status == StatusActive,
+			Ports:        ports,
+			Addresses:    addresses,
+			SocketPath:   conn.SocketPath,
+			SocketMode:   socketMode,
+			Balance:      string(conn.Balance),
+			Probe:        conn.Probe,
+			Lazy:         conn.Lazy,
+			IdleTimeout:  conn.IdleTimeout,
+			Routes:       routes,
+			TLS:          conn.TLS,
+			Faults:       conn.Faults,
+			Limits:       conn.Limits,
+			WasActive:    conn.Status.IsRunning() && conn.Status != StatusStarting,
 		})
 		conn.mu.RUnlock()
 	}
@@ -782,28 +1410,61 @@ func (m *Manager) GetAllConnectionsForSave() []SavedConnectionInfo {
 }
 
 // AddStoppedConnection adds a connection in stopped state (for restoring from state)
-func (m *Manager) AddStoppedConnection(namespace string, resourceType ResourceType, resourceName string, localPort, remotePort int) {
-	prefix := "pod"
-	if resourceType == ResourceService {
-		prefix = "svc"
+func (m *Manager) AddStoppedConnection(opts ForwardOptions) {
+	opts.Context = m.clients.normalize(opts.Context)
+	if opts.ResourceType == ResourceRouter {
+		opts.Ports = routerPorts(opts.PortMappings())
+	}
+	id := ConnectionID(opts)
+	ports := opts.PortMappings()
+	addresses, err := ParseAddresses(opts.Addresses)
+	if err != nil {
+		addresses = append([]string(nil), DefaultAddresses...)
+	}
+	if opts.SocketPath != "" {
+		if opts.SocketMode == 0 {
+			opts.SocketMode = DefaultSocketMode
+		}
+		// A socket file left behind by a crash would block the next start
+		if err := removeStaleSocket(opts.SocketPath); err != nil {
+			logger.Warn("portforward", "Stale socket check for %s: %v", opts.SocketPath, err)
+		}
+	}
+	if opts.Probe != nil {
+		probe := opts.Probe.normalize()
+		opts.Probe = &probe
+	}
+	if opts.Lazy && opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
 	}
-	id := fmt.Sprintf("%s/%s/%s:%d->%d", namespace, prefix, resourceName, localPort, remotePort)
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Don't add if already exists
 	if _, ok := m.connections[id]; ok {
+		m.mu.Unlock()
 		return
 	}
 
 	conn := &Connection{
 		ID:            id,
-		Namespace:     namespace,
-		ResourceType:  resourceType,
-		ResourceName:  resourceName,
-		LocalPort:     localPort,
-		RemotePort:    remotePort,
+		Context:       opts.Context,
+		Namespace:     opts.Namespace,
+		ResourceType:  opts.ResourceType,
+		ResourceName:  opts.ResourceName,
+		LocalPort:     ports[0].Local,
+		RemotePort:    ports[0].Remote,
+		Ports:         ports,
+		Addresses:     addresses,
+		SocketPath:    opts.SocketPath,
+		SocketMode:    opts.SocketMode,
+		Balance:       opts.Balance,
+		Probe:         opts.Probe,
+		Lazy:          opts.Lazy,
+		IdleTimeout:   opts.IdleTimeout,
+		Routes:        append([]Route(nil), opts.Routes...),
+		TLS:           opts.TLS,
+		Faults:        opts.Faults,
+		Limits:        opts.Limits,
 		Status:        StatusStopped,
 		StartedAt:     time.Now(),
 		StoppedAt:     time.Now(),
@@ -816,21 +1477,22 @@ func (m *Manager) AddStoppedConnection(namespace string, resourceType ResourceTy
 
 	conn.AddLog("Restored from previous session (stopped)")
 	m.connections[id] = conn
+	m.mu.Unlock()
+	m.publishAdded(conn)
 }
 
 // DeleteConnection completely removes a connection from manager
 func (m *Manager) DeleteConnection(id string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	conn, ok := m.connections[id]
 	if !ok {
+		m.mu.Unlock()
 		return fmt.Errorf("connection not found: %s", id)
 	}
 
 	// Stop if running
 	conn.mu.Lock()
-	if conn.Status == StatusActive || conn.Status == StatusStarting {
+	if conn.Status.IsRunning() {
 		conn.Status = StatusStopped
 		conn.StoppedAt = time.Now()
 	}
@@ -845,5 +1507,8 @@ func (m *Manager) DeleteConnection(id string) error {
 	})
 
 	delete(m.connections, id)
+	m.mu.Unlock()
+	conn.stopRecording()
+	m.publishRemoved(conn)
 	return nil
 }
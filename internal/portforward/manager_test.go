@@ -0,0 +1,624 @@
+package portforward_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+const namespace = "default"
+
+// newTestManager returns a manager backed by a fake clientset holding objects
+// and a fake dialer with fast reconnects
+func newTestManager(t *testing.T, objects ...runtime.Object) (*portforward.Manager, *portforwardtest.Dialer) {
+	t.Helper()
+	m, dialer, _ := newTestCluster(t, objects...)
+	return m, dialer
+}
+
+// newTestCluster is newTestManager that also returns the fake clientset, for
+// tests that change the cluster while forwards run
+func newTestCluster(t *testing.T, objects ...runtime.Object) (*portforward.Manager, *portforwardtest.Dialer, *fake.Clientset) {
+	t.Helper()
+	dialer := portforwardtest.NewDialer()
+	clientset := fake.NewSimpleClientset(objects...)
+	m := portforward.NewManager(clientset, &rest.Config{})
+	m.SetDialer(dialer)
+	m.SetReconnectPolicy(portforward.ReconnectPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+		MaxAttempts:  5,
+	})
+	t.Cleanup(func() {
+		m.StopAll()
+		dialer.Close()
+	})
+	return m, dialer, clientset
+}
+
+// runningPod returns a ready pod with one container exposing ports
+func runningPod(name string, labels map[string]string, ports ...corev1.ContainerPort) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Ports: ports}},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+// forwardPod builds options for a forward from a free local port to a pod port
+func forwardPod(pod string, remote int) portforward.ForwardOptions {
+	return portforward.ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: portforward.ResourcePod,
+		ResourceName: pod,
+		Ports:        []portforward.PortMapping{{Remote: remote}},
+	}
+}
+
+// startEchoForward starts a forward to port 5432 of an echo pod, with its
+// options adjusted by configure
+func startEchoForward(t *testing.T, configure func(*portforward.ForwardOptions)) (*portforward.Manager, *portforward.Connection) {
+	t.Helper()
+	m, dialer := newTestManager(t, runningPod("db-0", nil))
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	opts := forwardPod("db-0", 5432)
+	configure(&opts)
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return m, conn
+}
+
+// localAddr returns the address the connection's first mapping listens on
+func localAddr(conn *portforward.Connection) string {
+	info := conn.GetConnectionInfo()
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(info.Ports[0].Local))
+}
+
+// roundTrip sends msg through the forward and returns what came back
+func roundTrip(t *testing.T, addr, msg string) string {
+	t.Helper()
+	c, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(c, msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	c.(*net.TCPConn).CloseWrite()
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(got)
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartForwardsToPod(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil, corev1.ContainerPort{ContainerPort: 80}))
+	if err := dialer.EchoPod(namespace, "web", 80); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	info := conn.GetConnectionInfo()
+	if info.Status != portforward.StatusActive {
+		t.Errorf("status = %s, want active", info.Status)
+	}
+	if info.Ports[0].Local == 0 {
+		t.Error("no local port was picked")
+	}
+	if info.PodName != "web" {
+		t.Errorf("pod = %q, want web", info.PodName)
+	}
+
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("echo = %q, want hello", got)
+	}
+	waitFor(t, "connection to close", func() bool { return conn.GetMetrics().OpenConns == 0 })
+	metrics := conn.GetMetrics()
+	if metrics.TotalConns != 1 || metrics.BytesSent != 5 || metrics.BytesReceived != 5 {
+		t.Errorf("metrics = %+v, want 1 connection and 5 bytes each way", metrics)
+	}
+}
+
+func TestStopClosesLocalPort(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	addr := localAddr(conn)
+
+	if err := m.StopPortForward(conn.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if status := conn.GetConnectionInfo().Status; status != portforward.StatusStopped {
+		t.Errorf("status = %s, want stopped", status)
+	}
+	waitFor(t, "local port to close", func() bool {
+		c, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return true
+		}
+		c.Close()
+		return false
+	})
+
+	// A stopped connection can be started again
+	conn, err = m.StartWithOptions(context.Background(), conn.Options())
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if got := roundTrip(t, localAddr(conn), "again"); got != "again" {
+		t.Errorf("echo = %q, want again", got)
+	}
+}
+
+func TestConnectionOutlivesStartContext(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := m.StartWithOptions(ctx, forwardPod("web", 80))
+	cancel()
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got := roundTrip(t, localAddr(conn), "still"); got != "still" {
+		t.Errorf("echo = %q, want still", got)
+	}
+	if status := conn.GetConnectionInfo().Status; status != portforward.StatusActive {
+		t.Errorf("status = %s, want active", status)
+	}
+}
+
+func TestStartTwiceFails(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := m.StartWithOptions(context.Background(), conn.Options()); err == nil || !strings.Contains(err.Error(), "already active") {
+		t.Errorf("second start error = %v, want already active", err)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	pending := runningPod("pending", nil)
+	pending.Status.Phase = corev1.PodPending
+
+	tests := []struct {
+		name    string
+		opts    portforward.ForwardOptions
+		setup   func(*portforwardtest.Dialer)
+		wantErr string
+	}{
+		{
+			name:    "pod not found",
+			opts:    forwardPod("missing", 80),
+			wantErr: "not found",
+		},
+		{
+			name:    "pod not running",
+			opts:    forwardPod("pending", 80),
+			wantErr: "pod is not running: Pending",
+		},
+		{
+			name: "unknown named port",
+			opts: portforward.ForwardOptions{
+				Namespace:    namespace,
+				ResourceType: portforward.ResourcePod,
+				ResourceName: "web",
+				Ports:        []portforward.PortMapping{{RemoteName: "metrics"}},
+			},
+			wantErr: "metrics",
+		},
+		{
+			name: "dial fails",
+			opts: forwardPod("web", 80),
+			setup: func(d *portforwardtest.Dialer) {
+				d.FailPod(namespace, "web", errors.New("upgrade refused"))
+			},
+			wantErr: "upgrade refused",
+		},
+		{
+			name:    "service not found",
+			opts:    forwardService("missing", 80),
+			wantErr: "not found",
+		},
+		{
+			name: "unknown kube context",
+			opts: func() portforward.ForwardOptions {
+				opts := forwardPod("web", 80)
+				opts.Context = "nope"
+				return opts
+			}(),
+			wantErr: `unknown kube context "nope"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, dialer := newTestManager(t, runningPod("web", nil), pending)
+			if tt.setup != nil {
+				tt.setup(dialer)
+			}
+
+			_, err := m.StartWithOptions(context.Background(), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			for _, conn := range m.GetConnections() {
+				if status := conn.GetConnectionInfo().Status; status != portforward.StatusError {
+					t.Errorf("status = %s, want error", status)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoPortReleasedOnFailedStart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.FailPod(namespace, "web", errors.New("upgrade refused"))
+	opts := forwardPod("web", 80)
+	opts.PortRange = portforward.PortRange{Min: port, Max: port}
+	if _, err := m.StartWithOptions(context.Background(), opts); err == nil {
+		t.Fatal("start succeeded")
+	}
+
+	// The port bound while allocating it is free again
+	l, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("port %d still taken: %v", port, err)
+	}
+	l.Close()
+}
+
+func TestReconnectsAfterTunnelDrop(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	dialer.DropPod(namespace, "web")
+	waitFor(t, "reconnect", func() bool {
+		info := conn.GetConnectionInfo()
+		return info.Status == portforward.StatusActive && info.ReconnectCount == 1
+	})
+	if dials := dialer.Dials(namespace, "web"); dials != 2 {
+		t.Errorf("dials = %d, want 2", dials)
+	}
+	if got := roundTrip(t, localAddr(conn), "back"); got != "back" {
+		t.Errorf("echo = %q, want back", got)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	none := 0.0
+	p := portforward.ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 3, Jitter: &none}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 300 * time.Millisecond, 3: 900 * time.Millisecond, 4: time.Second} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("attempt %d without jitter: %s, want %s", attempt, got, want)
+		}
+	}
+
+	half := 0.5
+	p.Jitter = &half
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 150*time.Millisecond || got > 450*time.Millisecond {
+			t.Fatalf("attempt 2 with 50%% jitter: %s", got)
+		}
+	}
+}
+
+func TestSocketForward(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.sock")
+	m, conn := startEchoForward(t, func(opts *portforward.ForwardOptions) {
+		opts.SocketPath = path
+		opts.SocketMode = 0660
+	})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %s", info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files next to the socket, want none", len(entries)-1)
+	}
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(c, "ping")
+	c.(*net.UnixConn).CloseWrite()
+	if got, _ := io.ReadAll(c); string(got) != "ping" {
+		t.Errorf("echo = %q", got)
+	}
+	c.Close()
+
+	m.StopPortForward(conn.ID)
+	waitFor(t, "socket removal", func() bool {
+		_, err := os.Stat(path)
+		return os.IsNotExist(err)
+	})
+}
+
+func TestSocketLeavesReplacedFileAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sock")
+	m, conn := startEchoForward(t, func(opts *portforward.ForwardOptions) {
+		opts.SocketPath = path
+	})
+
+	// Another listener takes over the path before the forward stops
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	other, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	m.StopPortForward(conn.ID)
+	waitFor(t, "forward to stop", func() bool {
+		return conn.GetConnectionInfo().Status == portforward.StatusStopped
+	})
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the other listener's socket was removed: %v", err)
+	}
+}
+
+func TestForwardsInOtherContexts(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+	dialer.EchoPod(namespace, "staging-only", 80)
+	staging := fake.NewSimpleClientset(runningPod("web", nil), runningPod("staging-only", nil))
+	m.SetClientFactory(func(kubeContext string) (kubernetes.Interface, *rest.Config, error) {
+		if kubeContext != "staging" {
+			return nil, nil, fmt.Errorf("context %q not in kubeconfig", kubeContext)
+		}
+		return staging, &rest.Config{}, nil
+	})
+
+	// The same target in two clusters is two connections
+	local, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start in default context: %v", err)
+	}
+	opts := forwardPod("web", 80)
+	opts.Context = "staging"
+	remote, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start in staging: %v", err)
+	}
+	if local.ID == remote.ID {
+		t.Fatalf("both connections have ID %s", local.ID)
+	}
+	if !strings.HasSuffix(remote.ID, "@staging") {
+		t.Errorf("ID = %s, want it to end in @staging", remote.ID)
+	}
+	if info := remote.GetConnectionInfo(); info.Context != "staging" {
+		t.Errorf("context = %q, want staging", info.Context)
+	}
+	if got := roundTrip(t, localAddr(remote), "staging"); got != "staging" {
+		t.Errorf("echo = %q, want staging", got)
+	}
+
+	// Pods are looked up in the forward's own cluster
+	opts = forwardPod("staging-only", 80)
+	if _, err := m.StartWithOptions(context.Background(), opts); err == nil {
+		t.Error("found a staging pod in the default context")
+	}
+	opts.Context = "staging"
+	if _, err := m.StartWithOptions(context.Background(), opts); err != nil {
+		t.Errorf("start staging-only pod in staging: %v", err)
+	}
+
+	opts.Context = "prod"
+	if _, err := m.StartWithOptions(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "not in kubeconfig") {
+		t.Errorf("error = %v, want the factory's error", err)
+	}
+}
+
+func TestDefaultContextByName(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web", nil))
+	dialer.EchoPod(namespace, "web", 80)
+	m.SetDefaultContext("dev")
+
+	// Naming the default context uses the default clients, no factory needed
+	opts := forwardPod("web", 80)
+	opts.Context = "dev"
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if info := conn.GetConnectionInfo(); info.Context != "" || strings.Contains(info.ID, "@") {
+		t.Errorf("connection %s in context %q, want the default one", info.ID, info.Context)
+	}
+
+	// Saved connections remember the context they ran in
+	saved := m.GetAllConnectionsForSave()
+	if len(saved) != 1 || saved[0].Context != "dev" {
+		t.Errorf("saved = %+v, want one connection in context dev", saved)
+	}
+}
+
+// webService returns a service selecting app=web whose port 80 targets the
+// named container port "http"
+func webService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("http"),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
+
+// endpointSlice returns the service's EndpointSlice with port http on 8080
+func endpointSlice(ready map[string]bool) *discoveryv1.EndpointSlice {
+	name, port, protocol := "http", int32(8080), corev1.ProtocolTCP
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-abcde",
+			Namespace: namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &name, Port: &port, Protocol: &protocol}},
+	}
+	for pod, isReady := range ready {
+		isReady := isReady
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &isReady},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: namespace},
+		})
+	}
+	return slice
+}
+
+// forwardService builds options for a forward from a free local port to a service port
+func forwardService(service string, remote int) portforward.ForwardOptions {
+	return portforward.ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: portforward.ResourceService,
+		ResourceName: service,
+		Ports:        []portforward.PortMapping{{Remote: remote}},
+	}
+}
+
+func TestServiceForwardsToReadyPod(t *testing.T) {
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	labels := map[string]string{"app": "web"}
+	m, dialer := newTestManager(t,
+		webService(),
+		runningPod("web-a", labels, httpPort),
+		runningPod("web-b", labels, httpPort),
+		endpointSlice(map[string]bool{"web-a": false, "web-b": true}),
+	)
+	dialer.EchoPod(namespace, "web-a", 8080)
+	dialer.EchoPod(namespace, "web-b", 8080)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardService("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if pod := conn.GetConnectionInfo().PodName; pod != "web-b" {
+		t.Errorf("pod = %q, want the ready pod web-b", pod)
+	}
+	if dialer.Dials(namespace, "web-a") != 0 {
+		t.Error("dialed the unready pod")
+	}
+	if got := roundTrip(t, localAddr(conn), "svc"); got != "svc" {
+		t.Errorf("echo = %q, want svc", got)
+	}
+}
+
+func TestServiceWithoutReadyPods(t *testing.T) {
+	m, _ := newTestManager(t,
+		webService(),
+		runningPod("web-a", map[string]string{"app": "web"}),
+		endpointSlice(map[string]bool{"web-a": false}),
+	)
+
+	_, err := m.StartWithOptions(context.Background(), forwardService("web", 80))
+	if err == nil || !strings.Contains(err.Error(), "no ready endpoints") {
+		t.Fatalf("error = %v, want no ready endpoints", err)
+	}
+}
+
+func TestPodPortRefused(t *testing.T) {
+	m, _ := newTestManager(t, runningPod("web", nil))
+
+	// Nothing serves port 80, so the tunnel comes up but the client is cut off
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	c, err := net.DialTimeout("tcp", localAddr(conn), 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(c, "anyone?")
+	// The client is closed unread, which may reach it as a reset
+	if got, _ := io.ReadAll(c); len(got) != 0 {
+		t.Errorf("got %q from a closed port", got)
+	}
+	waitFor(t, "the error to be counted", func() bool { return conn.GetMetrics().Errors == 1 })
+}
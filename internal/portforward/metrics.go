@@ -0,0 +1,202 @@
+package portforward
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is a snapshot of a connection's traffic counters. They add up over
+// reconnects and start from zero when the forward is started again.
+type Metrics struct {
+	BytesSent     int64     // local clients -> pod
+	BytesReceived int64     // pod -> local clients
+	OpenConns     int64     // client connections being forwarded right now
+	TotalConns    int64     // client connections accepted so far
+	Errors        int64     // client connections that failed or were refused
+	LastActivity  time.Time // last accepted connection or transferred data; zero if none
+}
+
+// connMetrics holds the live counters behind Metrics. They're updated from
+// the forwarding goroutines without taking the connection lock.
+type connMetrics struct {
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	open          atomic.Int64
+	total         atomic.Int64
+	errors        atomic.Int64
+	lastActivity  atomic.Int64 // unix nanoseconds
+}
+
+func (m *connMetrics) touch() {
+	m.lastActivity.Store(time.Now().UnixNano())
+}
+
+// opened records an accepted client connection
+func (m *connMetrics) opened() {
+	m.open.Add(1)
+	m.total.Add(1)
+	m.touch()
+}
+
+// closed records the end of a client connection
+func (m *connMetrics) closed() {
+	m.open.Add(-1)
+	m.touch()
+}
+
+// refused records a client connection that was accepted and closed right
+// away without being forwarded
+func (m *connMetrics) refused() {
+	m.total.Add(1)
+	m.errors.Add(1)
+	m.touch()
+}
+
+func (m *connMetrics) snapshot() Metrics {
+	s := Metrics{
+		BytesSent:     m.bytesSent.Load(),
+		BytesReceived: m.bytesReceived.Load(),
+		OpenConns:     m.open.Load(),
+		TotalConns:    m.total.Load(),
+		Errors:        m.errors.Load(),
+	}
+	if last := m.lastActivity.Load(); last != 0 {
+		s.LastActivity = time.Unix(0, last)
+	}
+	return s
+}
+
+// meteredConn counts the bytes flowing through a local client connection
+type meteredConn struct {
+	net.Conn
+	metrics *connMetrics
+}
+
+// Read counts data the client sends towards the pod
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.metrics.bytesSent.Add(int64(n))
+		c.metrics.touch()
+	}
+	return n, err
+}
+
+// Write counts data the pod sends back to the client
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.metrics.bytesReceived.Add(int64(n))
+		c.metrics.touch()
+	}
+	return n, err
+}
+
+// GetMetrics returns the connection's traffic counters
+func (c *Connection) GetMetrics() Metrics {
+	return c.metrics.snapshot()
+}
+
+// serveClient forwards one local client connection through t to the pod
+// port of mapping i and accounts for it in the connection's metrics
+func (c *Connection) serveClient(client net.Conn, t *tunnel, i int) {
+	release, ok := c.acquire(client)
+	if !ok {
+		return
+	}
+	defer release()
+	c.metrics.opened()
+	defer c.metrics.closed()
+
+	if tc, ok := client.(*tls.Conn); ok {
+		if err := handshake(tc); err != nil {
+			client.Close()
+			c.metrics.errors.Add(1)
+			c.AddLog(fmt.Sprintf("✗ TLS handshake with %s: %v", client.RemoteAddr(), err))
+			return
+		}
+	}
+
+	admitted, stalled := c.admit(client)
+	if stalled {
+		c.stall(client)
+		return
+	}
+	if admitted == nil {
+		return
+	}
+	client = c.limit(admitted)
+	local := &meteredConn{Conn: c.record(client, fmt.Sprintf("%s:%d", t.pod, t.ports[i])), metrics: &c.metrics}
+	if err := c.forward(local, t, i); err != nil {
+		c.metrics.errors.Add(1)
+		c.AddLog(fmt.Sprintf("✗ %s: %v", t.pod, err))
+	}
+}
+
+// forward copies client through t to the pod port of mapping i,
+// originating TLS first if the connection asks for it
+func (c *Connection) forward(client net.Conn, t *tunnel, i int) error {
+	if c.TLS != nil && c.TLS.Mode == TLSOriginate {
+		return handleOriginTLS(client, t, i, c.tlsConfig)
+	}
+	return t.handle(client, i)
+}
+
+// FormatBytes formats a byte count for display ("512 B", "1.5 MB")
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseBytes parses a byte count such as "512", "64KB", "1.5M" or "2GiB";
+// units are powers of 1024 like in FormatBytes
+func ParseBytes(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	number := strings.TrimRight(value, "BIKMGT ")
+	multiplier := int64(1)
+	switch unit := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(value[len(number):]), "B"), "I"); unit {
+	case "":
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	default:
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize formats a byte count exactly, in the largest unit that divides
+// it ("64KB", "1536"), so ParseBytes reads it back unchanged
+func FormatSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n != 0 && n%unit.size == 0 {
+			return strconv.FormatInt(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
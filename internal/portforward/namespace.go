@@ -0,0 +1,266 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// ConflictStrategy says how a planned local port that is taken gets replaced
+type ConflictStrategy string
+
+const (
+	ConflictOffset ConflictStrategy = "offset" // add the conflict offset until a free port is found
+	ConflictAuto   ConflictStrategy = "auto"   // pick a free port like "-l auto"
+)
+
+// DefaultConflictOffset is added to a taken local port with ConflictOffset,
+// so that port 80 becomes 1080, then 2080
+const DefaultConflictOffset = 1000
+
+// ParseConflictStrategy parses a conflict strategy; empty means offset
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch c := ConflictStrategy(strings.ToLower(strings.TrimSpace(s))); c {
+	case "", ConflictOffset:
+		return ConflictOffset, nil
+	case ConflictAuto:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy %q (use offset or auto)", s)
+	}
+}
+
+// NamespaceOptions selects the services of a namespace to forward and how
+// their local ports are assigned
+type NamespaceOptions struct {
+	Context        string
+	Namespace      string
+	Selector       string           // label selector, all services if empty
+	PortOffset     int              // local port = service port + PortOffset
+	Conflict       ConflictStrategy // how taken local ports are replaced
+	ConflictOffset int              // step for ConflictOffset, DefaultConflictOffset if 0
+	PortRange      PortRange        // where ConflictAuto picks ports from; any free port if zero
+	Addresses      []string         // local bind addresses, DefaultAddresses if empty
+
+	// LoopbackAliases binds every service to its own 127.x.y.z address
+	// instead of Addresses, so all services can keep their own ports
+	LoopbackAliases bool
+}
+
+// PlannedPort is one service port of a namespace plan
+type PlannedPort struct {
+	Name      string // service port name, may be empty
+	Remote    int    // service port
+	Local     int    // assigned local port
+	Preferred int    // local port wanted before conflicts were resolved
+}
+
+// ServicePlan is the forward planned for one service
+type ServicePlan struct {
+	Service string
+	Address string // loopback alias with LoopbackAliases
+	Ports   []PlannedPort
+	Options ForwardOptions // ready for StartWithOptions
+}
+
+// NamespacePlan is the set of forwards for the services of a namespace
+type NamespacePlan struct {
+	Namespace string
+	Services  []ServicePlan // sorted by service name
+	Skipped   []string      // services that can't be forwarded, with the reason
+}
+
+// PlanNamespace lists the services of a namespace and assigns every TCP
+// service port a local port. The assignment only depends on the services and
+// on which ports are taken: services are taken in name order, each port
+// prefers its own number plus PortOffset and is moved by opts.Conflict when
+// that port is used by another forward or can't be bound.
+func (m *Manager) PlanNamespace(ctx context.Context, opts NamespaceOptions) (*NamespacePlan, error) {
+	if opts.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if _, err := labels.Parse(opts.Selector); err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", opts.Selector, err)
+	}
+	if _, err := ParseConflictStrategy(string(opts.Conflict)); err != nil {
+		return nil, err
+	}
+	if opts.ConflictOffset <= 0 {
+		opts.ConflictOffset = DefaultConflictOffset
+	}
+	addresses, err := ParseAddresses(opts.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	if opts.LoopbackAliases {
+		if len(opts.Addresses) > 0 {
+			return nil, fmt.Errorf("loopback aliases can't be combined with bind addresses")
+		}
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("loopback aliases need Linux, where all of 127.0.0.0/8 is local")
+		}
+	}
+
+	opts.Context = m.clients.normalize(opts.Context)
+	cl, err := m.clients.get(opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	list, err := cl.clientset.CoreV1().Services(opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	services := list.Items
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	m.mu.RLock()
+	used := make(map[int]bool)
+	for _, conn := range m.connections {
+		conn.mu.RLock()
+		if conn.Status.IsRunning() {
+			for _, p := range conn.Ports {
+				used[p.Local] = true
+			}
+		}
+		conn.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+
+	plan := &NamespacePlan{Namespace: opts.Namespace}
+	aliases := make(map[string]bool)
+	for _, svc := range services {
+		if reason := unforwardableService(&svc); reason != "" {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: %s", svc.Name, reason))
+			continue
+		}
+
+		sp := ServicePlan{Service: svc.Name}
+		svcAddresses, svcUsed := addresses, used
+		if opts.LoopbackAliases {
+			// Ports only have to be free on the service's own address
+			sp.Address = loopbackAlias(m.clients.name(opts.Context), opts.Namespace, svc.Name, aliases)
+			svcAddresses, svcUsed = []string{sp.Address}, make(map[int]bool)
+		}
+		var mappings []PortMapping
+		for _, port := range svc.Spec.Ports {
+			if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+				continue
+			}
+			pp := PlannedPort{Name: port.Name, Remote: int(port.Port), Preferred: int(port.Port) + opts.PortOffset}
+			if pp.Local, err = pickPlannedPort(pp.Preferred, opts, svcUsed, svcAddresses); err != nil {
+				return nil, fmt.Errorf("service %s port %d: %w", svc.Name, port.Port, err)
+			}
+			svcUsed[pp.Local] = true
+			sp.Ports = append(sp.Ports, pp)
+			mappings = append(mappings, PortMapping{Local: pp.Local, Remote: pp.Remote})
+		}
+		if len(mappings) == 0 {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: no TCP ports", svc.Name))
+			continue
+		}
+
+		sp.Options = ForwardOptions{
+			Context:      opts.Context,
+			Namespace:    opts.Namespace,
+			ResourceType: ResourceService,
+			ResourceName: svc.Name,
+			LocalPort:    mappings[0].Local,
+			RemotePort:   mappings[0].Remote,
+			Ports:        mappings,
+			Addresses:    svcAddresses,
+		}
+		plan.Services = append(plan.Services, sp)
+	}
+
+	logger.Info("portforward", "Planned %d service forwards in %s (%d skipped)", len(plan.Services), opts.Namespace, len(plan.Skipped))
+	return plan, nil
+}
+
+// unforwardableService returns why a service has no pods to forward to, or ""
+func unforwardableService(svc *corev1.Service) string {
+	switch {
+	case svc.Spec.Type == corev1.ServiceTypeExternalName:
+		return "ExternalName service"
+	case len(svc.Spec.Selector) == 0:
+		return "no pod selector"
+	}
+	return ""
+}
+
+// loopbackAliasCount is the number of addresses in 127.1.0.1-127.254.255.254,
+// leaving out 127.0.x.x and the .0 and .255 host bytes
+const loopbackAliasCount = 254 * 256 * 254
+
+// loopbackAlias returns the loopback address of a service. It's derived from
+// the service's name so it stays the same between runs; collisions within a
+// plan move on to the next address.
+func loopbackAlias(kubeContext, namespace, service string, taken map[string]bool) string {
+	h := fnv.New32a()
+	h.Write([]byte(kubeContext + "/" + namespace + "/" + service))
+	n := h.Sum32() % loopbackAliasCount
+	for {
+		ip := net.IPv4(127, byte(1+n/(256*254)), byte(n/254%256), byte(1+n%254)).String()
+		if !taken[ip] {
+			taken[ip] = true
+			return ip
+		}
+		n = (n + 1) % loopbackAliasCount
+	}
+}
+
+// ServiceHostnames returns the names a service is reachable by inside the
+// cluster: "svc", "svc.ns", "svc.ns.svc" and "svc.ns.svc.<clusterDomain>"
+func ServiceHostnames(service, namespace, clusterDomain string) []string {
+	names := []string{service, service + "." + namespace, service + "." + namespace + ".svc"}
+	if clusterDomain != "" {
+		names = append(names, service+"."+namespace+".svc."+clusterDomain)
+	}
+	return names
+}
+
+// pickPlannedPort returns preferred if it's free, or its replacement
+func pickPlannedPort(preferred int, opts NamespaceOptions, used map[int]bool, addresses []string) (int, error) {
+	free := func(port int) bool {
+		return port > 0 && port <= 65535 && !used[port] && canBind(addresses, port)
+	}
+	if free(preferred) {
+		return preferred, nil
+	}
+
+	if opts.Conflict == ConflictAuto {
+		return freeLocalPort(opts.PortRange, used, addresses)
+	}
+	for port := preferred + opts.ConflictOffset; port <= 65535; port += opts.ConflictOffset {
+		if free(port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free local port for %d in steps of %d", preferred, opts.ConflictOffset)
+}
+
+// StartPlan starts the forwards of a namespace plan side by side. The
+// returned errors line up with plan.Services; nil means started.
+func (m *Manager) StartPlan(ctx context.Context, plan *NamespacePlan) []error {
+	errs := make([]error, len(plan.Services))
+	var wg sync.WaitGroup
+	for i, sp := range plan.Services {
+		wg.Add(1)
+		go func(i int, opts ForwardOptions) {
+			defer wg.Done()
+			_, errs[i] = m.StartWithOptions(ctx, opts)
+		}(i, sp.Options)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,171 @@
+package portforward_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// portOffset moves planned ports far away from the usual ones
+const portOffset = 40000
+
+// service returns a service selecting app=name with the given TCP ports
+func service(name string, labels map[string]string, ports ...int32) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": name}},
+	}
+	for _, p := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Port: p, Protocol: corev1.ProtocolTCP})
+	}
+	return svc
+}
+
+// plannedPorts returns "service:local->remote" for every planned port
+func plannedPorts(plan *portforward.NamespacePlan) []string {
+	var result []string
+	for _, sp := range plan.Services {
+		for _, p := range sp.Ports {
+			result = append(result, sp.Service+":"+strconv.Itoa(p.Local)+"->"+strconv.Itoa(p.Remote))
+		}
+	}
+	return result
+}
+
+func TestPlanNamespace(t *testing.T) {
+	api := service("api", nil, 8080, 8081)
+	api.Spec.Ports = append(api.Spec.Ports, corev1.ServicePort{Port: 8082, Protocol: corev1.ProtocolUDP})
+	external := service("external", nil, 443)
+	external.Spec.Type = corev1.ServiceTypeExternalName
+	manual := service("manual", nil, 5432)
+	manual.Spec.Selector = nil
+	m, _ := newTestManager(t, service("web", nil, 80), api, external, manual)
+
+	// Something else already listens on api's second port
+	busy, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(8081+portOffset))
+	if err != nil {
+		t.Skipf("can't occupy the test port: %v", err)
+	}
+	defer busy.Close()
+
+	plan, err := m.PlanNamespace(context.Background(), portforward.NamespaceOptions{
+		Namespace:  namespace,
+		PortOffset: portOffset,
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	want := []string{"api:48080->8080", "api:49081->8081", "web:40080->80"}
+	if got := plannedPorts(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("ports = %v, want %v", got, want)
+	}
+	if len(plan.Skipped) != 2 || !strings.HasPrefix(plan.Skipped[0], "external") || !strings.HasPrefix(plan.Skipped[1], "manual") {
+		t.Errorf("skipped = %v, want external and manual", plan.Skipped)
+	}
+	if p := plan.Services[0].Ports[1]; p.Preferred != 48081 {
+		t.Errorf("preferred = %d, want 48081", p.Preferred)
+	}
+
+	// Auto picks any free port instead
+	plan, err = m.PlanNamespace(context.Background(), portforward.NamespaceOptions{
+		Namespace:  namespace,
+		PortOffset: portOffset,
+		Conflict:   portforward.ConflictAuto,
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if local := plan.Services[0].Ports[1].Local; local == 48081 || local == 49081 {
+		t.Errorf("auto picked %d", local)
+	}
+}
+
+func TestPlanNamespaceSelector(t *testing.T) {
+	m, _ := newTestManager(t,
+		service("web", map[string]string{"tier": "front"}, 80),
+		service("cache", map[string]string{"tier": "back"}, 6379),
+	)
+
+	plan, err := m.PlanNamespace(context.Background(), portforward.NamespaceOptions{
+		Namespace:  namespace,
+		Selector:   "tier=back",
+		PortOffset: portOffset,
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if got := plannedPorts(plan); !reflect.DeepEqual(got, []string{"cache:46379->6379"}) {
+		t.Errorf("ports = %v, want only cache", got)
+	}
+
+	if _, err := m.PlanNamespace(context.Background(), portforward.NamespaceOptions{Namespace: namespace, Selector: "tier in"}); err == nil {
+		t.Error("expected an error for a bad selector")
+	}
+}
+
+func TestStartPlan(t *testing.T) {
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	m, dialer := newTestManager(t,
+		webService(),
+		runningPod("web-a", map[string]string{"app": "web"}, httpPort),
+		endpointSlice(map[string]bool{"web-a": true}),
+	)
+	dialer.EchoPod(namespace, "web-a", 8080)
+
+	plan, err := m.PlanNamespace(context.Background(), portforward.NamespaceOptions{
+		Namespace:  namespace,
+		PortOffset: portOffset,
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	errs := m.StartPlan(context.Background(), plan)
+	if len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("errors = %v", errs)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(plan.Services[0].Ports[0].Local))
+	if got := roundTrip(t, addr, "all"); got != "all" {
+		t.Errorf("echo = %q, want all", got)
+	}
+}
+
+func TestPlanNamespaceLoopbackAliases(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("loopback aliases need Linux")
+	}
+	m, _ := newTestManager(t, service("web", nil, 80), service("api", nil, 80, 9090))
+
+	options := portforward.NamespaceOptions{Namespace: namespace, PortOffset: portOffset, LoopbackAliases: true}
+	plan, err := m.PlanNamespace(context.Background(), options)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	api, web := plan.Services[0], plan.Services[1]
+	if api.Address == web.Address || !strings.HasPrefix(api.Address, "127.") || api.Address == "127.0.0.1" {
+		t.Errorf("addresses = %s and %s, want two different loopback aliases", api.Address, web.Address)
+	}
+	// Both services get the same port on their own address
+	if api.Ports[0].Local != 40080 || web.Ports[0].Local != 40080 {
+		t.Errorf("local ports = %d and %d, want 40080", api.Ports[0].Local, web.Ports[0].Local)
+	}
+	if !reflect.DeepEqual(web.Options.Addresses, []string{web.Address}) {
+		t.Errorf("web binds %v", web.Options.Addresses)
+	}
+
+	again, err := m.PlanNamespace(context.Background(), options)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if again.Services[0].Address != api.Address || again.Services[1].Address != web.Address {
+		t.Error("aliases changed between plans")
+	}
+}
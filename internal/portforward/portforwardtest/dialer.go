@@ -0,0 +1,408 @@
+// Package portforwardtest provides a fake tunnel dialer so the port-forward
+// manager can be exercised without a cluster.
+package portforwardtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// TransportFake is the transport the fake dialer reports
+const TransportFake portforward.TransportMode = "fake"
+
+// Dialer is a portforward.TunnelDialer whose tunnels lead to local TCP
+// servers instead of pods. It speaks the same stream protocol as the
+// kubelet: every client connection gets an error and a data stream.
+type Dialer struct {
+	mu        sync.Mutex
+	routes    map[string]string // "namespace/pod:port" -> local address
+	failures  map[string]error  // "namespace/pod" -> dial error
+	blocked   map[string]chan struct{}
+	dials     map[string]int
+	sessions  map[string][]*session
+	listeners []net.Listener
+}
+
+// NewDialer returns a dialer without any routes
+func NewDialer() *Dialer {
+	return &Dialer{
+		routes:   make(map[string]string),
+		failures: make(map[string]error),
+		blocked:  make(map[string]chan struct{}),
+		dials:    make(map[string]int),
+		sessions: make(map[string][]*session),
+	}
+}
+
+func podKey(namespace, pod string) string {
+	return namespace + "/" + pod
+}
+
+// Route sends connections to port of a pod to a local address
+func (d *Dialer) Route(namespace, pod string, port int, addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes[podKey(namespace, pod)+":"+strconv.Itoa(port)] = addr
+}
+
+// EchoPod starts a TCP echo server for each port of a pod and routes the
+// port to it. The servers run until Close.
+func (d *Dialer) EchoPod(namespace, pod string, ports ...int) error {
+	for _, port := range ports {
+		addr, err := d.startEchoServer()
+		if err != nil {
+			return err
+		}
+		d.Route(namespace, pod, port, addr)
+	}
+	return nil
+}
+
+// startEchoServer listens on a free loopback port and writes back whatever
+// a client sends until it half-closes the connection
+func (d *Dialer) startEchoServer() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	d.listeners = append(d.listeners, l)
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String(), nil
+}
+
+// FailPod makes dials to a pod fail with err; nil lets them succeed again
+func (d *Dialer) FailPod(namespace, pod string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		delete(d.failures, podKey(namespace, pod))
+	} else {
+		d.failures[podKey(namespace, pod)] = err
+	}
+}
+
+// BlockPod makes dials to a pod hang until the returned function is called
+func (d *Dialer) BlockPod(namespace, pod string) (release func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	unblock := make(chan struct{})
+	d.blocked[podKey(namespace, pod)] = unblock
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			if d.blocked[podKey(namespace, pod)] == unblock {
+				delete(d.blocked, podKey(namespace, pod))
+			}
+			d.mu.Unlock()
+			close(unblock)
+		})
+	}
+}
+
+// DropPod closes all open tunnels to a pod, as if the connection to the
+// API server was lost
+func (d *Dialer) DropPod(namespace, pod string) {
+	d.mu.Lock()
+	sessions := d.sessions[podKey(namespace, pod)]
+	delete(d.sessions, podKey(namespace, pod))
+	d.mu.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+// Dials returns how many tunnels to a pod were dialed
+func (d *Dialer) Dials(namespace, pod string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials[podKey(namespace, pod)]
+}
+
+// Close stops the echo servers and closes all tunnels
+func (d *Dialer) Close() {
+	d.mu.Lock()
+	listeners := d.listeners
+	d.listeners = nil
+	var sessions []*session
+	for _, s := range d.sessions {
+		sessions = append(sessions, s...)
+	}
+	d.sessions = make(map[string][]*session)
+	d.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+// Dial implements portforward.TunnelDialer
+func (d *Dialer) Dial(namespace, pod string) (httpstream.Connection, portforward.TransportMode, error) {
+	key := podKey(namespace, pod)
+
+	d.mu.Lock()
+	d.dials[key]++
+	unblock := d.blocked[key]
+	d.mu.Unlock()
+	if unblock != nil {
+		<-unblock
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.failures[key]; err != nil {
+		return nil, TransportFake, err
+	}
+
+	s := &session{
+		dialer:       d,
+		pod:          key,
+		closeChan:    make(chan bool),
+		errorStreams: make(map[string]*errorStream),
+	}
+	d.sessions[key] = append(d.sessions[key], s)
+	return s, TransportFake, nil
+}
+
+// route returns the local address for port of a pod
+func (d *Dialer) route(pod, port string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	addr, ok := d.routes[pod+":"+port]
+	return addr, ok
+}
+
+// session is a fake port-forward session (httpstream.Connection)
+type session struct {
+	dialer    *Dialer
+	pod       string
+	closeOnce sync.Once
+	closeChan chan bool
+
+	mu           sync.Mutex
+	nextID       uint32
+	errorStreams map[string]*errorStream // by request ID
+	dataStreams  []*dataStream
+}
+
+func (s *session) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	select {
+	case <-s.closeChan:
+		return nil, fmt.Errorf("session closed")
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	requestID := headers.Get(corev1.PortForwardRequestIDHeader)
+	port := headers.Get(corev1.PortHeader)
+
+	switch headers.Get(corev1.StreamType) {
+	case corev1.StreamTypeError:
+		es := &errorStream{headers: headers.Clone(), id: s.nextID, done: make(chan struct{})}
+		s.errorStreams[requestID] = es
+		return es, nil
+
+	case corev1.StreamTypeData:
+		es, ok := s.errorStreams[requestID]
+		if !ok {
+			return nil, fmt.Errorf("no error stream for request %s", requestID)
+		}
+		ds := &dataStream{headers: headers.Clone(), id: s.nextID, errorStream: es}
+		addr, ok := s.dialer.route(s.pod, port)
+		if !ok {
+			es.finish(fmt.Sprintf("error forwarding port %s to pod %s: connection refused", port, s.pod))
+			return ds, nil
+		}
+		c, err := net.DialTimeout("tcp", addr, 5*time.Second)
+		if err != nil {
+			es.finish(fmt.Sprintf("error forwarding port %s to pod %s: %v", port, s.pod, err))
+			return ds, nil
+		}
+		ds.conn = c
+		s.dataStreams = append(s.dataStreams, ds)
+		return ds, nil
+
+	default:
+		return nil, fmt.Errorf("unknown stream type %q", headers.Get(corev1.StreamType))
+	}
+}
+
+func (s *session) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		for _, ds := range s.dataStreams {
+			ds.Reset()
+		}
+		for _, es := range s.errorStreams {
+			es.finish("")
+		}
+		s.mu.Unlock()
+		close(s.closeChan)
+	})
+	return nil
+}
+
+func (s *session) CloseChan() <-chan bool {
+	return s.closeChan
+}
+
+func (s *session) SetIdleTimeout(time.Duration) {}
+
+func (s *session) RemoveStreams(streams ...httpstream.Stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stream := range streams {
+		switch st := stream.(type) {
+		case *dataStream:
+			st.Reset()
+			for i, ds := range s.dataStreams {
+				if ds == st {
+					s.dataStreams = append(s.dataStreams[:i], s.dataStreams[i+1:]...)
+					break
+				}
+			}
+		case *errorStream:
+			delete(s.errorStreams, st.headers.Get(corev1.PortForwardRequestIDHeader))
+		}
+	}
+}
+
+// errorStream carries an error message once the forwarded connection ends
+type errorStream struct {
+	headers http.Header
+	id      uint32
+
+	mu      sync.Mutex
+	message bytes.Buffer
+	done    chan struct{}
+	once    sync.Once
+}
+
+// finish ends the stream, with an error message unless it is empty
+func (s *errorStream) finish(message string) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.message.WriteString(message)
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+func (s *errorStream) Read(p []byte) (int, error) {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.message.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.message.Read(p)
+}
+
+func (s *errorStream) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("error stream is read-only")
+}
+
+// Close closes the client's (unused) write side
+func (s *errorStream) Close() error {
+	return nil
+}
+
+func (s *errorStream) Reset() error {
+	s.finish("")
+	return nil
+}
+
+func (s *errorStream) Headers() http.Header {
+	return s.headers
+}
+
+func (s *errorStream) Identifier() uint32 {
+	return s.id
+}
+
+// dataStream relays a forwarded connection to the pod's local server. It
+// has no conn if the connection couldn't be made.
+type dataStream struct {
+	headers     http.Header
+	id          uint32
+	conn        net.Conn
+	errorStream *errorStream
+}
+
+func (s *dataStream) Read(p []byte) (int, error) {
+	if s.conn == nil {
+		return 0, io.EOF
+	}
+	n, err := s.conn.Read(p)
+	if err != nil {
+		// The server is done with the connection, like the kubelet closing
+		// the error stream once it stops copying
+		s.errorStream.finish("")
+	}
+	return n, err
+}
+
+func (s *dataStream) Write(p []byte) (int, error) {
+	if s.conn == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return s.conn.Write(p)
+}
+
+// Close tells the server the client won't send any more data
+func (s *dataStream) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	if tcp, ok := s.conn.(*net.TCPConn); ok {
+		return tcp.CloseWrite()
+	}
+	return s.conn.Close()
+}
+
+func (s *dataStream) Reset() error {
+	s.errorStream.finish("")
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *dataStream) Headers() http.Header {
+	return s.headers
+}
+
+func (s *dataStream) Identifier() uint32 {
+	return s.id
+}
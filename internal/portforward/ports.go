@@ -0,0 +1,302 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PortMapping is one local port forwarded to a remote port over the
+// connection's tunnel
+type PortMapping struct {
+	Local      int    // local port, 0 to pick a free one when the forward starts
+	Remote     int    // remote port number, 0 when given by name
+	RemoteName string // named remote port (e.g. "http"), resolved when the tunnel starts
+}
+
+// ParsePortMapping parses "8080", "8080:80" or "8080:http". A local port of
+// "auto" or 0 (e.g. "auto:80") asks for a free port.
+func ParsePortMapping(s string) (PortMapping, error) {
+	localStr, remoteStr, found := strings.Cut(strings.TrimSpace(s), ":")
+	if !found {
+		remoteStr = localStr
+	}
+
+	local := 0
+	if localStr != "auto" {
+		var err error
+		local, err = strconv.Atoi(localStr)
+		if err != nil || local < 0 || local > 65535 {
+			return PortMapping{}, fmt.Errorf("invalid local port in %q", s)
+		}
+	}
+	if local == 0 && !found {
+		return PortMapping{}, fmt.Errorf("automatic local port in %q needs a remote port (auto:REMOTE)", s)
+	}
+
+	if remote, err := strconv.Atoi(remoteStr); err == nil {
+		if remote <= 0 || remote > 65535 {
+			return PortMapping{}, fmt.Errorf("invalid remote port in %q", s)
+		}
+		return PortMapping{Local: local, Remote: remote}, nil
+	}
+	if remoteStr == "" {
+		return PortMapping{}, fmt.Errorf("invalid remote port in %q", s)
+	}
+	return PortMapping{Local: local, RemoteName: remoteStr}, nil
+}
+
+// RemoteString returns the remote port number or name
+func (p PortMapping) RemoteString() string {
+	if p.RemoteName != "" {
+		return p.RemoteName
+	}
+	return strconv.Itoa(p.Remote)
+}
+
+// LocalString returns the local port number, or "auto" if it's yet to be picked
+func (p PortMapping) LocalString() string {
+	if p.Local == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(p.Local)
+}
+
+// String returns the mapping in the form accepted by ParsePortMapping
+func (p PortMapping) String() string {
+	return p.LocalString() + ":" + p.RemoteString()
+}
+
+// FormatPortMappings returns mappings as "8080->80,9090->metrics"
+func FormatPortMappings(ports []PortMapping) string {
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = p.LocalString() + "->" + p.RemoteString()
+	}
+	return strings.Join(parts, ",")
+}
+
+// PortRange is an inclusive range of local ports automatic ports are taken from
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// ParsePortRange parses "20000-20999". An empty string is the zero range,
+// which lets the OS pick automatic ports.
+func ParsePortRange(s string) (PortRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return PortRange{}, nil
+	}
+	minStr, maxStr, found := strings.Cut(s, "-")
+	if !found {
+		return PortRange{}, fmt.Errorf("invalid port range %q (use MIN-MAX)", s)
+	}
+	min, err1 := strconv.Atoi(strings.TrimSpace(minStr))
+	max, err2 := strconv.Atoi(strings.TrimSpace(maxStr))
+	if err1 != nil || err2 != nil || min <= 0 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("invalid port range %q (use MIN-MAX)", s)
+	}
+	return PortRange{Min: min, Max: max}, nil
+}
+
+// IsZero reports whether no range is set
+func (r PortRange) IsZero() bool {
+	return r.Min == 0 && r.Max == 0
+}
+
+// String returns the range in the form accepted by ParsePortRange
+func (r PortRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// allocateLocalPorts replaces automatic (0) local ports with ones that are
+// free on all addresses, from r when set. Ports of other connections are
+// skipped. The picked ports are bound right away and their listeners
+// returned, so no other process can take them before the tunnel serves them;
+// once picked a port is kept across reconnects. The caller must hold m.mu.
+func (m *Manager) allocateLocalPorts(ports []PortMapping, r PortRange, addresses []string) ([]PortMapping, []localListener, error) {
+	used := make(map[int]bool)
+	for _, conn := range m.connections {
+		for _, p := range conn.Ports {
+			used[p.Local] = true
+		}
+	}
+	for _, p := range ports {
+		used[p.Local] = true
+	}
+
+	result := append([]PortMapping(nil), ports...)
+	var bound []localListener
+	for i := range result {
+		if result[i].Local != 0 {
+			continue
+		}
+		port, listeners, err := bindFreeLocalPort(r, used, addresses)
+		if err != nil {
+			closeListeners(bound)
+			return nil, nil, err
+		}
+		used[port] = true
+		result[i].Local = port
+		for _, l := range listeners {
+			bound = append(bound, localListener{Listener: l, mapping: i})
+		}
+	}
+	return result, bound, nil
+}
+
+// bindFreeLocalPort listens on a local port that isn't in used on all
+// addresses, from r when set, and returns it with its listeners
+func bindFreeLocalPort(r PortRange, used map[int]bool, addresses []string) (int, []net.Listener, error) {
+	if r.IsZero() {
+		var lastErr error
+		for attempt := 0; attempt < 10; attempt++ {
+			port, listeners, err := bindLocalPort(addresses, 0)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if !used[port] {
+				return port, listeners, nil
+			}
+			closeAll(listeners)
+		}
+		if lastErr != nil {
+			return 0, nil, fmt.Errorf("failed to allocate a local port: %w", lastErr)
+		}
+		return 0, nil, fmt.Errorf("failed to allocate a free local port")
+	}
+
+	for port := r.Min; port <= r.Max; port++ {
+		if used[port] {
+			continue
+		}
+		if _, listeners, err := bindLocalPort(addresses, port); err == nil {
+			return port, listeners, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("no free local port in range %s", r)
+}
+
+// bindLocalPort listens on port of every address. Port 0 takes the port
+// the OS picks on the first address.
+func bindLocalPort(addresses []string, port int) (int, []net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addresses {
+		ls, err := listenTCP(addr, port)
+		if err != nil {
+			closeAll(listeners)
+			return 0, nil, err
+		}
+		listeners = append(listeners, ls...)
+		port = ls[0].Addr().(*net.TCPAddr).Port
+	}
+	return port, listeners, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// freeLocalPort returns a local port that can currently be bound on all
+// addresses and isn't in used. The port is only probed, which is enough for
+// planning forwards; starting one binds its ports with bindFreeLocalPort.
+func freeLocalPort(r PortRange, used map[int]bool, addresses []string) (int, error) {
+	if r.IsZero() {
+		for attempt := 0; attempt < 10; attempt++ {
+			listener, err := net.Listen("tcp", listenAddress(addresses[0], 0))
+			if err != nil {
+				return 0, fmt.Errorf("failed to allocate a local port: %w", err)
+			}
+			port := listener.Addr().(*net.TCPAddr).Port
+			listener.Close()
+			if !used[port] && canBind(addresses[1:], port) {
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("failed to allocate a free local port")
+	}
+
+	for port := r.Min; port <= r.Max; port++ {
+		if !used[port] && canBind(addresses, port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free local port in range %s", r)
+}
+
+// canBind reports whether port can currently be bound on every address
+func canBind(addresses []string, port int) bool {
+	for _, addr := range addresses {
+		listener, err := net.Listen("tcp", listenAddress(addr, port))
+		if err != nil {
+			return false
+		}
+		listener.Close()
+	}
+	return true
+}
+
+// resolveContainerPort returns the container port of pod a mapping points at
+func resolveContainerPort(pod *corev1.Pod, p PortMapping) (int, error) {
+	if p.RemoteName == "" {
+		return p.Remote, nil
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, cp := range container.Ports {
+			if cp.Name == p.RemoteName {
+				return int(cp.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s has no container port named %q", pod.Name, p.RemoteName)
+}
+
+// resolveServicePort returns the service port number a mapping points at
+func resolveServicePort(svc *corev1.Service, p PortMapping) (int, error) {
+	if p.RemoteName == "" {
+		return p.Remote, nil
+	}
+	for _, sp := range svc.Spec.Ports {
+		if sp.Name == p.RemoteName {
+			return int(sp.Port), nil
+		}
+	}
+	return 0, fmt.Errorf("service %s has no port named %q", svc.Name, p.RemoteName)
+}
+
+// ParsePortMappings parses mappings in the form accepted by ParsePortMapping.
+// Without any, local:remote is the only mapping.
+func ParsePortMappings(ports []string, local, remote int) ([]PortMapping, error) {
+	if len(ports) == 0 {
+		return []PortMapping{{Local: local, Remote: remote}}, nil
+	}
+	mappings := make([]PortMapping, 0, len(ports))
+	for _, s := range ports {
+		p, err := ParsePortMapping(s)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, p)
+	}
+	return mappings, nil
+}
+
+// PortMappingStrings returns mappings in the form accepted by ParsePortMapping
+func PortMappingStrings(ports []PortMapping) []string {
+	result := make([]string, len(ports))
+	for i, p := range ports {
+		result[i] = p.String()
+	}
+	return result
+}
@@ -0,0 +1,404 @@
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// ProbeType selects how a forward is health checked
+type ProbeType string
+
+const (
+	ProbeTCP  ProbeType = "tcp"  // connect and check the pod doesn't refuse it
+	ProbeHTTP ProbeType = "http" // GET a path and check the status code
+	ProbeGRPC ProbeType = "grpc" // grpc.health.v1.Health/Check
+)
+
+// ParseProbeType parses a probe type as used in flags and profiles
+func ParseProbeType(s string) (ProbeType, error) {
+	switch t := ProbeType(strings.ToLower(strings.TrimSpace(s))); t {
+	case ProbeTCP, ProbeHTTP, ProbeGRPC:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown probe type %q (use tcp, http or grpc)", s)
+	}
+}
+
+// Probe is a health check run periodically through a forward's tunnel
+type Probe struct {
+	Type             ProbeType
+	Port             string        // remote port (number or name) of the mapping to probe; the first one if empty
+	Path             string        // HTTP request path, "/" if empty
+	ExpectStatus     int           // HTTP status to expect; any 2xx or 3xx if 0
+	Service          string        // gRPC health service; the whole server if empty
+	Interval         time.Duration // time between probes, 10s if 0
+	Timeout          time.Duration // per-probe timeout, 2s if 0
+	FailureThreshold int           // failures in a row before the connection is degraded, 3 if 0
+	ReconnectAfter   int           // failures in a row that re-dial the tunnel; 0 never
+}
+
+// errProbeFailed ends a tunnel attempt whose probes kept failing
+var errProbeFailed = errors.New("health probe failed")
+
+// normalize fills in defaults for unset fields
+func (p Probe) normalize() Probe {
+	if p.Path == "" {
+		p.Path = "/"
+	}
+	if p.Interval <= 0 {
+		p.Interval = 10 * time.Second
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 2 * time.Second
+	}
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = 3
+	}
+	return p
+}
+
+// String describes the probe, e.g. "http GET /healthz every 10s"
+func (p Probe) String() string {
+	var desc string
+	switch p.Type {
+	case ProbeHTTP:
+		desc = "http GET " + p.Path
+		if p.ExpectStatus != 0 {
+			desc += fmt.Sprintf(" (expect %d)", p.ExpectStatus)
+		}
+	case ProbeGRPC:
+		desc = "grpc health"
+		if p.Service != "" {
+			desc += " " + p.Service
+		}
+	default:
+		desc = string(p.Type)
+	}
+	if p.Port != "" {
+		desc += " on " + p.Port
+	}
+	return fmt.Sprintf("%s every %s", desc, p.Interval)
+}
+
+// probeMapping returns the index of the port mapping probe checks
+func probeMapping(probe *Probe, mappings []PortMapping) (int, error) {
+	if probe.Port == "" {
+		return 0, nil
+	}
+	for i, p := range mappings {
+		if p.RemoteString() == probe.Port {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("probe port %s is not one of the forwarded ports", probe.Port)
+}
+
+// probeHost returns the host HTTP and gRPC probes of conn send, the
+// address clients reach the probed mapping on. Wildcard bind addresses
+// are reported as loopback.
+func (c *Connection) probeHost() string {
+	if c.SocketPath != "" {
+		return "localhost"
+	}
+	i, _ := probeMapping(c.Probe, c.Ports)
+	host := c.Addresses[0]
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return listenAddress(host, c.Ports[i].Local)
+}
+
+// dialProbe opens a probe connection straight into the tunnel that's up.
+// It doesn't pass the local listener, so probes don't take client slots,
+// count toward metrics and limits, get faults injected or get recorded.
+func (c *Connection) dialProbe(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case c.probes <- server:
+		return client, nil
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("no tunnel to probe through: %w", ctx.Err())
+	}
+}
+
+// serveProbes forwards the probe connections of c through the tunnel pick
+// returns until done is closed
+func (c *Connection) serveProbes(pick func() *tunnel, done <-chan struct{}) {
+	if c.Probe == nil {
+		return
+	}
+	i, _ := probeMapping(c.Probe, c.Ports)
+	for {
+		select {
+		case client := <-c.probes:
+			t := pick()
+			if t == nil {
+				client.Close()
+				continue
+			}
+			go func() {
+				if err := c.forward(client, t, i); err != nil {
+					logger.Debug("portforward", "Probe connection to %s failed: %v", t.pod, err)
+				}
+			}()
+		case <-done:
+			return
+		}
+	}
+}
+
+// watchProbe runs the connection's probe every interval until ctx ends.
+// Enough failures in a row degrade the connection and a success makes it
+// active again. If the probe asks for it, the returned channel reports when
+// the tunnel should be re-dialed; it is nil without a probe.
+func (m *Manager) watchProbe(ctx context.Context, conn *Connection) <-chan error {
+	if conn.Probe == nil {
+		return nil
+	}
+	probe := *conn.Probe
+	dial := conn.dialProbe
+	host := conn.probeHost()
+	reconnect := make(chan error, 1)
+
+	go func() {
+		ticker := time.NewTicker(probe.Interval)
+		defer ticker.Stop()
+
+		failures := 0
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			err := runProbe(ctx, probe, dial, host)
+			if ctx.Err() != nil {
+				return
+			}
+
+			conn.mu.Lock()
+			wasDegraded := conn.Status == StatusDegraded
+			if err == nil {
+				failures = 0
+				conn.ProbeFailures = 0
+				conn.ProbeError = ""
+				if wasDegraded {
+					conn.Status = StatusActive
+				}
+			} else {
+				failures++
+				conn.ProbeFailures = failures
+				conn.ProbeError = err.Error()
+				if failures >= probe.FailureThreshold && conn.Status == StatusActive {
+					conn.Status = StatusDegraded
+				}
+			}
+			degraded := conn.Status == StatusDegraded
+			conn.mu.Unlock()
+
+			if err == nil {
+				if wasDegraded {
+					conn.AddLog("✓ Probe succeeded, connection is healthy again")
+					logger.Info("portforward", "Probe recovered: %s", conn.ID)
+					m.notifyChange()
+				}
+				continue
+			}
+
+			logger.Debug("portforward", "Probe failed for %s (%d in a row): %v", conn.ID, failures, err)
+			if degraded && !wasDegraded {
+				conn.AddLog(fmt.Sprintf("⚠ Probe failed %d times, connection degraded: %v", failures, err))
+				logger.Warn("portforward", "Connection degraded: %s - %v", conn.ID, err)
+				m.notifyChange()
+			}
+			if probe.ReconnectAfter > 0 && failures >= probe.ReconnectAfter {
+				reconnect <- fmt.Errorf("%w %d times: %v", errProbeFailed, failures, err)
+				return
+			}
+		}
+	}()
+
+	return reconnect
+}
+
+// probeDialer opens a connection to the probed pod port
+type probeDialer func(ctx context.Context) (net.Conn, error)
+
+// runProbe runs a single probe over connections from dial; HTTP and gRPC
+// probes address their requests to host
+func runProbe(ctx context.Context, probe Probe, dial probeDialer, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, probe.Timeout)
+	defer cancel()
+
+	switch probe.Type {
+	case ProbeHTTP:
+		return probeHTTP(ctx, probe, dial, host)
+	case ProbeGRPC:
+		return probeGRPC(ctx, probe, dial, host)
+	default:
+		return probeTCP(ctx, dial)
+	}
+}
+
+// probeTCP connects and waits for the pod to refuse the connection. The
+// tunnel always accepts, so a dead pod port only shows as the connection
+// being closed again right away.
+func probeTCP(ctx context.Context, dial probeDialer) error {
+	c, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	deadline, _ := ctx.Deadline()
+	c.SetReadDeadline(deadline)
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// Nothing to read but still open: the pod accepted the connection
+			return nil
+		}
+		if err == io.EOF {
+			return fmt.Errorf("connection closed by the pod")
+		}
+		return err
+	}
+	return nil
+}
+
+// probeHTTP sends a GET request for the probe path
+func probeHTTP(ctx context.Context, probe Probe, dial probeDialer, host string) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx)
+			},
+			DisableKeepAlives: true,
+		},
+		// Report redirects instead of following them out of the forward
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+probe.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if probe.ExpectStatus != 0 {
+		if resp.StatusCode != probe.ExpectStatus {
+			return fmt.Errorf("HTTP %d, expected %d", resp.StatusCode, probe.ExpectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// grpcServingStatus names the values of grpc.health.v1.HealthCheckResponse.ServingStatus
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// probeGRPC calls grpc.health.v1.Health/Check over plaintext HTTP/2. The
+// request and response messages are small enough to encode by hand.
+func probeGRPC(ctx context.Context, probe Probe, dial probeDialer, host string) error {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx)
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	// HealthCheckRequest{service = 1}
+	var msg []byte
+	if probe.Service != "" {
+		msg = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(probe.Service)))...)
+		msg = append(msg, probe.Service...)
+	}
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+host+"/grpc.health.v1.Health/Check", bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	// Errors come as trailers, or as headers in a trailers-only response
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return fmt.Errorf("grpc status %s: %s", status, message)
+	}
+
+	// HealthCheckResponse{status = 1}; an empty message means UNKNOWN
+	if len(body) < 5 {
+		return fmt.Errorf("short gRPC response")
+	}
+	msg = body[5:]
+	serving := uint64(0)
+	if len(msg) > 0 && msg[0] == 0x08 {
+		if v, n := binary.Uvarint(msg[1:]); n > 0 {
+			serving = v
+		}
+	}
+	if serving != 1 {
+		name, ok := grpcServingStatus[serving]
+		if !ok {
+			name = fmt.Sprintf("status %d", serving)
+		}
+		return fmt.Errorf("service is %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package portforward_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+// startProbedForward starts a forward to port 5432 of a pod that nothing
+// serves yet, health checked with a fast tcp probe
+func startProbedForward(t *testing.T, reconnectAfter int) (*portforwardtest.Dialer, *portforward.Connection) {
+	t.Helper()
+	m, dialer := newTestManager(t, runningPod("db-0", nil))
+	opts := forwardPod("db-0", 5432)
+	opts.Probe = &portforward.Probe{
+		Type:             portforward.ProbeTCP,
+		Interval:         20 * time.Millisecond,
+		Timeout:          50 * time.Millisecond,
+		FailureThreshold: 2,
+		ReconnectAfter:   reconnectAfter,
+	}
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return dialer, conn
+}
+
+func TestProbeDegradesAndRecovers(t *testing.T) {
+	dialer, conn := startProbedForward(t, 0)
+	waitFor(t, "degraded", func() bool { return conn.GetConnectionInfo().Status == portforward.StatusDegraded })
+	if info := conn.GetConnectionInfo(); info.ProbeFailures < 2 || !strings.Contains(info.ProbeError, "closed by the pod") {
+		t.Errorf("probe failures = %d, error = %q", info.ProbeFailures, info.ProbeError)
+	}
+
+	// Once the port answers the connection is healthy again
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "recovery", func() bool { return conn.GetConnectionInfo().Status == portforward.StatusActive })
+	if info := conn.GetConnectionInfo(); info.ProbeFailures != 0 || info.ProbeError != "" {
+		t.Errorf("probe failures = %d, error = %q after recovery", info.ProbeFailures, info.ProbeError)
+	}
+	if n := dialer.Dials(namespace, "db-0"); n != 1 {
+		t.Errorf("dials = %d, want 1 without reconnectAfter", n)
+	}
+	logs := strings.Join(conn.GetLogs(), "\n")
+	for _, want := range []string{"Probe failed 2 times, connection degraded", "Probe succeeded, connection is healthy again"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestProbeReconnect(t *testing.T) {
+	dialer, conn := startProbedForward(t, 3)
+	waitFor(t, "re-dial", func() bool { return dialer.Dials(namespace, "db-0") >= 2 })
+	if logs := strings.Join(conn.GetLogs(), "\n"); !strings.Contains(logs, "health probe failed 3 times") {
+		t.Errorf("logs lack the probe giving up:\n%s", logs)
+	}
+
+	// A re-dialed tunnel to a pod that answers stays up
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "active", func() bool {
+		info := conn.GetConnectionInfo()
+		return info.Status == portforward.StatusActive && info.ProbeFailures == 0
+	})
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q", got)
+	}
+}
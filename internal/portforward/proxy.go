@@ -0,0 +1,366 @@
+package portforward
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pyqan/portFwd/internal/k8s"
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// DefaultClusterDomain is the DNS domain of a cluster's services
+const DefaultClusterDomain = "cluster.local"
+
+// proxyHandshakeTimeout bounds the SOCKS handshake of a client
+const proxyHandshakeTimeout = 10 * time.Second
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion = 5
+
+	socksMethodNoAuth        = 0x00
+	socksMethodNotAcceptable = 0xff
+
+	socksCmdConnect = 1
+
+	socksAddrIPv4   = 1
+	socksAddrDomain = 3
+	socksAddrIPv6   = 4
+
+	socksSucceeded           = 0x00
+	socksGeneralFailure      = 0x01
+	socksHostUnreachable     = 0x04
+	socksCommandNotSupported = 0x07
+	socksAddrNotSupported    = 0x08
+)
+
+// ProxyOptions configures a SOCKS5 proxy into a cluster
+type ProxyOptions struct {
+	Context       string // kube context, the default clients' one if empty
+	Address       string // listen address, e.g. ":1080"; an empty host means 127.0.0.1
+	Namespace     string // namespace of bare service names, "default" if empty
+	ClusterDomain string // DefaultClusterDomain if empty
+}
+
+// ProxyStats counts the requests of a proxy
+type ProxyStats struct {
+	Requests int64 // CONNECT requests served
+	Active   int64 // requests with an open stream
+	Errors   int64 // requests that couldn't be resolved or dialed
+}
+
+// Proxy is a SOCKS5 server that resolves every CONNECT request to a pod
+// through the API and opens a port-forward stream to it. Targets are
+// "svc", "svc.ns", "svc.ns.svc[.cluster.local]", "pod.svc.ns[...]" for
+// pods behind a headless service, or a pod IP.
+type Proxy struct {
+	manager  *Manager
+	cluster  *cluster
+	opts     ProxyOptions
+	listener net.Listener
+
+	requests int64
+	active   int64
+	errors   int64
+	next     uint64 // round-robin over service pods
+
+	mu      sync.Mutex
+	clients map[net.Conn]struct{}
+	closed  bool
+}
+
+// StartProxy starts a SOCKS5 proxy into the cluster of opts.Context
+func (m *Manager) StartProxy(opts ProxyOptions) (*Proxy, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = DefaultClusterDomain
+	}
+	host, port, err := net.SplitHostPort(opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %w", opts.Address, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	opts.Context = m.clients.normalize(opts.Context)
+	cl, err := m.clients.get(opts.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", net.JoinHostPort(host, port), err)
+	}
+	opts.Address = listener.Addr().String()
+	if !IsLoopbackAddress(host) {
+		logger.Warn("proxy", "SOCKS proxy listens on non-loopback address %s: the cluster is reachable from other hosts", host)
+	}
+
+	p := &Proxy{
+		manager:  m,
+		cluster:  cl,
+		opts:     opts,
+		listener: listener,
+		clients:  make(map[net.Conn]struct{}),
+	}
+	go p.serve()
+	logger.Info("proxy", "SOCKS proxy listening on %s", opts.Address)
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on
+func (p *Proxy) Addr() string {
+	return p.opts.Address
+}
+
+// Stats returns the proxy's request counters
+func (p *Proxy) Stats() ProxyStats {
+	return ProxyStats{
+		Requests: atomic.LoadInt64(&p.requests),
+		Active:   atomic.LoadInt64(&p.active),
+		Errors:   atomic.LoadInt64(&p.errors),
+	}
+}
+
+// Close stops the proxy and closes the open client connections
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for client := range p.clients {
+		client.Close()
+	}
+	p.mu.Unlock()
+	logger.Info("proxy", "SOCKS proxy on %s stopped", p.opts.Address)
+	return p.listener.Close()
+}
+
+func (p *Proxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			client.Close()
+			return
+		}
+		p.clients[client] = struct{}{}
+		p.mu.Unlock()
+
+		go func() {
+			p.handle(client)
+			p.mu.Lock()
+			delete(p.clients, client)
+			p.mu.Unlock()
+		}()
+	}
+}
+
+// handle serves one SOCKS client connection
+func (p *Proxy) handle(client net.Conn) {
+	defer client.Close()
+
+	client.SetDeadline(time.Now().Add(proxyHandshakeTimeout))
+	host, port, err := socksHandshake(client)
+	if err != nil {
+		logger.Debug("proxy", "SOCKS handshake from %s failed: %v", client.RemoteAddr(), err)
+		return
+	}
+	atomic.AddInt64(&p.requests, 1)
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), proxyHandshakeTimeout)
+	namespace, pod, podPort, err := p.resolve(ctx, host, port)
+	cancel()
+	if err != nil {
+		atomic.AddInt64(&p.errors, 1)
+		logger.Warn("proxy", "CONNECT %s: %v", target, err)
+		socksReply(client, socksHostUnreachable)
+		return
+	}
+
+	t, err := p.manager.dialTunnel(context.Background(), p.cluster, namespace, pod, []int{podPort})
+	if err != nil {
+		atomic.AddInt64(&p.errors, 1)
+		logger.Warn("proxy", "CONNECT %s: tunnel to %s/%s failed: %v", target, namespace, pod, err)
+		socksReply(client, socksGeneralFailure)
+		return
+	}
+	defer t.Close()
+
+	if err := socksReply(client, socksSucceeded); err != nil {
+		return
+	}
+	client.SetDeadline(time.Time{})
+	logger.Info("proxy", "CONNECT %s -> %s/%s:%d", target, namespace, pod, podPort)
+
+	atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+	if err := t.handle(client, 0); err != nil {
+		atomic.AddInt64(&p.errors, 1)
+		logger.Warn("proxy", "CONNECT %s: %v", target, err)
+	}
+}
+
+// resolve maps a requested host and port to a pod and the port inside it
+func (p *Proxy) resolve(ctx context.Context, host string, port int) (namespace, pod string, podPort int, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return p.resolvePodIP(ctx, ip.String(), port)
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	name = strings.TrimSuffix(name, "."+p.opts.ClusterDomain)
+	name = strings.TrimSuffix(name, ".svc")
+	parts := strings.Split(name, ".")
+	switch len(parts) {
+	case 1:
+		return p.resolveService(ctx, p.opts.Namespace, parts[0], port)
+	case 2:
+		return p.resolveService(ctx, parts[1], parts[0], port)
+	case 3:
+		return p.resolveServicePod(ctx, parts[2], parts[1], parts[0], port)
+	}
+	return "", "", 0, fmt.Errorf("%s is not a service or pod name", host)
+}
+
+// resolveService picks a ready pod of a service, round-robin, and the pod
+// port behind the service port
+func (p *Proxy) resolveService(ctx context.Context, namespace, name string, port int) (string, string, int, error) {
+	svc, err := p.cluster.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", 0, err
+	}
+	if reason := unforwardableService(svc); reason != "" {
+		return "", "", 0, fmt.Errorf("service %s/%s: %s", namespace, name, reason)
+	}
+	slices, err := k8s.ListEndpointSlices(ctx, p.cluster.clientset, namespace, name)
+	if err != nil {
+		return "", "", 0, err
+	}
+	targets, _, err := matchServiceTargets([]PortMapping{{Remote: port}}, svc, slices)
+	if err != nil {
+		return "", "", 0, err
+	}
+	target := targets[atomic.AddUint64(&p.next, 1)%uint64(len(targets))]
+	return namespace, target.pod, target.ports[0], nil
+}
+
+// resolveServicePod resolves "pod.svc.ns", the name of a pod behind a
+// headless service; the port is a pod port
+func (p *Proxy) resolveServicePod(ctx context.Context, namespace, service, name string, port int) (string, string, int, error) {
+	pod, err := p.cluster.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", 0, err
+	}
+	if pod.Spec.Subdomain != "" && pod.Spec.Subdomain != service {
+		return "", "", 0, fmt.Errorf("pod %s/%s is not behind service %s", namespace, name, service)
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", "", 0, fmt.Errorf("pod %s/%s is not running: %s", namespace, name, pod.Status.Phase)
+	}
+	return namespace, pod.Name, port, nil
+}
+
+// resolvePodIP finds the running pod with an IP; the port is a pod port
+func (p *Proxy) resolvePodIP(ctx context.Context, ip string, port int) (string, string, int, error) {
+	pods, err := p.cluster.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "status.podIP=" + ip})
+	if err != nil {
+		return "", "", 0, err
+	}
+	for _, pod := range pods.Items {
+		// Filter again, as not every API server applies the field selector
+		if pod.Status.PodIP == ip && pod.Status.Phase == corev1.PodRunning {
+			return pod.Namespace, pod.Name, port, nil
+		}
+	}
+	return "", "", 0, fmt.Errorf("no running pod has IP %s", ip)
+}
+
+// socksHandshake negotiates "no authentication" and reads a CONNECT request
+func socksHandshake(conn net.Conn) (host string, port int, err error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", 0, err
+	}
+	if header[0] != socksVersion {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", 0, err
+	}
+	method := byte(socksMethodNotAcceptable)
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			method = socksMethodNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", 0, err
+	}
+	if method == socksMethodNotAcceptable {
+		return "", 0, errors.New("client doesn't offer the no-authentication method")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", 0, err
+	}
+	if request[1] != socksCmdConnect {
+		socksReply(conn, socksCommandNotSupported)
+		return "", 0, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", 0, err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", 0, err
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", 0, err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddrNotSupported)
+		return "", 0, fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return "", 0, err
+	}
+	return host, int(binary.BigEndian.Uint16(portBytes)), nil
+}
+
+// socksReply sends a reply to a request; the bound address is left empty
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
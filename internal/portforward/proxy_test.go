@@ -0,0 +1,94 @@
+package portforward_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// socksConnect sends a SOCKS5 CONNECT for host:port through the proxy and
+// returns the connection and the reply code
+func socksConnect(t *testing.T, proxy, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", proxy, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := []byte{5, 1, 0, 5, 1, 0, 3, byte(len(host))}
+	request = append(request, host...)
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	reply := make([]byte, 2+10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if reply[0] != 5 || reply[1] != 0 {
+		t.Fatalf("method reply = %v", reply[:2])
+	}
+	return conn, reply[3]
+}
+
+func TestProxyConnectsToService(t *testing.T) {
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	pod := runningPod("web-a", map[string]string{"app": "web"}, httpPort)
+	pod.Status.PodIP = "10.0.0.7"
+	m, dialer := newTestManager(t, webService(), pod, endpointSlice(map[string]bool{"web-a": true}))
+	dialer.EchoPod(namespace, "web-a", 8080)
+
+	proxy, err := m.StartProxy(portforward.ProxyOptions{Address: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("start proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	for _, host := range []string{"web." + namespace, "web." + namespace + ".svc.cluster.local", "10.0.0.7"} {
+		port := 80
+		if host == "10.0.0.7" {
+			port = 8080 // pod IPs take pod ports
+		}
+		conn, code := socksConnect(t, proxy.Addr(), host, port)
+		if code != 0 {
+			t.Errorf("%s: reply = %d, want success", host, code)
+			conn.Close()
+			continue
+		}
+		conn.Write([]byte("hello"))
+		got := make([]byte, 5)
+		if _, err := io.ReadFull(conn, got); err != nil || string(got) != "hello" {
+			t.Errorf("%s: echo = %q, %v", host, got, err)
+		}
+		conn.Close()
+	}
+
+	if stats := proxy.Stats(); stats.Requests != 3 {
+		t.Errorf("requests = %d, want 3", stats.Requests)
+	}
+}
+
+func TestProxyUnknownHost(t *testing.T) {
+	m, _ := newTestManager(t)
+	proxy, err := m.StartProxy(portforward.ProxyOptions{Address: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("start proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	conn, code := socksConnect(t, proxy.Addr(), "missing."+namespace, 80)
+	defer conn.Close()
+	if code != 4 {
+		t.Errorf("reply = %d, want host unreachable", code)
+	}
+	if stats := proxy.Stats(); stats.Errors != 1 {
+		t.Errorf("errors = %d, want 1", stats.Errors)
+	}
+}
@@ -0,0 +1,93 @@
+package portforward
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy controls how a dropped connection is re-dialed
+type ReconnectPolicy struct {
+	Disabled     bool          // don't reconnect new connections at all
+	InitialDelay time.Duration // delay before the first reconnect attempt
+	MaxDelay     time.Duration // cap for the exponential backoff
+	Multiplier   float64       // growth factor between attempts, at least 1
+	Jitter       *float64      // fraction of the delay that is randomized (0..1); nil for the default, 0 for none
+	MaxAttempts  int           // consecutive attempts before giving up, negative = unlimited
+}
+
+// DefaultReconnectJitter is the jitter of a policy that doesn't set one
+const DefaultReconnectJitter = 0.2
+
+// DefaultReconnectPolicy returns the policy used when none is configured
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       jitter(DefaultReconnectJitter),
+		MaxAttempts:  10,
+	}
+}
+
+// Backoff returns the delay before the given reconnect attempt (starting at 1)
+func (p ReconnectPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempt && delay < float64(p.MaxDelay); i++ {
+		delay *= p.Multiplier
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	// Spread reconnects so that many connections dropped at once don't
+	// hammer the API server in lockstep
+	if p.Jitter != nil && *p.Jitter > 0 {
+		delay += delay * *p.Jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.Duration(delay)
+}
+
+// jitter returns a pointer to j, for ReconnectPolicy.Jitter
+func jitter(j float64) *float64 {
+	return &j
+}
+
+// normalize fills in zero values with defaults
+func (p ReconnectPolicy) normalize() ReconnectPolicy {
+	def := DefaultReconnectPolicy()
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = def.InitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = def.MaxDelay
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = def.Multiplier
+	}
+	switch {
+	case p.Jitter == nil:
+		p.Jitter = def.Jitter
+	case *p.Jitter < 0:
+		p.Jitter = jitter(0)
+	case *p.Jitter > 1:
+		p.Jitter = jitter(1)
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	return p
+}
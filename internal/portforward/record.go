@@ -0,0 +1,885 @@
+package portforward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// RecordFormat says how recorded streams are written
+type RecordFormat string
+
+const (
+	RecordAuto RecordFormat = "auto" // HAR for streams that look like HTTP/1.x, raw dumps for the rest
+	RecordRaw  RecordFormat = "raw"  // raw dumps only
+)
+
+// ParseRecordFormat parses a record format; empty means auto
+func ParseRecordFormat(s string) (RecordFormat, error) {
+	switch f := RecordFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case "", RecordAuto:
+		return RecordAuto, nil
+	case RecordRaw:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown record format %q (use auto or raw)", s)
+	}
+}
+
+const (
+	DefaultRecordMaxFileSize  = 10 << 20  // size at which a raw dump stops and a HAR file rotates
+	DefaultRecordMaxTotalSize = 100 << 20 // size of a connection's recordings before the oldest are deleted
+)
+
+// recordBodyLimit is how much of each HTTP body goes into a HAR entry
+const recordBodyLimit = 1 << 20
+
+// recordQueueChunks is how far HTTP parsing may fall behind a stream before
+// the stream is no longer recorded as HAR
+const recordQueueChunks = 256
+
+// RecordOptions configures the traffic recording of a connection
+type RecordOptions struct {
+	Format       RecordFormat
+	MaxFileSize  int64 // DefaultRecordMaxFileSize if 0
+	MaxTotalSize int64 // DefaultRecordMaxTotalSize if 0
+}
+
+// RecordingInfo describes a connection's running recording
+type RecordingInfo struct {
+	Format  RecordFormat
+	Dir     string
+	Since   time.Time
+	Streams int64 // client connections recorded so far
+	Bytes   int64 // bytes written to recording files
+}
+
+// String describes the recording, e.g. "auto, 3 streams, 12.0 KB in /path"
+func (r RecordingInfo) String() string {
+	return fmt.Sprintf("%s, %d streams, %s in %s", r.Format, r.Streams, FormatBytes(r.Bytes), r.Dir)
+}
+
+// DefaultRecordingsDir returns where recordings are kept: portfwd/recordings
+// in the user's config directory
+func DefaultRecordingsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "portfwd", "recordings")
+}
+
+// SetRecordingsDir sets where recordings are kept, DefaultRecordingsDir if empty
+func (m *Manager) SetRecordingsDir(dir string) {
+	m.mu.Lock()
+	m.recordingsDir = dir
+	m.mu.Unlock()
+}
+
+func (m *Manager) recordingsDirectory() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.recordingsDir == "" {
+		return DefaultRecordingsDir()
+	}
+	return m.recordingsDir
+}
+
+// recordingIDFile holds the ID of the connection a recordings directory belongs to
+const recordingIDFile = ".connection"
+
+// recordingDirName turns a connection ID into a directory name
+func recordingDirName(id string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "->", "-", ">", "-", "@", "_").Replace(id)
+}
+
+// StartRecording records the traffic of the connection's new client
+// connections until StopRecording, and returns the directory it's written to
+func (m *Manager) StartRecording(id string, opts RecordOptions) (string, error) {
+	format, err := ParseRecordFormat(string(opts.Format))
+	if err != nil {
+		return "", err
+	}
+	opts.Format = format
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = DefaultRecordMaxFileSize
+	}
+	if opts.MaxTotalSize <= 0 {
+		opts.MaxTotalSize = DefaultRecordMaxTotalSize
+	}
+	if opts.MaxTotalSize < opts.MaxFileSize {
+		return "", fmt.Errorf("the total recording size can't be below the file size")
+	}
+
+	conn, err := m.connection(id)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(m.recordingsDirectory(), recordingDirName(id))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, recordingIDFile), []byte(id+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+
+	rec := &recording{opts: opts, dir: dir, conn: conn, since: time.Now(), open: make(map[string]bool)}
+	conn.mu.Lock()
+	previous := conn.recorder
+	conn.recorder = rec
+	conn.mu.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+
+	conn.AddLog(fmt.Sprintf("⏺ Recording new client connections (%s) to %s", format, dir))
+	logger.Info("portforward", "Recording %s to %s", id, dir)
+	m.notifyChange()
+	return dir, nil
+}
+
+// StopRecording ends the connection's recording
+func (m *Manager) StopRecording(id string) error {
+	conn, err := m.connection(id)
+	if err != nil {
+		return err
+	}
+	if !conn.stopRecording() {
+		return fmt.Errorf("%s is not being recorded", id)
+	}
+	m.notifyChange()
+	return nil
+}
+
+// connection returns the connection with id
+func (m *Manager) connection(id string) (*Connection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	conn, ok := m.connections[id]
+	if !ok {
+		return nil, fmt.Errorf("connection not found: %s", id)
+	}
+	return conn, nil
+}
+
+// stopRecording ends the connection's recording and reports whether there was one
+func (c *Connection) stopRecording() bool {
+	c.mu.Lock()
+	rec := c.recorder
+	c.recorder = nil
+	c.mu.Unlock()
+	if rec == nil {
+		return false
+	}
+	rec.close()
+	info := rec.info()
+	c.AddLog(fmt.Sprintf("⏹ Recording stopped: %d streams, %s", info.Streams, FormatBytes(info.Bytes)))
+	return true
+}
+
+// recordingInfo returns the state of the connection's recording, nil if off
+func (c *Connection) recordingInfo() *RecordingInfo {
+	if c.recorder == nil {
+		return nil
+	}
+	info := c.recorder.info()
+	return &info
+}
+
+// record returns client wrapped so its traffic is recorded, if the
+// connection is being recorded. target describes the other end.
+func (c *Connection) record(client net.Conn, target string) net.Conn {
+	c.mu.RLock()
+	rec := c.recorder
+	c.mu.RUnlock()
+	if rec == nil {
+		return client
+	}
+	return &recordedConn{Conn: client, stream: rec.newStream(client.RemoteAddr().String(), target)}
+}
+
+// recording is a running recording of one connection
+type recording struct {
+	opts    RecordOptions
+	dir     string
+	conn    *Connection
+	since   time.Time
+	streams atomic.Int64
+	bytes   atomic.Int64
+
+	mu     sync.Mutex
+	closed bool
+	open   map[string]bool // files being written, never pruned
+
+	harMu    sync.Mutex // serializes HAR entries of all streams
+	har      *harFile
+	harFiles int
+}
+
+func (r *recording) info() RecordingInfo {
+	return RecordingInfo{Format: r.opts.Format, Dir: r.dir, Since: r.since, Streams: r.streams.Load(), Bytes: r.bytes.Load()}
+}
+
+func (r *recording) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// close finishes the recording; streams still open stop writing
+func (r *recording) close() {
+	r.harMu.Lock()
+	defer r.harMu.Unlock()
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	if r.har != nil {
+		r.closeFile(r.har.f)
+		r.har = nil
+	}
+}
+
+// createFile creates a recording file and deletes the oldest files of the
+// connection while they add up to more than MaxTotalSize
+func (r *recording) createFile(name string) (*os.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, fmt.Errorf("recording stopped")
+	}
+	path := filepath.Join(r.dir, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r.open[path] = true
+	r.prune()
+	return f, nil
+}
+
+// closeFile closes a file made by createFile
+func (r *recording) closeFile(f *os.File) {
+	r.mu.Lock()
+	delete(r.open, f.Name())
+	r.mu.Unlock()
+	f.Close()
+}
+
+// prune deletes the oldest finished files beyond MaxTotalSize; r.mu is held
+func (r *recording) prune() {
+	files, err := recordingFiles(r.dir)
+	if err != nil {
+		return
+	}
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	for _, f := range files {
+		if total <= r.opts.MaxTotalSize {
+			return
+		}
+		if r.open[f.Path] {
+			continue
+		}
+		if err := os.Remove(f.Path); err == nil {
+			total -= f.Size
+			logger.Debug("portforward", "Deleted old recording %s", f.Path)
+		}
+	}
+}
+
+// newStream starts recording one client connection
+func (r *recording) newStream(client, target string) *streamRecorder {
+	return &streamRecorder{rec: r, id: r.streams.Add(1), start: time.Now(), client: client, target: target}
+}
+
+// Stream recording modes
+const (
+	streamUndecided = iota
+	streamRaw
+	streamHTTP
+	streamOff
+)
+
+// streamRecorder records the traffic of one client connection, as a raw
+// dump or, if it starts like an HTTP/1.x request, as HAR entries
+type streamRecorder struct {
+	rec    *recording
+	id     int64
+	start  time.Time
+	client string
+	target string
+
+	mu      sync.Mutex
+	mode    int
+	raw     *os.File
+	rawSize int64
+	http    *httpRecorder
+	once    sync.Once
+}
+
+// add records a chunk sent by the client (fromClient) or by the pod
+func (s *streamRecorder) add(fromClient bool, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mode == streamOff {
+		return
+	}
+	if s.rec.isClosed() {
+		s.finish()
+		return
+	}
+	if s.mode == streamUndecided {
+		s.mode = streamRaw
+		if s.rec.opts.Format == RecordAuto && fromClient && looksLikeHTTP(p) {
+			s.mode = streamHTTP
+			s.http = newHTTPRecorder(s)
+		}
+	}
+
+	switch s.mode {
+	case streamHTTP:
+		if !s.http.feed(fromClient, p) {
+			// The parser fell behind or gave up; the rest isn't recorded
+			s.http.stop()
+			s.mode = streamOff
+		}
+	case streamRaw:
+		s.writeRaw(fromClient, p)
+	}
+}
+
+// writeRaw appends a timestamped hex dump of p to the stream's raw file
+func (s *streamRecorder) writeRaw(fromClient bool, p []byte) {
+	if s.raw == nil {
+		name := fmt.Sprintf("%s-stream-%04d.raw", s.start.Format("20060102-150405"), s.id)
+		f, err := s.rec.createFile(name)
+		if err != nil {
+			logger.Warn("portforward", "Recording stream %d: %v", s.id, err)
+			s.mode = streamOff
+			return
+		}
+		s.raw = f
+		s.writeRawText(fmt.Sprintf("# portfwd raw dump of %s, stream %d: %s -> %s, started %s\n# > client to pod, < pod to client\n\n",
+			s.rec.conn.ID, s.id, s.client, s.target, s.start.Format(time.RFC3339Nano)))
+	}
+
+	arrow, dir := ">", "client -> pod"
+	if !fromClient {
+		arrow, dir = "<", "pod -> client"
+	}
+	entry := fmt.Sprintf("%s %s %d bytes (%s)\n%s\n", time.Now().UTC().Format(time.RFC3339Nano), arrow, len(p), dir, hex.Dump(p))
+	if s.rawSize+int64(len(entry)) > s.rec.opts.MaxFileSize {
+		s.writeRawText("# truncated: file size limit reached\n")
+		s.rec.closeFile(s.raw)
+		s.raw = nil
+		s.mode = streamOff
+		return
+	}
+	s.writeRawText(entry)
+}
+
+func (s *streamRecorder) writeRawText(text string) {
+	n, _ := s.raw.WriteString(text)
+	s.rawSize += int64(n)
+	s.rec.bytes.Add(int64(n))
+}
+
+// finish ends the stream's recording; s.mu is held
+func (s *streamRecorder) finish() {
+	if s.raw != nil {
+		s.rec.closeFile(s.raw)
+		s.raw = nil
+	}
+	if s.http != nil {
+		s.http.stop()
+	}
+	s.mode = streamOff
+}
+
+// close ends the stream's recording once the client connection is closed
+func (s *streamRecorder) close() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.finish()
+	})
+}
+
+// recordedConn passes a client connection's traffic to a stream recorder
+type recordedConn struct {
+	net.Conn
+	stream *streamRecorder
+}
+
+func (c *recordedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.stream.add(true, p[:n])
+	}
+	return n, err
+}
+
+func (c *recordedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.stream.add(false, p[:n])
+	}
+	return n, err
+}
+
+func (c *recordedConn) Close() error {
+	c.stream.close()
+	return c.Conn.Close()
+}
+
+// httpMethods start the request line of an HTTP/1.x stream
+var httpMethods = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// looksLikeHTTP reports whether the first bytes of a stream start an
+// HTTP/1.x request
+func looksLikeHTTP(p []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(p, []byte(method)) {
+			line, _, _ := bytes.Cut(p, []byte("\r\n"))
+			return bytes.Contains(line, []byte(" HTTP/1."))
+		}
+	}
+	return false
+}
+
+// chunkReader reads the chunks sent on a channel until it's closed
+type chunkReader struct {
+	chunks <-chan []byte
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// httpRecorder parses both directions of an HTTP/1.x stream in the
+// background and writes each exchange to the recording's HAR file
+type httpRecorder struct {
+	stream   *streamRecorder
+	requests chan []byte
+	replies  chan []byte
+	stopped  bool
+}
+
+func newHTTPRecorder(s *streamRecorder) *httpRecorder {
+	h := &httpRecorder{
+		stream:   s,
+		requests: make(chan []byte, recordQueueChunks),
+		replies:  make(chan []byte, recordQueueChunks),
+	}
+	go h.run()
+	return h
+}
+
+// feed queues a copy of a chunk for parsing; false if the queue is full
+func (h *httpRecorder) feed(fromClient bool, p []byte) bool {
+	ch := h.replies
+	if fromClient {
+		ch = h.requests
+	}
+	select {
+	case ch <- append([]byte(nil), p...):
+		return true
+	default:
+		return false
+	}
+}
+
+// stop ends parsing at the end of the queued chunks
+func (h *httpRecorder) stop() {
+	if !h.stopped {
+		h.stopped = true
+		close(h.requests)
+		close(h.replies)
+	}
+}
+
+// exchange is a parsed request waiting for its response
+type exchange struct {
+	req       *http.Request
+	body      capturedBody
+	started   time.Time
+	requested time.Time
+}
+
+func (h *httpRecorder) run() {
+	requests := bufio.NewReader(&chunkReader{chunks: h.requests})
+	replies := bufio.NewReader(&chunkReader{chunks: h.replies})
+	pending := make(chan *exchange, 64)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(pending)
+		for {
+			if _, err := requests.Peek(1); err != nil {
+				return
+			}
+			ex := &exchange{started: time.Now()}
+			req, err := http.ReadRequest(requests)
+			if err != nil {
+				return
+			}
+			ex.req = req
+			ex.body = captureBody(req.Body)
+			ex.requested = time.Now()
+			select {
+			case pending <- ex:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for ex := range pending {
+		if _, err := replies.Peek(1); err != nil {
+			h.write(harEntryFor(ex, nil, capturedBody{}, time.Now(), time.Now(), h.stream))
+			return
+		}
+		responded := time.Now()
+		resp, err := http.ReadResponse(replies, ex.req)
+		for err == nil && resp.StatusCode == http.StatusContinue {
+			resp, err = http.ReadResponse(replies, ex.req)
+		}
+		if err != nil {
+			h.write(harEntryFor(ex, nil, capturedBody{}, responded, time.Now(), h.stream))
+			return
+		}
+		body := captureBody(resp.Body)
+		h.write(harEntryFor(ex, resp, body, responded, time.Now(), h.stream))
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			// Whatever follows an upgrade isn't HTTP
+			return
+		}
+	}
+}
+
+func (h *httpRecorder) write(entry harEntry) {
+	if err := h.stream.rec.writeHAR(entry); err != nil {
+		logger.Warn("portforward", "Recording HAR entry: %v", err)
+	}
+}
+
+// capturedBody is the start of an HTTP body and its full size
+type capturedBody struct {
+	data      []byte
+	size      int64
+	truncated bool
+}
+
+// captureBody reads body to the end, keeping up to recordBodyLimit bytes
+func captureBody(body io.ReadCloser) capturedBody {
+	if body == nil {
+		return capturedBody{}
+	}
+	defer body.Close()
+	var buf bytes.Buffer
+	n, _ := io.Copy(&buf, io.LimitReader(body, recordBodyLimit))
+	rest, _ := io.Copy(io.Discard, body)
+	return capturedBody{data: buf.Bytes(), size: n + rest, truncated: rest > 0}
+}
+
+// HAR 1.2 structures, limited to what a recording fills in
+type (
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Connection      string      `json:"connection,omitempty"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+		Comment     string         `json:"comment,omitempty"`
+	}
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding,omitempty"`
+		Comment  string `json:"comment,omitempty"`
+	}
+	harContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+		Comment  string `json:"comment,omitempty"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+// harEntryFor builds the HAR entry of an exchange; resp is nil if the
+// stream ended before a response
+func harEntryFor(ex *exchange, resp *http.Response, body capturedBody, responded, finished time.Time, s *streamRecorder) harEntry {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	req := ex.req
+	entry := harEntry{
+		StartedDateTime: ex.started.UTC().Format(time.RFC3339Nano),
+		Time:            ms(finished.Sub(ex.started)),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         "http://" + req.Host + req.RequestURI,
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    ex.body.size,
+		},
+		Timings: harTimings{
+			Send:    ms(ex.requested.Sub(ex.started)),
+			Wait:    ms(responded.Sub(ex.requested)),
+			Receive: ms(finished.Sub(responded)),
+		},
+		Connection: fmt.Sprintf("%d", s.id),
+		Comment:    fmt.Sprintf("%s -> %s", s.client, s.target),
+	}
+	if req.Host == "" {
+		entry.Request.URL = "http://" + s.target + req.RequestURI
+	}
+	for _, c := range req.Cookies() {
+		entry.Request.Cookies = append(entry.Request.Cookies, harNameValue{Name: c.Name, Value: c.Value})
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: v})
+		}
+	}
+	if ex.body.size > 0 {
+		text, encoding := harText(ex.body.data)
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: text, Encoding: encoding}
+		if ex.body.truncated {
+			entry.Request.PostData.Comment = "truncated"
+		}
+	}
+
+	if resp == nil {
+		entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1, Comment: "no response"}
+		return entry
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimPrefix(resp.Status, fmt.Sprintf("%d ", resp.StatusCode)),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    body.size,
+		Content:     harContent{Size: body.size, MimeType: resp.Header.Get("Content-Type")},
+	}
+	for _, c := range resp.Cookies() {
+		entry.Response.Cookies = append(entry.Response.Cookies, harNameValue{Name: c.Name, Value: c.Value})
+	}
+	entry.Response.Content.Text, entry.Response.Content.Encoding = harText(body.data)
+	if body.truncated {
+		entry.Response.Content.Comment = "truncated"
+	}
+	return entry
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	result := []harNameValue{}
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			result = append(result, harNameValue{Name: name, Value: v})
+		}
+	}
+	return result
+}
+
+// harText returns a body as text, or base64 with its encoding if it isn't UTF-8
+func harText(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// harFile is a HAR file that is valid JSON after every entry: each entry
+// overwrites the closing brackets and writes them again
+type harFile struct {
+	f       *os.File
+	size    int64
+	entries int
+}
+
+const harTrailer = "\n]}}\n"
+
+// writeHAR appends an entry to the recording's HAR file, starting a new one
+// when it would grow beyond MaxFileSize
+func (r *recording) writeHAR(entry harEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.harMu.Lock()
+	defer r.harMu.Unlock()
+	if r.isClosed() {
+		return nil
+	}
+	har := r.har
+	if har != nil && har.entries > 0 && har.size+int64(len(data))+2 > r.opts.MaxFileSize {
+		r.closeFile(har.f)
+		har, r.har = nil, nil
+	}
+	if har == nil {
+		r.harFiles++
+		name := fmt.Sprintf("%s-%04d.har", time.Now().Format("20060102-150405"), r.harFiles)
+		f, err := r.createFile(name)
+		if err != nil {
+			return err
+		}
+		comment, _ := json.Marshal(r.conn.ID)
+		header := `{"log":{"version":"1.2","creator":{"name":"portfwd","version":""},"comment":` + string(comment) + `,"entries":[`
+		if _, err := f.WriteString(header + harTrailer); err != nil {
+			r.closeFile(f)
+			return err
+		}
+		har = &harFile{f: f, size: int64(len(header) + len(harTrailer))}
+		r.har = har
+		r.bytes.Add(har.size)
+	}
+
+	sep := "\n"
+	if har.entries > 0 {
+		sep = ",\n"
+	}
+	chunk := sep + string(data) + harTrailer
+	if _, err := har.f.WriteAt([]byte(chunk), har.size-int64(len(harTrailer))); err != nil {
+		return err
+	}
+	har.size += int64(len(chunk) - len(harTrailer))
+	har.entries++
+	r.bytes.Add(int64(len(chunk) - len(harTrailer)))
+	return nil
+}
+
+// RecordingFile is a file of a connection's recordings
+type RecordingFile struct {
+	Connection string // connection ID
+	Path       string
+	Size       int64
+	Modified   time.Time
+}
+
+// ListRecordings returns the recording files in dir, oldest first per connection
+func ListRecordings(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result []RecordingFile
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		files, err := recordingFiles(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		id := e.Name()
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name(), recordingIDFile)); err == nil {
+			id = strings.TrimSpace(string(data))
+		}
+		for _, f := range files {
+			f.Connection = id
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+// recordingFiles returns the .raw and .har files in dir by name, which
+// sorts them from oldest to newest
+func recordingFiles(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []RecordingFile
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".raw" && ext != ".har") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, RecordingFile{Path: filepath.Join(dir, e.Name()), Size: info.Size(), Modified: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
@@ -0,0 +1,171 @@
+package portforward_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// recordings returns the recording files of dir, waiting for want of them
+func recordings(t *testing.T, dir string, want int) []portforward.RecordingFile {
+	t.Helper()
+	var files []portforward.RecordingFile
+	waitFor(t, "recording files", func() bool {
+		files, _ = portforward.ListRecordings(dir)
+		return len(files) == want
+	})
+	return files
+}
+
+func TestRecordRawStreams(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("db-0", nil))
+	dir := t.TempDir()
+	m.SetRecordingsDir(dir)
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("db-0", 5432))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// Connections made before recording starts aren't recorded
+	roundTrip(t, localAddr(conn), "before")
+	if _, err := m.StartRecording(conn.ID, portforward.RecordOptions{}); err != nil {
+		t.Fatalf("start recording: %v", err)
+	}
+	roundTrip(t, localAddr(conn), "secret handshake")
+
+	files := recordings(t, dir, 1)
+	if files[0].Connection != conn.ID || !strings.HasSuffix(files[0].Path, ".raw") {
+		t.Fatalf("recording = %+v", files[0])
+	}
+	waitFor(t, "dump", func() bool {
+		data, _ := os.ReadFile(files[0].Path)
+		return strings.Count(string(data), "16 bytes") == 2 && strings.Contains(string(data), "secret handshake")
+	})
+
+	info := conn.GetConnectionInfo().Recording
+	if info == nil || info.Streams != 1 || info.Format != portforward.RecordAuto {
+		t.Errorf("recording info = %+v", info)
+	}
+
+	if err := m.StopRecording(conn.ID); err != nil {
+		t.Fatalf("stop recording: %v", err)
+	}
+	if err := m.StopRecording(conn.ID); err == nil {
+		t.Error("stopping twice: expected an error")
+	}
+	roundTrip(t, localAddr(conn), "after")
+	if files := recordings(t, dir, 1); len(files) != 1 {
+		t.Errorf("recorded after stop: %+v", files)
+	}
+}
+
+func TestRecordHTTPAsHAR(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web-0", nil))
+	dir := t.TempDir()
+	m.SetRecordingsDir(dir)
+	httpPod(t, dialer, "web-0")
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("web-0", 8080))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := m.StartRecording(conn.ID, portforward.RecordOptions{}); err != nil {
+		t.Fatalf("start recording: %v", err)
+	}
+
+	for _, path := range []string{"/users?page=2", "/health"} {
+		resp, err := http.Get("http://" + localAddr(conn) + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	files := recordings(t, dir, 1)
+	var har struct {
+		Log struct {
+			Version string
+			Entries []struct {
+				Request struct {
+					Method      string
+					URL         string
+					QueryString []struct{ Name, Value string }
+				}
+				Response struct {
+					Status  int
+					Content struct{ Text string }
+				}
+			}
+		}
+	}
+	waitFor(t, "HAR entries", func() bool {
+		data, _ := os.ReadFile(files[0].Path)
+		return json.Unmarshal(data, &har) == nil && len(har.Log.Entries) == 2
+	})
+	if har.Log.Version != "1.2" {
+		t.Errorf("version = %q", har.Log.Version)
+	}
+	first := har.Log.Entries[0]
+	if first.Request.Method != "GET" || !strings.HasSuffix(first.Request.URL, "/users?page=2") {
+		t.Errorf("request = %+v", first.Request)
+	}
+	if len(first.Request.QueryString) != 1 || first.Request.QueryString[0].Value != "2" {
+		t.Errorf("query = %+v", first.Request.QueryString)
+	}
+	if first.Response.Status != 200 || first.Response.Content.Text != "web-0 /users" {
+		t.Errorf("response = %+v", first.Response)
+	}
+}
+
+func TestRecordingsArePruned(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("db-0", nil))
+	dir := t.TempDir()
+	m.SetRecordingsDir(dir)
+	if err := dialer.EchoPod(namespace, "db-0", 5432); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := m.StartWithOptions(context.Background(), forwardPod("db-0", 5432))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if _, err := m.StartRecording(conn.ID, portforward.RecordOptions{Format: "bogus"}); err == nil {
+		t.Error("bad format: expected an error")
+	}
+	if _, err := m.StartRecording(conn.ID, portforward.RecordOptions{MaxFileSize: 1000, MaxTotalSize: 100}); err == nil {
+		t.Error("total below file size: expected an error")
+	}
+
+	// Each stream fills a file; only the newest ones fit in the total
+	if _, err := m.StartRecording(conn.ID, portforward.RecordOptions{Format: portforward.RecordRaw, MaxFileSize: 1500, MaxTotalSize: 2000}); err != nil {
+		t.Fatalf("start recording: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		roundTrip(t, localAddr(conn), strings.Repeat("x", 100))
+	}
+	m.StopRecording(conn.ID)
+
+	files, err := portforward.ListRecordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, f := range files {
+		if f.Size > 1500 {
+			t.Errorf("%s is %d bytes", f.Path, f.Size)
+		}
+		total += f.Size
+	}
+	if len(files) == 0 || len(files) == 5 || total > 3500 {
+		t.Errorf("%d files, %d bytes after pruning", len(files), total)
+	}
+}
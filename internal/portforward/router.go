@@ -0,0 +1,437 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// Route sends the HTTP requests of a router forward that match Host and
+// PathPrefix to a port of a pod, service or workload in the router's namespace
+type Route struct {
+	Host         string // Host header to match (without port), any if empty
+	PathPrefix   string // path prefix to match on segment boundaries, "/" if empty
+	ResourceType ResourceType
+	ResourceName string
+	Port         PortMapping // remote port number or name; Local is unused
+}
+
+// ParseRoute parses "[HOST][/PATH]=TYPE/NAME:PORT", e.g. "/api=svc/api:8080",
+// "/=svc/web:80" or "admin.localhost=deploy/admin:http"
+func ParseRoute(s string) (Route, error) {
+	match, target, found := strings.Cut(strings.TrimSpace(s), "=")
+	if !found {
+		return Route{}, fmt.Errorf("invalid route %q (use [HOST][/PATH]=TYPE/NAME:PORT)", s)
+	}
+
+	var r Route
+	if i := strings.Index(match, "/"); i >= 0 {
+		r.Host, r.PathPrefix = match[:i], match[i:]
+	} else {
+		r.Host = match
+	}
+	if r.PathPrefix == "" {
+		r.PathPrefix = "/"
+	}
+	if r.PathPrefix != "/" {
+		r.PathPrefix = strings.TrimSuffix(r.PathPrefix, "/")
+	}
+
+	ref, port, found := strings.Cut(target, ":")
+	if !found || port == "" {
+		return Route{}, fmt.Errorf("invalid route %q: missing target port", s)
+	}
+	var err error
+	if r.ResourceType, r.ResourceName, err = ParseResourceRef(ref); err != nil {
+		return Route{}, fmt.Errorf("invalid route %q: %w", s, err)
+	}
+	if r.ResourceType == ResourceRouter {
+		return Route{}, fmt.Errorf("invalid route %q: a route can't point at a router", s)
+	}
+	if n, err := strconv.Atoi(port); err == nil {
+		if n <= 0 || n > 65535 {
+			return Route{}, fmt.Errorf("invalid route %q: bad port", s)
+		}
+		r.Port = PortMapping{Remote: n}
+	} else {
+		r.Port = PortMapping{RemoteName: port}
+	}
+	return r, nil
+}
+
+// ParseRoutes parses routes in the form accepted by ParseRoute
+func ParseRoutes(routes []string) ([]Route, error) {
+	result := make([]Route, 0, len(routes))
+	for _, s := range routes {
+		r, err := ParseRoute(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// RouteStrings returns routes in the form accepted by ParseRoute
+func RouteStrings(routes []Route) []string {
+	result := make([]string, len(routes))
+	for i, r := range routes {
+		result[i] = r.String()
+	}
+	return result
+}
+
+// String returns the route in the form accepted by ParseRoute
+func (r Route) String() string {
+	return r.Match() + "=" + r.Target()
+}
+
+// Match returns the host and path the route matches, e.g. "admin.localhost/api"
+func (r Route) Match() string {
+	if r.PathPrefix == "" {
+		return r.Host + "/"
+	}
+	return r.Host + r.PathPrefix
+}
+
+// Target returns the resource and port the route goes to, e.g. "svc/api:8080"
+func (r Route) Target() string {
+	return r.ResourceType.ShortName() + "/" + r.ResourceName + ":" + r.Port.RemoteString()
+}
+
+// matches reports whether a request for host and path goes to the route
+func (r Route) matches(host, path string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if r.Host != "" && !strings.EqualFold(r.Host, host) {
+		return false
+	}
+	prefix := r.PathPrefix
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// routerPorts returns the local port of a router with "http" as its remote
+// side, which is how routers show up in IDs and lists
+func routerPorts(ports []PortMapping) []PortMapping {
+	return []PortMapping{{Local: ports[0].Local, RemoteName: "http"}}
+}
+
+// sortRoutes orders routes so the first match is the most specific one:
+// routes with a host before those without, then longer path prefixes first
+func sortRoutes(routes []*routeBackend) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i].route, routes[j].route
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		return len(a.PathPrefix) > len(b.PathPrefix)
+	})
+}
+
+// routeBackend is the tunnel of one route for the current router attempt
+type routeBackend struct {
+	route  Route
+	pod    string
+	port   int
+	tunnel *tunnel
+	proxy  *httputil.ReverseProxy
+}
+
+// dialRoute resolves a route's target pod with the same lookup as a forward
+// to that resource and opens a tunnel to it. It also returns the selector of
+// the target's pods, if any, so the pod can be followed.
+func (m *Manager) dialRoute(ctx context.Context, conn *Connection, r Route) (*routeBackend, string, error) {
+	// A throwaway connection describes the route's target to resolveTarget;
+	// its log lines are copied into the router's log
+	target := &Connection{
+		ID:           conn.ID,
+		Context:      conn.Context,
+		Namespace:    conn.Namespace,
+		ResourceType: r.ResourceType,
+		ResourceName: r.ResourceName,
+		Ports:        []PortMapping{r.Port},
+		cluster:      conn.cluster,
+	}
+	pod, ports, selector, err := m.resolveTarget(ctx, target, target.Ports)
+	for _, line := range target.GetLogs() {
+		if _, msg, found := strings.Cut(line, "] "); found {
+			conn.AddLog(fmt.Sprintf("[%s] %s", r.Match(), msg))
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	t, err := m.dialTunnel(ctx, conn.cluster, conn.Namespace, pod, ports)
+	if err != nil {
+		return nil, "", err
+	}
+	b := &routeBackend{route: r, pod: pod, port: ports[0], tunnel: t}
+	b.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) {
+				return b.dial(conn)
+			},
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			conn.metrics.errors.Add(1)
+			conn.AddLog(fmt.Sprintf("✗ %s %s -> %s: %v", req.Method, req.URL.Path, r.Target(), err))
+			http.Error(w, fmt.Sprintf("portfwd: %s: %v", r.Target(), err), http.StatusBadGateway)
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	return b, selector, nil
+}
+
+// dial opens a stream to the route's pod port, as an in-memory connection
+// for the reverse proxy's transport
+func (b *routeBackend) dial(conn *Connection) (net.Conn, error) {
+	if b.tunnel.isClosed() {
+		return nil, fmt.Errorf("tunnel to %s is closed", b.pod)
+	}
+	client, server := net.Pipe()
+	go func() {
+		if err := b.tunnel.handle(server, 0); err != nil {
+			conn.metrics.errors.Add(1)
+			conn.AddLog(fmt.Sprintf("✗ %s: %v", b.pod, err))
+		}
+	}()
+	return client, nil
+}
+
+// close ends the route's tunnel and idle streams
+func (b *routeBackend) close() {
+	b.proxy.Transport.(*http.Transport).CloseIdleConnections()
+	b.tunnel.Close()
+}
+
+// router is the HTTP handler of a router forward
+type router struct {
+	conn     *Connection
+	backends []*routeBackend // sorted by sortRoutes
+}
+
+func (h *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	for _, b := range h.backends {
+		if !b.route.matches(req.Host, req.URL.Path) {
+			continue
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		b.proxy.ServeHTTP(rec, req)
+
+		status := strconv.Itoa(rec.status)
+		if rec.status == 0 {
+			// Upgraded connections are hijacked before a status is written
+			status = "upgraded"
+		}
+		h.conn.AddLog(fmt.Sprintf("→ %s %s%s %s -> %s (%s)", req.Method, req.Host, req.URL.RequestURI(), status, b.route.Target(), time.Since(start).Round(time.Millisecond)))
+		return
+	}
+	h.conn.AddLog(fmt.Sprintf("→ %s %s%s 404 no route", req.Method, req.Host, req.URL.RequestURI()))
+	http.Error(w, fmt.Sprintf("portfwd: no route for %s%s", req.Host, req.URL.Path), http.StatusNotFound)
+}
+
+// statusRecorder remembers the status code written through it. Unwrap lets
+// the reverse proxy hijack the connection for upgrades.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// meteredListener counts a router's clients and their traffic in the
+// connection's metrics, like serveClient does for plain forwards
+type meteredListener struct {
+	net.Listener
+	conn *Connection
+}
+
+func (l meteredListener) Accept() (net.Conn, error) {
+	for {
+		client, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		release, ok := l.conn.acquire(client)
+		if !ok {
+			continue
+		}
+		l.conn.metrics.opened()
+		admitted, stalled := l.conn.admit(client)
+		if stalled {
+			// Held open in the background, so other clients are still accepted
+			go func() {
+				defer release()
+				defer l.conn.metrics.closed()
+				l.conn.stall(client)
+			}()
+			continue
+		}
+		if admitted == nil {
+			l.conn.metrics.closed()
+			release()
+			continue
+		}
+		client = l.conn.record(l.conn.limit(admitted), l.conn.ResourceName)
+		return &routerClient{meteredConn: meteredConn{Conn: client, metrics: &l.conn.metrics}, release: release}, nil
+	}
+}
+
+// routerClient records the end of a client connection and gives back its
+// slot under the connection limit once
+type routerClient struct {
+	meteredConn
+	release func()
+	once    sync.Once
+}
+
+func (c *routerClient) Close() error {
+	c.once.Do(func() {
+		c.metrics.closed()
+		c.release()
+	})
+	return c.meteredConn.Close()
+}
+
+// runRouter runs one attempt of a router forward: it dials a tunnel for
+// every route and serves HTTP on the local endpoint until a tunnel drops, a
+// routed pod goes away or the router is stopped.
+func (m *Manager) runRouter(ctx context.Context, conn *Connection) (established bool, err error) {
+	attemptCtx, cancelAttempt := context.WithCancel(ctx)
+	defer cancelAttempt()
+
+	conn.mu.RLock()
+	routes := append([]Route(nil), conn.Routes...)
+	conn.mu.RUnlock()
+
+	var backends []*routeBackend
+	defer func() {
+		for _, b := range backends {
+			b.close()
+		}
+	}()
+	lost := make(chan error, len(routes))
+	for _, r := range routes {
+		b, selector, err := m.dialRoute(ctx, conn, r)
+		if err != nil {
+			conn.AddLog(fmt.Sprintf("✗ Route %s: %v", r.Match(), err))
+			return false, fmt.Errorf("route %s: %w", r.Match(), err)
+		}
+		backends = append(backends, b)
+		conn.AddLog(fmt.Sprintf("Route %s -> %s:%d (%s)", r.Match(), b.pod, b.port, r.Target()))
+
+		var failover <-chan string
+		if selector != "" {
+			failover = m.watchPod(attemptCtx, conn.cluster, conn.Namespace, selector, b.pod)
+		}
+		go func() {
+			select {
+			case <-b.tunnel.closed():
+				lost <- fmt.Errorf("lost connection to pod %s", b.pod)
+			case reason := <-failover:
+				lost <- fmt.Errorf("%w: pod %s %s", errPodFailover, b.pod, reason)
+			case <-attemptCtx.Done():
+			}
+		}()
+	}
+	sortRoutes(backends)
+
+	listeners, err := openListeners(conn)
+	if err != nil {
+		return false, err
+	}
+	server := &http.Server{
+		Handler:           &router{conn: conn, backends: backends},
+		ReadHeaderTimeout: 30 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	defer server.Close()
+	serveErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logger.Debug("portforward", "Routing HTTP from %s", l.Addr())
+		go func(l net.Listener) {
+			serveErr <- server.Serve(meteredListener{Listener: l, conn: conn})
+		}(l.Listener)
+	}
+
+	conn.mu.Lock()
+	reconnected := conn.Status == StatusReconnecting
+	reconnects := conn.ReconnectCount
+	conn.Status = StatusActive
+	conn.Error = ""
+	conn.mu.Unlock()
+	conn.AddLog("✓ Router ready")
+	if reconnected {
+		conn.AddLog(fmt.Sprintf("✓ Reconnected (total reconnects: %d)", reconnects))
+	}
+	logger.Info("portforward", "Router ready: %s (%d routes)", conn.ID, len(routes))
+	conn.markReady()
+	m.notifyChange()
+
+	select {
+	case err := <-lost:
+		// The supervisor re-dials every route, like a failover of a forward
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		logger.Warn("portforward", "Router %s: %v", conn.ID, err)
+		return true, err
+
+	case err := <-serveErr:
+		conn.AddLog(fmt.Sprintf("✗ Router error: %v", err))
+		return true, err
+
+	case <-conn.stopChan:
+		conn.AddLog("Stop signal received")
+		conn.mu.Lock()
+		if conn.Status != StatusStopped {
+			conn.Status = StatusStopped
+			conn.StoppedAt = time.Now()
+		}
+		conn.mu.Unlock()
+		m.notifyChange()
+		return true, nil
+
+	case <-ctx.Done():
+		conn.AddLog("Shutting down...")
+		return true, nil
+	}
+}
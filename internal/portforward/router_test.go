@@ -0,0 +1,168 @@
+package portforward_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		in, want string
+		host     string
+		path     string
+	}{
+		{in: "/api=svc/api:8080", want: "/api=svc/api:8080", path: "/api"},
+		{in: "/=service/web:80", want: "/=svc/web:80", path: "/"},
+		{in: "admin.localhost=deploy/admin:http", want: "admin.localhost/=deploy/admin:http", host: "admin.localhost", path: "/"},
+		{in: "app.localhost/v1/=web-0:8080", want: "app.localhost/v1=pod/web-0:8080", host: "app.localhost", path: "/v1"},
+	}
+	for _, tt := range tests {
+		r, err := portforward.ParseRoute(tt.in)
+		if err != nil {
+			t.Errorf("ParseRoute(%q): %v", tt.in, err)
+			continue
+		}
+		if r.String() != tt.want || r.Host != tt.host || r.PathPrefix != tt.path {
+			t.Errorf("ParseRoute(%q) = %q (host %q, path %q), want %q", tt.in, r, r.Host, r.PathPrefix, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"svc/api:80", "/api=svc/api", "/api=svc/api:0", "/=router/other:80", "/=bogus/x:80"} {
+		if _, err := portforward.ParseRoute(bad); err == nil {
+			t.Errorf("ParseRoute(%q): expected an error", bad)
+		}
+	}
+}
+
+// httpPod routes port 8080 of a pod to an HTTP server answering with the
+// pod name and the request path. Upgrade requests get a raw echo.
+func httpPod(t *testing.T, dialer *portforwardtest.Dialer, pod string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "" {
+			fmt.Fprintf(w, "%s %s", pod, r.URL.Path)
+			return
+		}
+		client, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		buf.Flush()
+		io.Copy(client, buf)
+	}))
+	t.Cleanup(server.Close)
+	dialer.Route(namespace, pod, 8080, server.Listener.Addr().String())
+}
+
+func TestRouterRoutesByPath(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("api-0", nil), runningPod("web-0", nil))
+	httpPod(t, dialer, "api-0")
+	httpPod(t, dialer, "web-0")
+
+	routes, err := portforward.ParseRoutes([]string{"/=web-0:8080", "/api=api-0:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := m.StartWithOptions(context.Background(), portforward.ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: portforward.ResourceRouter,
+		ResourceName: "frontend",
+		Ports:        []portforward.PortMapping{{}},
+		Routes:       routes,
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if !strings.HasSuffix(conn.ID, "->http") {
+		t.Errorf("ID = %s", conn.ID)
+	}
+
+	for path, want := range map[string]string{
+		"/api/users": "api-0 /api/users",
+		"/api":       "api-0 /api",
+		"/apidocs":   "web-0 /apidocs",
+		"/":          "web-0 /",
+	} {
+		resp, err := http.Get("http://" + localAddr(conn) + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("GET %s = %q, want %q", path, body, want)
+		}
+	}
+
+	// Every request is logged
+	logged := 0
+	for _, line := range conn.GetLogs() {
+		if strings.Contains(line, "→ GET") {
+			logged++
+		}
+	}
+	if logged != 4 {
+		t.Errorf("%d requests logged, want 4", logged)
+	}
+}
+
+func TestRouterUpgrade(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("ws-0", nil))
+	httpPod(t, dialer, "ws-0")
+
+	conn, err := m.StartWithOptions(context.Background(), portforward.ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: portforward.ResourceRouter,
+		ResourceName: "ws",
+		Ports:        []portforward.PortMapping{{}},
+		Routes:       []portforward.Route{{ResourceType: portforward.ResourcePod, ResourceName: "ws-0", Port: portforward.PortMapping{Remote: 8080}}},
+	})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	client, err := net.Dial("tcp", localAddr(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	fmt.Fprintf(client, "GET /socket HTTP/1.1\r\nHost: app\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	client.Write([]byte("ping"))
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(reader, got); err != nil || string(got) != "ping" {
+		t.Errorf("echo = %q, %v", got, err)
+	}
+}
+
+func TestRouterNeedsRoutes(t *testing.T) {
+	m, _ := newTestManager(t)
+	_, err := m.StartWithOptions(context.Background(), portforward.ForwardOptions{
+		Namespace:    namespace,
+		ResourceType: portforward.ResourceRouter,
+		ResourceName: "empty",
+		Ports:        []portforward.PortMapping{{}},
+	})
+	if err == nil {
+		t.Error("expected an error for a router without routes")
+	}
+}
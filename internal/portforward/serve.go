@@ -0,0 +1,122 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// localListener accepts local clients for one port mapping of a connection
+type localListener struct {
+	net.Listener
+	mapping int // index into the connection's port mappings
+}
+
+// openListeners listens on the connection's Unix socket, or on every bind
+// address of each port mapping. Automatic ports still bound from their
+// allocation are taken over instead of listened on again.
+func openListeners(conn *Connection) ([]localListener, error) {
+	if conn.SocketPath != "" {
+		listener, err := listenSocket(conn.SocketPath, conn.SocketMode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to listen on %s: %w", conn.SocketPath, err)
+		}
+		if conn.TLS != nil && conn.TLS.Mode == TLSTerminate {
+			listener = tlsListener{Listener: listener, config: conn.tlsConfig}
+		}
+		return []localListener{{Listener: listener}}, nil
+	}
+
+	listeners := conn.takeReserved()
+	bound := make(map[int]bool)
+	for _, l := range listeners {
+		bound[l.mapping] = true
+	}
+	for i, p := range conn.portMappings() {
+		if bound[i] {
+			continue
+		}
+		for _, addr := range conn.Addresses {
+			ls, err := listenTCP(addr, p.Local)
+			if err != nil {
+				closeListeners(listeners)
+				return nil, fmt.Errorf("unable to listen on %s: %w", listenAddress(addr, p.Local), err)
+			}
+			for _, l := range ls {
+				listeners = append(listeners, localListener{Listener: l, mapping: i})
+			}
+		}
+	}
+	if conn.TLS != nil && conn.TLS.Mode == TLSTerminate {
+		for i := range listeners {
+			listeners[i].Listener = tlsListener{Listener: listeners[i].Listener, config: conn.tlsConfig}
+		}
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []localListener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// takeReserved hands over the listeners bound when the connection's
+// automatic ports were allocated, if they weren't taken yet
+func (c *Connection) takeReserved() []localListener {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	listeners := c.reserved
+	c.reserved = nil
+	return listeners
+}
+
+// forwardTunnel serves the connection's local listeners through one tunnel
+// to pod until stop is closed or the tunnel drops. ready is closed once
+// clients can connect; ctx bounds the dial.
+func (m *Manager) forwardTunnel(ctx context.Context, conn *Connection, pod string, ports []int, stop <-chan struct{}, ready chan struct{}) error {
+	t, err := m.dialTunnel(ctx, conn.cluster, conn.Namespace, pod, ports)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	conn.AddLog(fmt.Sprintf("Tunnel transport: %s", t.transport))
+
+	listeners, err := openListeners(conn)
+	if err != nil {
+		return err
+	}
+	defer closeListeners(listeners)
+
+	done := make(chan struct{})
+	defer close(done)
+	go conn.serveProbes(func() *tunnel { return t }, done)
+
+	acceptErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logger.Debug("portforward", "Forwarding from %s -> %d", l.Addr(), ports[l.mapping])
+		go func(l localListener) {
+			for {
+				client, err := l.Accept()
+				if err != nil {
+					acceptErr <- err
+					return
+				}
+				logger.Debug("portforward", "Handling connection for %s", l.Addr())
+				go conn.serveClient(client, t, l.mapping)
+			}
+		}(l)
+	}
+	close(ready)
+
+	select {
+	case <-stop:
+		return nil
+	case <-t.closed():
+		return fmt.Errorf("lost connection to pod")
+	case err := <-acceptErr:
+		return err
+	}
+}
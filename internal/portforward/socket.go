@@ -0,0 +1,124 @@
+package portforward
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// DefaultSocketMode is the permission of a forward's Unix socket unless told otherwise
+const DefaultSocketMode os.FileMode = 0600
+
+// ParseSocketMode parses octal socket permissions such as "0660". An empty
+// string gives DefaultSocketMode.
+func ParseSocketMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return DefaultSocketMode, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q (use octal permissions like 0660)", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// FormatSocketMode returns mode in the form accepted by ParseSocketMode
+func FormatSocketMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// normalizeSocketPath makes a socket path absolute so it doesn't depend on
+// the working directory of whoever restores the connection
+func normalizeSocketPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid socket path %q: %w", path, err)
+	}
+	return abs, nil
+}
+
+// listenSocket listens on a Unix socket at path with the given permissions.
+// A stale socket left behind by a crashed process is removed first; the
+// listener removes the file again when it's closed.
+func listenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// The socket is created in a private directory and only moved into
+	// place once it has its permissions, so nobody can connect before that
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".portfwd-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		listener.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+	return &socketListener{UnixListener: listener, path: path, file: info}, nil
+}
+
+// socketListener removes its socket file when it's closed, since the file
+// was moved away from where the listener created it. A file another
+// listener has since created at the same path is left alone.
+type socketListener struct {
+	*net.UnixListener
+	path string
+	file os.FileInfo // the socket file as created, to recognize it again
+}
+
+func (l *socketListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *socketListener) Close() error {
+	err := l.UnixListener.Close()
+	if info, statErr := os.Lstat(l.path); statErr == nil && os.SameFile(info, l.file) {
+		os.Remove(l.path)
+	}
+	return err
+}
+
+// removeStaleSocket removes a socket file nobody is listening on. Files that
+// aren't sockets and sockets still in use are left alone and reported.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+	logger.Info("portforward", "Removing stale socket %s", path)
+	return os.Remove(path)
+}
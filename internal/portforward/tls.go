@@ -0,0 +1,469 @@
+package portforward
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// TLSMode says which side of a forward speaks TLS
+type TLSMode string
+
+const (
+	TLSTerminate TLSMode = "terminate" // local clients speak TLS, plain traffic goes down the tunnel
+	TLSOriginate TLSMode = "originate" // local clients speak plain, the pod port is spoken to in TLS
+)
+
+// ParseTLSMode parses a TLS mode
+func ParseTLSMode(s string) (TLSMode, error) {
+	switch m := TLSMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case TLSTerminate, TLSOriginate:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown TLS mode %q (use terminate or originate)", s)
+	}
+}
+
+// TLSOptions configures TLS on the local listener (TLSTerminate) or toward
+// the pod port (TLSOriginate)
+type TLSOptions struct {
+	Mode     TLSMode
+	CertFile string // terminate: server certificate, generated from the local CA if empty; originate: client certificate
+	KeyFile  string // private key of CertFile
+
+	// TLSTerminate only
+	ClientCA string   // require client certificates signed by this CA (mTLS)
+	Hosts    []string // extra names of a generated certificate
+
+	// TLSOriginate only
+	ServerName string // SNI and expected certificate name; <service>.<namespace>.svc for services if empty
+	RootCA     string // CA the pod's certificate must chain to; the system roots if empty
+	Insecure   bool   // don't verify the pod's certificate
+}
+
+// String describes the TLS settings, e.g. "terminate, mTLS" or "originate to api.team-a.svc"
+func (o TLSOptions) String() string {
+	parts := []string{string(o.Mode)}
+	switch o.Mode {
+	case TLSTerminate:
+		if o.CertFile == "" {
+			parts = append(parts, "local CA")
+		}
+		if o.ClientCA != "" {
+			parts = append(parts, "mTLS")
+		}
+	case TLSOriginate:
+		if o.ServerName != "" {
+			parts[0] += " to " + o.ServerName
+		}
+		if o.CertFile != "" {
+			parts = append(parts, "client certificate")
+		}
+		if o.Insecure {
+			parts = append(parts, "unverified")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// normalize validates the options, makes file paths absolute and fills in
+// the server name of a TLS origination to a service
+func (o TLSOptions) normalize(namespace string, resType ResourceType, name string) (TLSOptions, error) {
+	mode, err := ParseTLSMode(string(o.Mode))
+	if err != nil {
+		return o, err
+	}
+	o.Mode = mode
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return o, fmt.Errorf("a TLS certificate needs both a cert and a key file")
+	}
+	if mode == TLSTerminate && (o.ServerName != "" || o.RootCA != "" || o.Insecure) {
+		return o, fmt.Errorf("server name, root CA and insecure only apply to TLS origination")
+	}
+	if mode == TLSOriginate && (o.ClientCA != "" || len(o.Hosts) > 0) {
+		return o, fmt.Errorf("client CA and hosts only apply to TLS termination")
+	}
+	for _, path := range []*string{&o.CertFile, &o.KeyFile, &o.ClientCA, &o.RootCA} {
+		if *path == "" {
+			continue
+		}
+		if *path, err = filepath.Abs(*path); err != nil {
+			return o, fmt.Errorf("invalid TLS file path: %w", err)
+		}
+	}
+	if mode == TLSOriginate && o.ServerName == "" {
+		switch {
+		case resType == ResourceService:
+			o.ServerName = name + "." + namespace + ".svc"
+		case !o.Insecure:
+			return o, fmt.Errorf("TLS origination to a %s needs a server name", resType)
+		}
+	}
+	return o, nil
+}
+
+// tlsHandshakeTimeout bounds the TLS handshake of a client connection
+const tlsHandshakeTimeout = 10 * time.Second
+
+// DefaultTLSDir returns where the local CA and generated certificates are
+// kept: portfwd/tls in the user's config directory
+func DefaultTLSDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "portfwd", "tls")
+}
+
+// SetTLSDir sets where the local CA and generated certificates are kept,
+// DefaultTLSDir if empty
+func (m *Manager) SetTLSDir(dir string) {
+	m.mu.Lock()
+	m.tlsDir = dir
+	m.mu.Unlock()
+}
+
+func (m *Manager) tlsDirectory() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.tlsDir == "" {
+		return DefaultTLSDir()
+	}
+	return m.tlsDir
+}
+
+// tlsConfig loads the certificates of opts into a TLS configuration and
+// returns the lines describing it for the connection log
+func (m *Manager) tlsConfig(opts TLSOptions, addresses []string) (*tls.Config, []string, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	var lines []string
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch opts.Mode {
+	case TLSTerminate:
+		if opts.CertFile == "" {
+			names := certificateNames(addresses, opts.Hosts)
+			cert, caPath, err := LocalCertificate(m.tlsDirectory(), names)
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+			lines = append(lines, fmt.Sprintf("TLS: terminating with a certificate for %s from the local CA %s", strings.Join(names, ", "), caPath))
+		} else {
+			lines = append(lines, fmt.Sprintf("TLS: terminating with %s", opts.CertFile))
+		}
+		if opts.ClientCA != "" {
+			pool, err := loadCertPool(opts.ClientCA)
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			lines = append(lines, fmt.Sprintf("TLS: requiring client certificates signed by %s", opts.ClientCA))
+		}
+
+	case TLSOriginate:
+		cfg.ServerName = opts.ServerName
+		cfg.InsecureSkipVerify = opts.Insecure
+		if opts.RootCA != "" {
+			pool, err := loadCertPool(opts.RootCA)
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg.RootCAs = pool
+		}
+		line := "TLS: originating to the pod"
+		if opts.ServerName != "" {
+			line += " with SNI " + opts.ServerName
+		}
+		if opts.Insecure {
+			line += " (certificate not verified)"
+		}
+		lines = append(lines, line)
+		if opts.CertFile != "" {
+			lines = append(lines, fmt.Sprintf("TLS: presenting client certificate %s", opts.CertFile))
+		}
+	}
+	return cfg, lines, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// certificateNames returns the names a generated certificate is valid for:
+// localhost, the loopback addresses, the specific bind addresses and hosts
+func certificateNames(addresses, hosts []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range []string{"localhost", "127.0.0.1", "::1"} {
+		add(name)
+	}
+	for _, addr := range addresses {
+		if ip := net.ParseIP(addr); ip == nil || !ip.IsUnspecified() {
+			add(addr)
+		}
+	}
+	for _, host := range hosts {
+		add(strings.ToLower(host))
+	}
+	return names
+}
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 397 * 24 * time.Hour // the longest lifetime browsers accept
+	certRenewal  = 30 * 24 * time.Hour  // certificates closer than this to expiry are replaced
+)
+
+// certMu serializes certificate generation within the process
+var certMu sync.Mutex
+
+// LocalCA returns the local CA kept in dir and the path of its certificate,
+// creating it on first use. Trusting that certificate makes clients accept
+// the certificates generated for TLS termination.
+func LocalCA(dir string) (tls.Certificate, string, error) {
+	certMu.Lock()
+	defer certMu.Unlock()
+	return localCA(dir)
+}
+
+func localCA(dir string) (tls.Certificate, string, error) {
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if ca, err := loadKeyPair(certPath, keyPath); err == nil && time.Until(ca.Leaf.NotAfter) > certRenewal {
+		return ca, certPath, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return tls.Certificate{}, "", fmt.Errorf("failed to load local CA: %w", err)
+	}
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"portfwd"}, CommonName: "portfwd local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	ca, err := writeCertificate(dir, "ca", template, nil)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to create local CA: %w", err)
+	}
+	logger.Info("portforward", "Created local CA %s", certPath)
+	return ca, certPath, nil
+}
+
+// LocalCertificate returns a certificate for names signed by the local CA in
+// dir, and the path of the CA certificate. Certificates are cached in dir and
+// reused until they get close to expiry.
+func LocalCertificate(dir string, names []string) (tls.Certificate, string, error) {
+	certMu.Lock()
+	defer certMu.Unlock()
+
+	ca, caPath, err := localCA(dir)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(sorted, ",")))
+	base := "cert-" + hex.EncodeToString(h.Sum(nil))
+
+	if cert, err := loadKeyPair(filepath.Join(dir, base+".crt"), filepath.Join(dir, base+".key")); err == nil &&
+		time.Until(cert.Leaf.NotAfter) > certRenewal && cert.Leaf.CheckSignatureFrom(ca.Leaf) == nil {
+		return cert, caPath, nil
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"portfwd"}, CommonName: names[0]},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(certValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	cert, err := writeCertificate(dir, base, template, &ca)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+	logger.Info("portforward", "Created TLS certificate for %s", strings.Join(names, ", "))
+	return cert, caPath, nil
+}
+
+// writeCertificate creates a key and a certificate from template, signed by
+// parent or self-signed if nil, and saves them as dir/base.crt and .key
+func writeCertificate(dir, base string, template *x509.Certificate, parent *tls.Certificate) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return tls.Certificate{}, err
+	}
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := writeFileAtomic(filepath.Join(dir, base+".key"), keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, base+".crt"), certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// writeFileAtomic replaces path with data, so that another process never
+// reads a half-written file
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadKeyPair loads a certificate and key with the parsed certificate in Leaf
+func loadKeyPair(certPath, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return cert, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return cert, err
+		}
+	}
+	return cert, nil
+}
+
+// tlsListener hands out the local clients of a TLS terminating forward as
+// *tls.Conn; serveClient finishes their handshake
+type tlsListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+func (l tlsListener) Accept() (net.Conn, error) {
+	client, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(client, l.config), nil
+}
+
+// handshake completes the TLS handshake of a local client
+func handshake(client *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	return client.HandshakeContext(ctx)
+}
+
+// handleOriginTLS forwards a plain local client through t, speaking TLS to
+// the pod port of mapping i
+func handleOriginTLS(client net.Conn, t *tunnel, i int, config *tls.Config) error {
+	defer client.Close()
+
+	local, remote := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- t.handle(remote, i)
+	}()
+
+	server := tls.Client(local, config)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	err := server.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		server.Close()
+		if tunnelErr := <-done; tunnelErr != nil {
+			return tunnelErr
+		}
+		return fmt.Errorf("TLS handshake with pod: %w", err)
+	}
+
+	go func() {
+		// Tell the pod the client is done sending, keep reading its answer
+		io.Copy(server, client)
+		server.CloseWrite()
+	}()
+	io.Copy(client, server)
+	client.Close()
+	server.Close()
+	return <-done
+}
@@ -0,0 +1,244 @@
+package portforward_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+	"github.com/pyqan/portFwd/internal/portforward/portforwardtest"
+)
+
+// tlsRoundTrip sends msg through a TLS connection to addr and returns what
+// came back
+func tlsRoundTrip(addr, msg string, config *tls.Config) (string, error) {
+	c, err := tls.DialWithDialer(&net.Dialer{Timeout: 2 * time.Second}, "tcp", addr, config)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(c, msg); err != nil {
+		return "", err
+	}
+	c.CloseWrite()
+	got, err := io.ReadAll(c)
+	return string(got), err
+}
+
+// localCAPool returns the local CA of dir as a certificate pool
+func localCAPool(t *testing.T, dir string) *x509.CertPool {
+	t.Helper()
+	_, path, err := portforward.LocalCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(data)
+	return pool
+}
+
+func TestTLSTermination(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web-0", nil))
+	dir := t.TempDir()
+	m.SetTLSDir(dir)
+	if err := dialer.EchoPod(namespace, "web-0", 8443); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := forwardPod("web-0", 8443)
+	opts.TLS = &portforward.TLSOptions{Mode: portforward.TLSTerminate, Hosts: []string{"web.local"}}
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	pool := localCAPool(t, dir)
+	for _, name := range []string{"localhost", "web.local"} {
+		got, err := tlsRoundTrip(localAddr(conn), "hello", &tls.Config{RootCAs: pool, ServerName: name})
+		if err != nil || got != "hello" {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	// Plain clients fail the handshake and are counted as errors
+	roundTrip(t, localAddr(conn), "plain")
+	waitFor(t, "handshake error", func() bool { return conn.GetMetrics().Errors == 1 })
+}
+
+// clientCA writes a CA to dir and returns its path and a client certificate
+// signed by it
+func clientCA(t *testing.T, dir string) (string, tls.Certificate) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "client-ca.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "developer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("web-0", nil))
+	dir := t.TempDir()
+	m.SetTLSDir(dir)
+	if err := dialer.EchoPod(namespace, "web-0", 8443); err != nil {
+		t.Fatal(err)
+	}
+	caPath, clientCert := clientCA(t, dir)
+
+	opts := forwardPod("web-0", 8443)
+	opts.TLS = &portforward.TLSOptions{Mode: portforward.TLSTerminate, ClientCA: caPath}
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	config := &tls.Config{RootCAs: localCAPool(t, dir), ServerName: "localhost"}
+	if got, err := tlsRoundTrip(localAddr(conn), "anonymous", config); err == nil && got != "" {
+		t.Errorf("client without certificate got %q", got)
+	}
+
+	config.Certificates = []tls.Certificate{clientCert}
+	if got, err := tlsRoundTrip(localAddr(conn), "hello", config); err != nil || got != "hello" {
+		t.Errorf("client with certificate: got %q, %v", got, err)
+	}
+}
+
+// tlsEchoPod routes port 8443 of a pod to a TLS echo server with cert and
+// returns the server names clients asked for
+func tlsEchoPod(t *testing.T, dialer *portforwardtest.Dialer, pod string, cert tls.Certificate) <-chan string {
+	t.Helper()
+	names := make(chan string, 10)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			names <- hello.ServerName
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	dialer.Route(namespace, pod, 8443, l.Addr().String())
+	return names
+}
+
+func TestTLSOrigination(t *testing.T) {
+	m, dialer := newTestManager(t, runningPod("api-0", nil))
+	dir := t.TempDir()
+	cert, caPath, err := portforward.LocalCertificate(dir, []string{"api.internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := tlsEchoPod(t, dialer, "api-0", cert)
+
+	opts := forwardPod("api-0", 8443)
+	opts.TLS = &portforward.TLSOptions{Mode: portforward.TLSOriginate, ServerName: "api.internal", RootCA: caPath}
+	conn, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if got := roundTrip(t, localAddr(conn), "hello"); got != "hello" {
+		t.Errorf("got %q, want hello", got)
+	}
+	if sni := <-names; sni != "api.internal" {
+		t.Errorf("SNI = %q, want api.internal", sni)
+	}
+
+	// A pod certificate for another name is refused
+	opts = forwardPod("api-0", 8443)
+	opts.TLS = &portforward.TLSOptions{Mode: portforward.TLSOriginate, ServerName: "other.internal", RootCA: caPath}
+	other, err := m.StartWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	c, err := net.Dial("tcp", localAddr(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(c, "hello")
+	if got, _ := io.ReadAll(c); len(got) > 0 {
+		t.Errorf("unverified pod answered %q", got)
+	}
+	waitFor(t, "verification error", func() bool { return other.GetMetrics().Errors == 1 })
+}
+
+func TestTLSOptionErrors(t *testing.T) {
+	m, _ := newTestManager(t, runningPod("web-0", nil))
+	m.SetTLSDir(t.TempDir())
+	for name, tlsOpts := range map[string]portforward.TLSOptions{
+		"bad mode":            {Mode: "both"},
+		"cert without key":    {Mode: portforward.TLSTerminate, CertFile: "cert.pem"},
+		"missing cert":        {Mode: portforward.TLSTerminate, CertFile: "missing.pem", KeyFile: "missing.key"},
+		"sni on terminate":    {Mode: portforward.TLSTerminate, ServerName: "web"},
+		"pod without sni":     {Mode: portforward.TLSOriginate},
+		"client CA originate": {Mode: portforward.TLSOriginate, ServerName: "web", ClientCA: "ca.pem"},
+	} {
+		tlsOpts := tlsOpts
+		opts := forwardPod("web-0", 8443)
+		opts.TLS = &tlsOpts
+		if _, err := m.StartWithOptions(context.Background(), opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gwebsocket "github.com/gorilla/websocket"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	spdystream "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/transport/websocket"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// TransportMode selects how tunnels reach the API server
+type TransportMode string
+
+const (
+	TransportAuto      TransportMode = "auto"      // WebSocket, falling back to SPDY if the server can't upgrade
+	TransportWebSocket TransportMode = "websocket" // WebSocket only
+	TransportSPDY      TransportMode = "spdy"      // SPDY only, like kubectl before 1.31
+)
+
+// ParseTransportMode parses a transport as used in the config file; empty means auto
+func ParseTransportMode(s string) (TransportMode, error) {
+	switch t := TransportMode(strings.ToLower(strings.TrimSpace(s))); t {
+	case "", TransportAuto:
+		return TransportAuto, nil
+	case TransportWebSocket, TransportSPDY:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown transport %q (use auto, websocket or spdy)", s)
+	}
+}
+
+// websocketTunnelPrefix marks the WebSocket subprotocol that carries a SPDY
+// session, e.g. "SPDY/3.1+portforward.k8s.io"
+const websocketTunnelPrefix = "SPDY/3.1+"
+
+// websocketPingPeriod keeps proxies from closing idle WebSocket tunnels
+const websocketPingPeriod = 5 * time.Second
+
+// TunnelDialer opens port-forward sessions to pods. The manager's default
+// dialer goes through the API server; tests can inject one that doesn't.
+type TunnelDialer interface {
+	// Dial opens a session to pod and returns the transport it went over
+	Dial(namespace, pod string) (httpstream.Connection, TransportMode, error)
+}
+
+// apiDialer opens sessions through the pods/portforward subresource
+type apiDialer struct {
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+	mode       TransportMode
+}
+
+// Dial upgrades a request to the pod's port-forward subresource with the
+// dialer's transport
+func (d *apiDialer) Dial(namespace, pod string) (httpstream.Connection, TransportMode, error) {
+	req := d.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+	logger.Debug("portforward", "API URL: %s", req.URL())
+
+	if d.mode == TransportSPDY {
+		conn, err := d.dialSPDY(req.URL())
+		return conn, TransportSPDY, err
+	}
+
+	conn, err := d.dialWebSocket(req.URL())
+	if err == nil || d.mode == TransportWebSocket {
+		return conn, TransportWebSocket, err
+	}
+	if !httpstream.IsUpgradeFailure(err) {
+		return nil, TransportWebSocket, err
+	}
+
+	// Older API servers only speak SPDY
+	logger.Debug("portforward", "WebSocket upgrade for %s/%s failed, falling back to SPDY: %v", namespace, pod, err)
+	conn, err = d.dialSPDY(req.URL())
+	return conn, TransportSPDY, err
+}
+
+// dialSPDY upgrades a POST to the port-forward URL to SPDY
+func (d *apiDialer) dialSPDY(u *url.URL) (httpstream.Connection, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(d.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SPDY transport: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u)
+
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, fmt.Errorf("error upgrading connection: %w", err)
+	}
+	return conn, nil
+}
+
+// dialWebSocket upgrades a GET to the port-forward URL to a WebSocket and
+// runs the SPDY session through it, as kubectl does since 1.31
+func (d *apiDialer) dialWebSocket(u *url.URL) (httpstream.Connection, error) {
+	transport, holder, err := websocket.RoundTripperFor(d.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebSocket transport: %w", err)
+	}
+	// WebSocket handshakes must be GET requests
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := websocket.Negotiate(transport, holder, req, websocketTunnelPrefix+portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+	if ws.Subprotocol() != websocketTunnelPrefix+portforward.PortForwardProtocolV1Name {
+		ws.Close()
+		return nil, &httpstream.UpgradeFailureError{Cause: fmt.Errorf("server chose unsupported protocol %q", ws.Subprotocol())}
+	}
+
+	conn, err := spdystream.NewClientConnectionWithPings(&websocketConn{Conn: ws}, websocketPingPeriod)
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// websocketConn turns the binary messages of a WebSocket into the byte
+// stream a SPDY session expects
+type websocketConn struct {
+	*gwebsocket.Conn
+	reader  io.Reader // rest of the message being read
+	writeMu sync.Mutex
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			typ, r, err := c.NextReader()
+			if err != nil {
+				if gwebsocket.IsCloseError(err, gwebsocket.CloseNormalClosure) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if typ != gwebsocket.BinaryMessage {
+				return 0, fmt.Errorf("unexpected WebSocket message type %d", typ)
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.WriteMessage(gwebsocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close says goodbye to the server before closing the connection
+func (c *websocketConn) Close() error {
+	c.writeMu.Lock()
+	msg := gwebsocket.FormatCloseMessage(gwebsocket.CloseNormalClosure, "")
+	c.WriteControl(gwebsocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *websocketConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
@@ -0,0 +1,181 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// tunnel is a single port-forward session (one SPDY connection, possibly
+// carried over a WebSocket) to a pod.
+// Unlike client-go's PortForwarder it doesn't own a listener, so the manager
+// can decide which tunnel each local client connection goes through.
+type tunnel struct {
+	pod        string
+	ports      []int         // port inside the pod for each port mapping
+	transport  TransportMode // websocket or spdy
+	streamConn httpstream.Connection
+	requestID  int64
+	active     int64 // open client connections
+}
+
+// dialTunnel opens a port-forward session to a pod of a cluster. It gives
+// up when ctx ends; a session that still opens after that is closed again.
+func (m *Manager) dialTunnel(ctx context.Context, cl *cluster, namespace, pod string, ports []int) (*tunnel, error) {
+	m.mu.RLock()
+	var dialer TunnelDialer = &apiDialer{clientset: cl.clientset, restConfig: cl.restConfig, mode: m.transport}
+	if m.dialer != nil {
+		dialer = m.dialer
+	}
+	m.mu.RUnlock()
+
+	type dialResult struct {
+		streamConn httpstream.Connection
+		transport  TransportMode
+		err        error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		streamConn, transport, err := dialer.Dial(namespace, pod)
+		dialed <- dialResult{streamConn, transport, err}
+	}()
+
+	var r dialResult
+	select {
+	case r = <-dialed:
+	case <-ctx.Done():
+		go func() {
+			if r := <-dialed; r.err == nil {
+				r.streamConn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	streamConn, transport := r.streamConn, r.transport
+	logger.Debug("portforward", "Tunnel opened to %s/%s %v over %s", namespace, pod, ports, transport)
+
+	return &tunnel{
+		pod:        pod,
+		ports:      ports,
+		transport:  transport,
+		streamConn: streamConn,
+	}, nil
+}
+
+// activeConns returns the number of client connections using the tunnel
+func (t *tunnel) activeConns() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+// closed returns a channel that is closed when the session ends
+func (t *tunnel) closed() <-chan bool {
+	return t.streamConn.CloseChan()
+}
+
+// isClosed reports whether the session has ended
+func (t *tunnel) isClosed() bool {
+	select {
+	case <-t.streamConn.CloseChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the session and all of its streams
+func (t *tunnel) Close() error {
+	return t.streamConn.Close()
+}
+
+// handle copies data between a local client connection and the pod port of
+// mapping i (the same stream protocol client-go's PortForwarder speaks)
+func (t *tunnel) handle(local net.Conn, i int) error {
+	defer local.Close()
+
+	atomic.AddInt64(&t.active, 1)
+	defer atomic.AddInt64(&t.active, -1)
+
+	port := t.ports[i]
+	requestID := atomic.AddInt64(&t.requestID, 1)
+
+	// create error stream
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(port))
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.FormatInt(requestID, 10))
+	errorStream, err := t.streamConn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("error creating error stream for port %d: %w", port, err)
+	}
+	// we're not writing to this stream
+	errorStream.Close()
+	defer t.streamConn.RemoveStreams(errorStream)
+
+	errorChan := make(chan error)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- fmt.Errorf("error reading from error stream for port %d: %w", port, err)
+		case len(message) > 0:
+			errorChan <- fmt.Errorf("an error occurred forwarding to port %d: %s", port, string(message))
+		}
+		close(errorChan)
+	}()
+
+	// create data stream
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := t.streamConn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("error creating forwarding stream for port %d: %w", port, err)
+	}
+	defer t.streamConn.RemoveStreams(dataStream)
+
+	localError := make(chan struct{})
+	remoteDone := make(chan struct{})
+
+	go func() {
+		// Copy from the remote side to the local port
+		if _, err := io.Copy(local, dataStream); err != nil && !isClosedConnError(err) {
+			logger.Debug("portforward", "Error copying from %s:%d to local connection: %v", t.pod, port, err)
+		}
+		close(remoteDone)
+	}()
+
+	go func() {
+		// inform server we're not sending any more data after copy unblocks
+		defer dataStream.Close()
+
+		// Copy from the local port to the remote side
+		if _, err := io.Copy(dataStream, local); err != nil && !isClosedConnError(err) {
+			logger.Debug("portforward", "Error copying from local connection to %s:%d: %v", t.pod, port, err)
+			close(localError)
+		}
+	}()
+
+	// wait for either a local->remote error or for copying from remote->local to finish
+	select {
+	case <-remoteDone:
+	case <-localError:
+	}
+
+	// always expect something on errorChan (it may be nil)
+	return <-errorChan
+}
+
+func isClosedConnError(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
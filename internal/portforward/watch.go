@@ -0,0 +1,133 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// errPodFailover is returned by runPortForward when the backing pod of a
+// service forward went away and the tunnel should move to another pod
+var errPodFailover = errors.New("backing pod went away")
+
+// watchPod watches the pods matching selector and reports on the returned
+// channel (at most once) when podName is deleted, starts terminating or
+// stops being ready. The watch ends when ctx is cancelled.
+func (m *Manager) watchPod(ctx context.Context, cl *cluster, namespace, selector, podName string) <-chan string {
+	gone := make(chan string, 1)
+	var once sync.Once
+	signal := func(reason string) {
+		once.Do(func() {
+			logger.Debug("portforward", "Pod %s/%s %s", namespace, podName, reason)
+			gone <- reason
+		})
+	}
+
+	check := func(pod *corev1.Pod) {
+		if pod.DeletionTimestamp != nil {
+			signal("is terminating")
+		} else if !isPodReady(pod) {
+			signal("is no longer ready")
+		}
+	}
+
+	informer, err := m.startPodInformer(ctx, cl, namespace, selector, cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok && pod.Name == podName {
+				check(pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok && pod.Name == podName {
+				signal("was deleted")
+			}
+		},
+	})
+	if err != nil {
+		logger.Warn("portforward", "Failed to watch pods for %s/%s: %v", namespace, podName, err)
+		return gone
+	}
+
+	// The pod may have gone away or turned unready between picking it and
+	// the informer's initial list, which fires no update for it
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return
+		}
+		obj, exists, err := informer.GetStore().GetByKey(namespace + "/" + podName)
+		switch {
+		case err != nil:
+			logger.Warn("portforward", "Failed to look up pod %s/%s: %v", namespace, podName, err)
+		case !exists:
+			signal("was deleted")
+		default:
+			if pod, ok := obj.(*corev1.Pod); ok {
+				check(pod)
+			}
+		}
+	}()
+
+	logger.Debug("portforward", "Watching pod %s/%s (selector: %s)", namespace, podName, selector)
+	return gone
+}
+
+// startPodInformer starts an informer for the pods matching selector and
+// registers handler on it. The informer runs until ctx is cancelled.
+func (m *Manager) startPodInformer(ctx context.Context, cl *cluster, namespace, selector string, handler cache.ResourceEventHandler) (cache.SharedIndexInformer, error) {
+	factory := m.newInformerFactory(cl, namespace, selector)
+	informer := factory.Core().V1().Pods().Informer()
+	if _, err := informer.AddEventHandler(handler); err != nil {
+		return nil, err
+	}
+
+	factory.Start(ctx.Done())
+	return informer, nil
+}
+
+// startEndpointSliceInformer starts an informer for the EndpointSlices of a
+// service and registers handler on it. The informer runs until ctx is cancelled.
+func (m *Manager) startEndpointSliceInformer(ctx context.Context, cl *cluster, namespace, service string, handler cache.ResourceEventHandler) (cache.SharedIndexInformer, error) {
+	factory := m.newInformerFactory(cl, namespace, discoveryv1.LabelServiceName+"="+service)
+	informer := factory.Discovery().V1().EndpointSlices().Informer()
+	if _, err := informer.AddEventHandler(handler); err != nil {
+		return nil, err
+	}
+
+	factory.Start(ctx.Done())
+	return informer, nil
+}
+
+// newInformerFactory returns an informer factory of a cluster scoped to
+// namespace and a label selector
+func (m *Manager) newInformerFactory(cl *cluster, namespace, selector string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(cl.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		}),
+	)
+}
+
+// isPodReady reports whether a pod is running, ready and not terminating
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
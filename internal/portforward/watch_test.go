@@ -0,0 +1,118 @@
+package portforward_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/pyqan/portFwd/internal/portforward"
+)
+
+// setReadyEndpoints replaces the web service's EndpointSlice
+func setReadyEndpoints(t *testing.T, clientset *fake.Clientset, ready map[string]bool) {
+	t.Helper()
+	_, err := clientset.DiscoveryV1().EndpointSlices(namespace).Update(context.Background(), endpointSlice(ready), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForPod waits until conn is active on pod
+func waitForPod(t *testing.T, conn *portforward.Connection, pod string) {
+	t.Helper()
+	waitFor(t, "failover to "+pod, func() bool {
+		info := conn.GetConnectionInfo()
+		return info.PodName == pod && info.Status == portforward.StatusActive
+	})
+}
+
+func TestFailoverWhenPodIsDeleted(t *testing.T) {
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	labels := map[string]string{"app": "web"}
+	m, dialer, clientset := newTestCluster(t,
+		webService(),
+		runningPod("web-a", labels, httpPort),
+		runningPod("web-b", labels, httpPort),
+		endpointSlice(map[string]bool{"web-a": true, "web-b": true}),
+	)
+	dialer.EchoPod(namespace, "web-a", 8080)
+	dialer.EchoPod(namespace, "web-b", 8080)
+
+	conn, err := m.StartWithOptions(context.Background(), forwardService("web", 80))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if pod := conn.GetConnectionInfo().PodName; pod != "web-a" {
+		t.Fatalf("pod = %q, want web-a", pod)
+	}
+	addr := localAddr(conn)
+
+	setReadyEndpoints(t, clientset, map[string]bool{"web-b": true})
+	if err := clientset.CoreV1().Pods(namespace).Delete(context.Background(), "web-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForPod(t, conn, "web-b")
+
+	// Clients keep using the same local port
+	if got := roundTrip(t, addr, "moved"); got != "moved" {
+		t.Errorf("echo = %q, want moved", got)
+	}
+	logs := strings.Join(conn.GetLogs(), "\n")
+	for _, want := range []string{"Pod web-a was deleted", "Switched from pod web-a to pod web-b"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs lack %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestFailoverWhenPodIsGoneAtSync(t *testing.T) {
+	// The EndpointSlice still lists web-a, but by the time the pod watch
+	// starts it's gone or unready, which no watch event reports
+	httpPort := corev1.ContainerPort{Name: "http", ContainerPort: 8080}
+	labels := map[string]string{"app": "web"}
+	unready := runningPod("web-a", labels, httpPort)
+	unready.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	tests := []struct {
+		name   string
+		pods   []*corev1.Pod
+		reason string
+	}{
+		{"deleted", nil, "Pod web-a was deleted"},
+		{"unready", []*corev1.Pod{unready}, "Pod web-a is no longer ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{
+				webService(),
+				runningPod("web-b", labels, httpPort),
+				endpointSlice(map[string]bool{"web-a": true}),
+			}
+			for _, pod := range tt.pods {
+				objects = append(objects, pod.DeepCopy())
+			}
+			m, dialer, clientset := newTestCluster(t, objects...)
+			dialer.EchoPod(namespace, "web-a", 8080)
+			dialer.EchoPod(namespace, "web-b", 8080)
+
+			conn, err := m.StartWithOptions(context.Background(), forwardService("web", 80))
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			setReadyEndpoints(t, clientset, map[string]bool{"web-b": true})
+			waitForPod(t, conn, "web-b")
+
+			if got := roundTrip(t, localAddr(conn), "moved"); got != "moved" {
+				t.Errorf("echo = %q, want moved", got)
+			}
+			if logs := strings.Join(conn.GetLogs(), "\n"); !strings.Contains(logs, tt.reason) {
+				t.Errorf("logs lack %q:\n%s", tt.reason, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pyqan/portFwd/internal/logger"
+)
+
+// resourceAliases maps the names kubectl accepts to resource types
+var resourceAliases = map[string]ResourceType{
+	"pod": ResourcePod, "pods": ResourcePod, "po": ResourcePod,
+	"service": ResourceService, "services": ResourceService, "svc": ResourceService,
+	"deployment": ResourceDeployment, "deployments": ResourceDeployment, "deploy": ResourceDeployment,
+	"statefulset": ResourceStatefulSet, "statefulsets": ResourceStatefulSet, "sts": ResourceStatefulSet,
+	"replicaset": ResourceReplicaSet, "replicasets": ResourceReplicaSet, "rs": ResourceReplicaSet,
+	"daemonset": ResourceDaemonSet, "daemonsets": ResourceDaemonSet, "ds": ResourceDaemonSet,
+	"job": ResourceJob, "jobs": ResourceJob,
+	"router": ResourceRouter,
+}
+
+// ParseResourceType parses a resource type name or kubectl alias (e.g. "deploy")
+func ParseResourceType(s string) (ResourceType, error) {
+	if t, ok := resourceAliases[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("unsupported resource type %q", s)
+}
+
+// ParseResourceRef parses a kubectl-style reference like "deploy/foo".
+// A bare name refers to a pod.
+func ParseResourceRef(ref string) (ResourceType, string, error) {
+	kind, name, found := strings.Cut(ref, "/")
+	if !found {
+		kind, name = "pod", ref
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("invalid resource %q: missing name", ref)
+	}
+	t, err := ParseResourceType(kind)
+	if err != nil {
+		return "", "", err
+	}
+	return t, name, nil
+}
+
+// ShortName returns the kubectl short name used in connection IDs
+func (t ResourceType) ShortName() string {
+	switch t {
+	case ResourceService:
+		return "svc"
+	case ResourceDeployment:
+		return "deploy"
+	case ResourceStatefulSet:
+		return "sts"
+	case ResourceReplicaSet:
+		return "rs"
+	case ResourceDaemonSet:
+		return "ds"
+	case ResourceJob:
+		return "job"
+	case ResourceRouter:
+		return "router"
+	default:
+		return "pod"
+	}
+}
+
+// IsWorkload reports whether the resource manages pods through a pod template
+func (t ResourceType) IsWorkload() bool {
+	switch t {
+	case ResourceDeployment, ResourceStatefulSet, ResourceReplicaSet, ResourceDaemonSet, ResourceJob:
+		return true
+	}
+	return false
+}
+
+// lookupWorkload fetches the connection's workload and returns the label
+// selector of its pods
+func (m *Manager) lookupWorkload(ctx context.Context, conn *Connection) (string, error) {
+	logger.Debug("portforward", "Looking up %s: %s/%s", conn.ResourceType, conn.Namespace, conn.ResourceName)
+
+	var selector *metav1.LabelSelector
+	var err error
+	switch conn.ResourceType {
+	case ResourceDeployment:
+		obj, getErr := conn.cluster.clientset.AppsV1().Deployments(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = obj.Spec.Selector
+		}
+	case ResourceStatefulSet:
+		obj, getErr := conn.cluster.clientset.AppsV1().StatefulSets(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = obj.Spec.Selector
+		}
+	case ResourceReplicaSet:
+		obj, getErr := conn.cluster.clientset.AppsV1().ReplicaSets(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = obj.Spec.Selector
+		}
+	case ResourceDaemonSet:
+		obj, getErr := conn.cluster.clientset.AppsV1().DaemonSets(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = obj.Spec.Selector
+		}
+	case ResourceJob:
+		obj, getErr := conn.cluster.clientset.BatchV1().Jobs(conn.Namespace).Get(ctx, conn.ResourceName, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			selector = obj.Spec.Selector
+		}
+	default:
+		err = fmt.Errorf("unsupported resource type %q", conn.ResourceType)
+	}
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ %s not found: %v", conn.ResourceType, err))
+		logger.Error("portforward", "Workload lookup failed: %s/%s/%s - %v", conn.Namespace, conn.ResourceType, conn.ResourceName, err)
+		return "", err
+	}
+
+	if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+		err := fmt.Errorf("%s %s has no pod selector", conn.ResourceType, conn.ResourceName)
+		conn.AddLog(fmt.Sprintf("✗ %v", err))
+		return "", err
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ Invalid selector: %v", err))
+		return "", err
+	}
+	selectorStr := sel.String()
+	conn.AddLog(fmt.Sprintf("%s: %s (selector: %s)", conn.ResourceType, conn.ResourceName, selectorStr))
+	logger.Debug("portforward", "Workload selector: %s", selectorStr)
+
+	return selectorStr, nil
+}
+
+// pickWorkloadPod returns a ready pod matching selector. Pods are sorted by
+// name so the choice is stable; unready pods are listed in the error.
+func (m *Manager) pickWorkloadPod(ctx context.Context, conn *Connection, selector string) (*corev1.Pod, error) {
+	pods, err := conn.cluster.clientset.CoreV1().Pods(conn.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		conn.AddLog(fmt.Sprintf("✗ Failed to list pods: %v", err))
+		return nil, err
+	}
+
+	items := pods.Items
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+
+	var notReady []string
+	for i := range items {
+		if isPodReady(&items[i]) {
+			return &items[i], nil
+		}
+		notReady = append(notReady, items[i].Name)
+	}
+
+	err = fmt.Errorf("no ready pods for %s %s", conn.ResourceType, conn.ResourceName)
+	if len(notReady) > 0 {
+		err = fmt.Errorf("%v: %d pod(s) not ready (%s)", err, len(notReady), strings.Join(notReady, ", "))
+	}
+	conn.AddLog(fmt.Sprintf("✗ %v", err))
+	logger.Error("portforward", "%v", err)
+	return nil, err
+}
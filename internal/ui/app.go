@@ -3,7 +3,6 @@ package ui
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
@@ -12,6 +11,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/pyqan/portFwd/internal/config"
+	"github.com/pyqan/portFwd/internal/daemon"
 	"github.com/pyqan/portFwd/internal/k8s"
 	"github.com/pyqan/portFwd/internal/logger"
 	"github.com/pyqan/portFwd/internal/portforward"
@@ -26,12 +26,16 @@ const (
 	ViewNamespaces
 	ViewPods
 	ViewServices
+	ViewWorkloads
 	ViewPortInput
 	ViewConnecting
 	ViewConfirm
 	ViewLogs
+	ViewDetails
 	ViewHelp
 	ViewDebug
+	ViewFaults
+	ViewSaveProfile
 )
 
 // ResourceType represents the type of resource to forward
@@ -40,8 +44,30 @@ type ResourceType int
 const (
 	ResourceTypePod ResourceType = iota
 	ResourceTypeService
+	ResourceTypeDeployment
+	ResourceTypeStatefulSet
+	ResourceTypeReplicaSet
+	ResourceTypeDaemonSet
+	ResourceTypeJob
 )
 
+// workloadType returns the port-forward resource type of a workload menu entry
+func (t ResourceType) workloadType() portforward.ResourceType {
+	switch t {
+	case ResourceTypeDeployment:
+		return portforward.ResourceDeployment
+	case ResourceTypeStatefulSet:
+		return portforward.ResourceStatefulSet
+	case ResourceTypeReplicaSet:
+		return portforward.ResourceReplicaSet
+	case ResourceTypeDaemonSet:
+		return portforward.ResourceDaemonSet
+	case ResourceTypeJob:
+		return portforward.ResourceJob
+	}
+	return ""
+}
+
 // Model is the main application model
 type Model struct {
 	// Kubernetes client
@@ -50,8 +76,9 @@ type Model struct {
 	// Port forward manager
 	pfManager *portforward.Manager
 
-	// Config
-	config *config.Config
+	// Config and where it's saved
+	config     *config.Config
+	configPath string
 
 	// Current view
 	view     View
@@ -61,9 +88,11 @@ type Model struct {
 	namespaces           []string
 	pods                 []k8s.PodInfo
 	services             []k8s.ServiceInfo
+	workloads            []k8s.WorkloadInfo
 	selectedNamespace    int
 	selectedPod          int
 	selectedService      int
+	selectedWorkload     int
 	selectedConn         int
 	selectedResourceType ResourceType
 
@@ -73,14 +102,29 @@ type Model struct {
 	// Port input
 	localPortInput  textinput.Model
 	remotePortInput textinput.Model
+	addressInput    textinput.Model // comma-separated bind addresses
 	focusedInput    int
+	balance         portforward.BalanceMode
+	lazy            bool // open the tunnel on the first connection
+
+	// Fault injection dialog, one input per entry of faultFields
+	faultInputs  []textinput.Model
+	focusedFault int
+	faultsConnID string
+
+	// Saving forwarded namespace services as a profile
+	profileInput   textinput.Model
+	pendingProfile *config.Profile
 
 	// Selected target for port forward
-	targetPod     string
-	targetService string
+	targetPod          string
+	targetService      string
+	targetWorkload     string
+	targetWorkloadType portforward.ResourceType
 	
-	// Current connecting connection (for log display)
-	connectingConnID string
+	// Forward being started (for log display) and how to cancel it
+	connectingOpts   portforward.ForwardOptions
+	connectingCancel context.CancelFunc
 
 	// Confirm dialog
 	confirmTitle   string
@@ -107,6 +151,9 @@ type Model struct {
 	
 	// Viewing logs for specific connection
 	viewingLogsConnID string
+
+	// Viewing details and traffic of a specific connection
+	viewingDetailsConnID string
 	
 	// Debug mode
 	debugMode       bool
@@ -124,9 +171,17 @@ type (
 	namespacesMsg      []string
 	podsMsg            []k8s.PodInfo
 	servicesMsg        []k8s.ServiceInfo
+	workloadsMsg       []k8s.WorkloadInfo
 	portForwardStarted struct{ id string }
 	portForwardStopped struct{ id string }
 	portForwardFailed  struct{ err error }
+	servicesForwarded  struct {
+		namespace      string
+		started, total int
+		skipped        int
+		err            error          // first start error, if any
+		profile        config.Profile // the started forwards, to save if wanted
+	}
 	connectionsUpdated struct{}
 	contextMsg         string
 	tickMsg            time.Time
@@ -145,30 +200,62 @@ func tickCmd() tea.Cmd {
 }
 
 // NewModel creates a new UI model
-func NewModel(k8sClient *k8s.Client, pfManager *portforward.Manager, cfg *config.Config) Model {
+func NewModel(k8sClient *k8s.Client, pfManager *portforward.Manager, cfg *config.Config, configPath string) Model {
 	localInput := textinput.New()
-	localInput.Placeholder = "8080"
-	localInput.CharLimit = 5
-	localInput.Width = 10
+	localInput.Placeholder = "8080 or auto"
+	localInput.CharLimit = 64
+	localInput.Width = 20
 	localInput.Cursor.Style = CursorStyle
 	localInput.TextStyle = InputStyle
 	localInput.PlaceholderStyle = PlaceholderStyle
 
 	remoteInput := textinput.New()
 	remoteInput.Placeholder = "80"
-	remoteInput.CharLimit = 5
-	remoteInput.Width = 10
+	remoteInput.CharLimit = 64
+	remoteInput.Width = 20
 	remoteInput.Cursor.Style = CursorStyle
 	remoteInput.TextStyle = InputStyle
 	remoteInput.PlaceholderStyle = PlaceholderStyle
 
+	addressInput := textinput.New()
+	addressInput.Placeholder = strings.Join(portforward.DefaultAddresses, ",")
+	addressInput.CharLimit = 128
+	addressInput.Width = 20
+	addressInput.Cursor.Style = CursorStyle
+	addressInput.TextStyle = InputStyle
+	addressInput.PlaceholderStyle = PlaceholderStyle
+
+	faultInputs := make([]textinput.Model, len(faultFields))
+	for i, field := range faultFields {
+		input := textinput.New()
+		input.Placeholder = field.placeholder
+		input.CharLimit = 32
+		input.Width = 12
+		input.Cursor.Style = CursorStyle
+		input.TextStyle = InputStyle
+		input.PlaceholderStyle = PlaceholderStyle
+		faultInputs[i] = input
+	}
+
+	profileInput := textinput.New()
+	profileInput.Placeholder = "profile name"
+	profileInput.CharLimit = 64
+	profileInput.Width = 30
+	profileInput.Cursor.Style = CursorStyle
+	profileInput.TextStyle = InputStyle
+	profileInput.PlaceholderStyle = PlaceholderStyle
+
 	return Model{
 		k8sClient:       k8sClient,
 		pfManager:       pfManager,
 		config:          cfg,
+		configPath:      configPath,
 		view:            ViewConnections,
 		localPortInput:  localInput,
 		remotePortInput: remoteInput,
+		addressInput:    addressInput,
+		faultInputs:     faultInputs,
+		profileInput:    profileInput,
 		width:           80,
 		height:          24,
 		globalLogs:      make([]string, 0),
@@ -197,6 +284,11 @@ func (m Model) Init() tea.Cmd {
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// Typing a profile name takes every key but ctrl+c
+		if m.view == ViewSaveProfile && msg.String() != "ctrl+c" {
+			return m.updateSaveProfile(msg)
+		}
+
 		// Allow quit even during restoration
 		switch msg.String() {
 		case "ctrl+c", "q":
@@ -246,6 +338,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updatePods(msg)
 		case ViewServices:
 			return m.updateServices(msg)
+		case ViewWorkloads:
+			return m.updateWorkloads(msg)
 		case ViewPortInput:
 			return m.updatePortInput(msg)
 		case ViewConnecting:
@@ -254,10 +348,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateConfirm(msg)
 		case ViewLogs:
 			return m.updateLogs(msg)
+		case ViewDetails:
+			return m.updateDetails(msg)
 		case ViewHelp:
 			return m.updateHelp(msg)
 		case ViewDebug:
 			return m.updateDebug(msg)
+		case ViewFaults:
+			return m.updateFaults(msg)
 		}
 
 	case tea.WindowSizeMsg:
@@ -283,10 +381,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.services = msg
 		m.loading = false
 
+	case workloadsMsg:
+		m.workloads = msg
+		m.loading = false
+
 	case portForwardStarted:
 		m.message = fmt.Sprintf("Port forward started: %s", msg.id)
 		m.view = ViewConnections
-		m.connectingConnID = ""
+		m.connectingCancel = nil
 
 	case portForwardStopped:
 		m.message = fmt.Sprintf("Port forward stopped: %s", msg.id)
@@ -294,14 +396,30 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case portForwardFailed:
 		m.err = msg.err
 		m.view = ViewConnections
-		m.connectingConnID = ""
+		m.connectingCancel = nil
+
+	case servicesForwarded:
+		m.message = fmt.Sprintf("Forwarded %d of %d services in %s", msg.started, msg.total, msg.namespace)
+		if msg.skipped > 0 {
+			m.message += fmt.Sprintf(" (%d skipped)", msg.skipped)
+		}
+		m.err = msg.err
+		m.view = ViewConnections
+		if len(msg.profile.Forwards) > 0 {
+			// Offer to keep the set as a profile
+			m.pendingProfile = &msg.profile
+			m.profileInput.SetValue(msg.profile.Name)
+			m.profileInput.CursorEnd()
+			m.profileInput.Focus()
+			m.view = ViewSaveProfile
+		}
 
 	case connectionsUpdated:
 		// Refresh view
 
 	case tickMsg:
-		// Continue ticking while connecting or restoring
-		if m.view == ViewConnecting || m.restoring {
+		// Continue ticking while connecting, restoring or showing live traffic
+		if m.view == ViewConnecting || m.view == ViewDetails || m.restoring {
 			return m, tickCmd()
 		}
 	
@@ -385,24 +503,28 @@ func (m Model) renderContent(height int) string {
 	case ViewServices:
 		return RenderServiceList(m.services, m.selectedService, m.width-4, height)
 
+	case ViewWorkloads:
+		return RenderWorkloadList(m.workloads, m.selectedResourceType.workloadType(), m.selectedWorkload, m.width-4, height)
+
 	case ViewPortInput:
 		return RenderPortInput(
 			m.localPortInput,
 			m.remotePortInput,
+			m.addressInput,
+			m.targetService != "",
+			m.balance,
+			m.lazy,
 			m.width-4,
 		)
 
 	case ViewConnecting:
 		var logs []string
 		title := "Connecting..."
-		if m.connectingConnID != "" {
-			if conn, ok := m.pfManager.GetConnection(m.connectingConnID); ok {
+		if m.connectingCancel != nil {
+			if conn, ok := m.connectingConnection(); ok {
 				logs = conn.GetLogs()
 				info := conn.GetConnectionInfo()
-				resType := "pod"
-				if info.ResourceType == portforward.ResourceService {
-					resType = "svc"
-				}
+				resType := info.ResourceType.ShortName()
 				title = fmt.Sprintf("Connecting to %s/%s/%s", info.Namespace, resType, info.ResourceName)
 			}
 		}
@@ -418,21 +540,31 @@ func (m Model) renderContent(height int) string {
 			if conn, ok := m.pfManager.GetConnection(m.viewingLogsConnID); ok {
 				logs = conn.GetLogs()
 				info := conn.GetConnectionInfo()
-				resType := "pod"
-				if info.ResourceType == portforward.ResourceService {
-					resType = "svc"
-				}
+				resType := info.ResourceType.ShortName()
 				title = fmt.Sprintf("Logs: %s/%s/%s", info.Namespace, resType, info.ResourceName)
 			}
 		}
 		return RenderLogWindow(logs, title, m.width-4, height-2)
 
+	case ViewDetails:
+		conn, ok := m.pfManager.GetConnection(m.viewingDetailsConnID)
+		if !ok {
+			return RenderError("Connection no longer exists", m.width-4)
+		}
+		return RenderConnectionDetails(conn.GetConnectionInfo(), m.width-4)
+
 	case ViewHelp:
 		return RenderHelpScreen(m.width-4, height, m.debugMode)
 
 	case ViewDebug:
 		return RenderDebugLogs(m.width-4, height, m.debugScrollOffset)
 
+	case ViewFaults:
+		return RenderFaultsDialog(m.faultsConnID, m.faultInputs, m.width-4)
+
+	case ViewSaveProfile:
+		return RenderSaveProfileDialog(m.pendingProfile.Description, len(m.pendingProfile.Forwards), m.profileInput, m.width-4)
+
 	default:
 		return ""
 	}
@@ -450,6 +582,8 @@ func (m Model) viewName() string {
 		return "pod"
 	case ViewServices:
 		return "service"
+	case ViewWorkloads:
+		return "workload"
 	case ViewPortInput:
 		return "port_input"
 	case ViewConnecting:
@@ -458,10 +592,16 @@ func (m Model) viewName() string {
 		return "confirm"
 	case ViewLogs:
 		return "logs"
+	case ViewDetails:
+		return "details"
 	case ViewHelp:
 		return "help"
 	case ViewDebug:
 		return "debug"
+	case ViewFaults:
+		return "faults"
+	case ViewSaveProfile:
+		return "save_profile"
 	default:
 		return ""
 	}
@@ -473,7 +613,7 @@ func (m Model) handleEsc() (tea.Model, tea.Cmd) {
 		m.view = ViewConnections
 	case ViewNamespaces:
 		m.view = ViewResourceType
-	case ViewPods, ViewServices:
+	case ViewPods, ViewServices, ViewWorkloads:
 		m.view = ViewNamespaces
 	case ViewPortInput:
 		m.view = m.prevView
@@ -482,10 +622,16 @@ func (m Model) handleEsc() (tea.Model, tea.Cmd) {
 	case ViewLogs:
 		m.viewingLogsConnID = ""
 		m.view = ViewConnections
+	case ViewDetails:
+		m.viewingDetailsConnID = ""
+		m.view = ViewConnections
 	case ViewHelp:
 		m.view = m.prevView
 	case ViewDebug:
 		m.view = m.prevView
+	case ViewFaults:
+		m.faultsConnID = ""
+		m.view = ViewConnections
 	}
 	m.err = nil
 	m.message = ""
@@ -512,24 +658,12 @@ func (m Model) updateConnections(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if len(connections) > 0 && m.selectedConn < len(connections) {
 			conn := connections[m.selectedConn]
 			info := conn.GetConnectionInfo()
-			if info.Status == portforward.StatusActive {
-				// Stop active connection
+			if info.Status == portforward.StatusActive || info.Status == portforward.StatusReconnecting || info.Status == portforward.StatusDegraded || info.Status == portforward.StatusListening {
+				// Stop active (or reconnecting) connection
 				return m, m.stopPortForward(info.ID)
 			} else if info.Status == portforward.StatusStopped || info.Status == portforward.StatusError {
 				// Reconnect stopped/error connection
-				m.view = ViewConnecting
-				if info.ResourceType == portforward.ResourceService {
-					m.connectingConnID = info.ID
-					return m, tea.Batch(
-						m.startPortForwardToServiceAsync(info.Namespace, info.ResourceName, info.LocalPort, info.RemotePort),
-						tickCmd(),
-					)
-				}
-				m.connectingConnID = info.ID
-				return m, tea.Batch(
-					m.startPortForwardToPodAsync(info.Namespace, info.ResourceName, info.LocalPort, info.RemotePort),
-					tickCmd(),
-				)
+				return m, m.startConnecting(conn.Options())
 			}
 		}
 		return m, nil
@@ -563,19 +697,7 @@ func (m Model) updateConnections(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			conn := connections[m.selectedConn]
 			info := conn.GetConnectionInfo()
 			if info.Status == portforward.StatusStopped || info.Status == portforward.StatusError {
-				m.view = ViewConnecting
-				if info.ResourceType == portforward.ResourceService {
-					m.connectingConnID = info.ID
-					return m, tea.Batch(
-						m.startPortForwardToServiceAsync(info.Namespace, info.ResourceName, info.LocalPort, info.RemotePort),
-						tickCmd(),
-					)
-				}
-				m.connectingConnID = info.ID
-				return m, tea.Batch(
-					m.startPortForwardToPodAsync(info.Namespace, info.ResourceName, info.LocalPort, info.RemotePort),
-					tickCmd(),
-				)
+				return m, m.startConnecting(conn.Options())
 			}
 		}
 	case "x", "delete", "backspace":
@@ -597,6 +719,152 @@ func (m Model) updateConnections(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.viewingLogsConnID = conn.GetConnectionInfo().ID
 			m.view = ViewLogs
 		}
+	case "i":
+		// View details and traffic of selected connection
+		if len(connections) > 0 && m.selectedConn < len(connections) {
+			conn := connections[m.selectedConn]
+			m.viewingDetailsConnID = conn.GetConnectionInfo().ID
+			m.view = ViewDetails
+			return m, tickCmd()
+		}
+	case "R":
+		// Toggle traffic recording of selected connection
+		if len(connections) > 0 && m.selectedConn < len(connections) {
+			info := connections[m.selectedConn].GetConnectionInfo()
+			if info.Recording != nil {
+				if err := m.pfManager.StopRecording(info.ID); err != nil {
+					m.err = err
+				} else {
+					m.message = fmt.Sprintf("Recording stopped: %s", info.ID)
+				}
+			} else if dir, err := m.pfManager.StartRecording(info.ID, portforward.RecordOptions{}); err != nil {
+				m.err = err
+			} else {
+				m.message = fmt.Sprintf("Recording to %s", dir)
+			}
+		}
+	case "F":
+		// Edit the fault profile of selected connection
+		if len(connections) > 0 && m.selectedConn < len(connections) {
+			info := connections[m.selectedConn].GetConnectionInfo()
+			values := map[string]string{}
+			if info.Faults != nil {
+				for _, item := range strings.Split(info.Faults.String(), ",") {
+					key, value, _ := strings.Cut(item, "=")
+					values[key] = value
+				}
+			}
+			for i, field := range faultFields {
+				m.faultInputs[i].SetValue(values[field.name])
+			}
+			m.faultsConnID = info.ID
+			m.focusFaultInput(0)
+			m.view = ViewFaults
+		}
+	}
+	return m, nil
+}
+
+// faultFields are the inputs of the fault injection dialog, named like the
+// keys of portforward.ParseFaults
+var faultFields = []struct {
+	name, placeholder string
+}{
+	{"latency", "200ms"},
+	{"jitter", "50ms"},
+	{"bandwidth", "64KB"},
+	{"reset", "1%"},
+	{"drop", "5%"},
+	{"stall", "2%"},
+}
+
+// Fault injection dialog handlers
+func (m Model) updateFaults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "tab", "down":
+		m.focusFaultInput((m.focusedFault + 1) % len(m.faultInputs))
+	case "shift+tab", "up":
+		m.focusFaultInput((m.focusedFault + len(m.faultInputs) - 1) % len(m.faultInputs))
+	case "ctrl+x":
+		// Clear all fields, which turns fault injection off
+		for i := range m.faultInputs {
+			m.faultInputs[i].SetValue("")
+		}
+	case "enter":
+		var spec []string
+		for i, field := range faultFields {
+			if value := strings.TrimSpace(m.faultInputs[i].Value()); value != "" {
+				spec = append(spec, field.name+"="+value)
+			}
+		}
+		faults, err := portforward.ParseFaults(strings.Join(spec, ","))
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if err := m.pfManager.SetFaults(m.faultsConnID, faults); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.err = nil
+		if faults.IsZero() {
+			m.message = fmt.Sprintf("Fault injection off: %s", m.faultsConnID)
+		} else {
+			m.message = fmt.Sprintf("Injecting faults: %s", faults)
+		}
+		m.faultsConnID = ""
+		m.view = ViewConnections
+	default:
+		var cmd tea.Cmd
+		m.faultInputs[m.focusedFault], cmd = m.faultInputs[m.focusedFault].Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// focusFaultInput focuses input i of the fault injection dialog
+func (m *Model) focusFaultInput(i int) {
+	m.focusedFault = i
+	for j := range m.faultInputs {
+		if j == i {
+			m.faultInputs[j].Focus()
+		} else {
+			m.faultInputs[j].Blur()
+		}
+	}
+}
+
+// updateSaveProfile handles the dialog that saves forwarded namespace
+// services as a profile
+func (m Model) updateSaveProfile(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.pendingProfile = nil
+		m.profileInput.Blur()
+		m.view = ViewConnections
+	case "enter":
+		name := strings.TrimSpace(m.profileInput.Value())
+		if name == "" {
+			m.err = fmt.Errorf("profile name is required")
+			return m, nil
+		}
+		profile := *m.pendingProfile
+		profile.Name = name
+		m.config.AddProfile(profile)
+		if err := m.config.Save(m.configPath); err != nil {
+			m.err = fmt.Errorf("failed to save profile: %w", err)
+			return m, nil
+		}
+		m.err = nil
+		m.message = fmt.Sprintf("Saved %d forwards as profile '%s'", len(profile.Forwards), name)
+		m.addLog(m.message)
+		m.pendingProfile = nil
+		m.profileInput.Blur()
+		m.view = ViewConnections
+	default:
+		var cmd tea.Cmd
+		m.profileInput, cmd = m.profileInput.Update(msg)
+		return m, cmd
 	}
 	return m, nil
 }
@@ -609,7 +877,7 @@ func (m Model) updateResourceType(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.selectedResourceType--
 		}
 	case "down", "j":
-		if m.selectedResourceType < ResourceTypeService {
+		if m.selectedResourceType < ResourceTypeJob {
 			m.selectedResourceType++
 		}
 	case "enter":
@@ -628,6 +896,12 @@ func (m Model) updateResourceType(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.view = ViewNamespaces
 		m.selectedNamespace = 0
 		return m, m.loadNamespaces()
+	case "d":
+		// Quick select Deployment
+		m.selectedResourceType = ResourceTypeDeployment
+		m.view = ViewNamespaces
+		m.selectedNamespace = 0
+		return m, m.loadNamespaces()
 	}
 	return m, nil
 }
@@ -647,14 +921,20 @@ func (m Model) updateNamespaces(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if len(m.namespaces) > 0 {
 			m.currentNamespace = m.namespaces[m.selectedNamespace]
 			// Go to selected resource type
-			if m.selectedResourceType == ResourceTypePod {
+			switch m.selectedResourceType {
+			case ResourceTypePod:
 				m.view = ViewPods
 				m.selectedPod = 0
 				return m, m.loadPods()
-			} else {
+			case ResourceTypeService:
 				m.view = ViewServices
 				m.selectedService = 0
 				return m, m.loadServices()
+			default:
+				m.view = ViewWorkloads
+				m.selectedWorkload = 0
+				m.workloads = nil
+				return m, m.loadWorkloads(m.selectedResourceType.workloadType())
 			}
 		}
 	}
@@ -677,6 +957,7 @@ func (m Model) updatePods(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			pod := m.pods[m.selectedPod]
 			m.targetPod = pod.Name
 			m.targetService = ""
+			m.targetWorkload = ""
 
 			// Pre-fill remote port if pod has ports
 			if len(pod.Ports) > 0 {
@@ -687,8 +968,8 @@ func (m Model) updatePods(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.localPortInput.SetValue("")
 			}
 
-			m.focusedInput = 0
-			m.localPortInput.Focus()
+			m.lazy = false
+			m.focusPortInput(0)
 			m.prevView = m.view
 			m.view = ViewPortInput
 		}
@@ -712,6 +993,8 @@ func (m Model) updateServices(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			svc := m.services[m.selectedService]
 			m.targetService = svc.Name
 			m.targetPod = ""
+			m.targetWorkload = ""
+			m.balance = portforward.BalanceNone
 
 			// Pre-fill remote port if service has ports
 			if len(svc.Ports) > 0 {
@@ -722,8 +1005,57 @@ func (m Model) updateServices(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.localPortInput.SetValue("")
 			}
 
-			m.focusedInput = 0
-			m.localPortInput.Focus()
+			m.lazy = false
+			m.focusPortInput(0)
+			m.prevView = m.view
+			m.view = ViewPortInput
+		}
+	case "A":
+		// Forward all services - show confirm
+		if len(m.services) > 0 {
+			namespace := m.currentNamespace
+			m.confirmTitle = "Forward All Services"
+			m.confirmMessage = fmt.Sprintf("Forward all %d services in %s?", len(m.services), namespace)
+			m.confirmAction = func() tea.Cmd {
+				return m.forwardAllServicesAsync(namespace)
+			}
+			m.prevView = m.view
+			m.view = ViewConfirm
+		}
+	}
+	return m, nil
+}
+
+// Workload view handlers
+func (m Model) updateWorkloads(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedWorkload > 0 {
+			m.selectedWorkload--
+		}
+	case "down", "j":
+		if m.selectedWorkload < len(m.workloads)-1 {
+			m.selectedWorkload++
+		}
+	case "enter":
+		if len(m.workloads) > 0 && m.selectedWorkload < len(m.workloads) {
+			w := m.workloads[m.selectedWorkload]
+			m.targetWorkload = w.Name
+			m.targetWorkloadType = m.selectedResourceType.workloadType()
+			m.targetPod = ""
+			m.targetService = ""
+
+			// Pre-fill remote port from the pod template
+			if len(w.Ports) > 0 {
+				m.remotePortInput.SetValue(fmt.Sprintf("%d", w.Ports[0].ContainerPort))
+				m.localPortInput.SetValue(fmt.Sprintf("%d", w.Ports[0].ContainerPort))
+			} else {
+				m.remotePortInput.SetValue("")
+				m.localPortInput.SetValue("")
+			}
+
+			m.lazy = false
+			m.focusPortInput(0)
 			m.prevView = m.view
 			m.view = ViewPortInput
 		}
@@ -735,52 +1067,72 @@ func (m Model) updateServices(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m Model) updatePortInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "tab", "down":
-		m.focusedInput = (m.focusedInput + 1) % 2
-		if m.focusedInput == 0 {
-			m.localPortInput.Focus()
-			m.remotePortInput.Blur()
-		} else {
-			m.remotePortInput.Focus()
-			m.localPortInput.Blur()
-		}
+		m.focusPortInput((m.focusedInput + 1) % 3)
 	case "shift+tab", "up":
-		m.focusedInput = (m.focusedInput + 1) % 2
-		if m.focusedInput == 0 {
-			m.localPortInput.Focus()
-			m.remotePortInput.Blur()
-		} else {
-			m.remotePortInput.Focus()
-			m.localPortInput.Blur()
+		m.focusPortInput((m.focusedInput + 2) % 3)
+	case "ctrl+b":
+		// Cycle load balancing mode (services only)
+		if m.targetService != "" {
+			switch m.balance {
+			case portforward.BalanceNone:
+				m.balance = portforward.BalanceRoundRobin
+			case portforward.BalanceRoundRobin:
+				m.balance = portforward.BalanceLeastConn
+			default:
+				m.balance = portforward.BalanceNone
+			}
+			if m.balance != portforward.BalanceNone {
+				m.lazy = false
+			}
+		}
+	case "ctrl+o":
+		// Toggle on-demand tunnel; it can't be combined with balancing
+		m.lazy = !m.lazy
+		if m.lazy {
+			m.balance = portforward.BalanceNone
 		}
 	case "enter":
-		localPort, err := strconv.Atoi(m.localPortInput.Value())
-		if err != nil || localPort <= 0 || localPort > 65535 {
-			m.err = fmt.Errorf("invalid local port")
+		ports, err := parsePortInputs(m.localPortInput.Value(), m.remotePortInput.Value())
+		if err != nil {
+			m.err = err
 			return m, nil
 		}
-		remotePort, err := strconv.Atoi(m.remotePortInput.Value())
-		if err != nil || remotePort <= 0 || remotePort > 65535 {
-			m.err = fmt.Errorf("invalid remote port")
+
+		var addresses []string
+		if value := strings.TrimSpace(m.addressInput.Value()); value != "" {
+			addresses = strings.Split(value, ",")
+		}
+		if addresses, err = portforward.ParseAddresses(addresses); err != nil {
+			m.err = err
 			return m, nil
 		}
 
 		m.err = nil
 		m.view = ViewConnecting
 		
+		opts := portforward.ForwardOptions{
+			Namespace: m.currentNamespace,
+			Ports:     ports,
+			Addresses: addresses,
+			Lazy:      m.lazy,
+		}
 		if m.targetService != "" {
 			// Port-forward to Service (like kubectl port-forward svc/...)
-			m.connectingConnID = fmt.Sprintf("%s/svc/%s:%d->%d", m.currentNamespace, m.targetService, localPort, remotePort)
-			return m, tea.Batch(
-				m.startPortForwardToServiceAsync(m.currentNamespace, m.targetService, localPort, remotePort),
-				tickCmd(),
-			)
+			opts.ResourceType = portforward.ResourceService
+			opts.ResourceName = m.targetService
+			opts.Balance = m.balance
+		} else if m.targetWorkload != "" {
+			// Port-forward to a pod of the workload (like kubectl port-forward deploy/...)
+			opts.ResourceType = m.targetWorkloadType
+			opts.ResourceName = m.targetWorkload
 		} else if m.targetPod != "" {
 			// Port-forward to Pod
-			m.connectingConnID = fmt.Sprintf("%s/pod/%s:%d->%d", m.currentNamespace, m.targetPod, localPort, remotePort)
-			return m, tea.Batch(
-				m.startPortForwardToPodAsync(m.currentNamespace, m.targetPod, localPort, remotePort),
-				tickCmd(),
-			)
+			opts.ResourceType = portforward.ResourcePod
+			opts.ResourceName = m.targetPod
+		}
+
+		if opts.ResourceName != "" {
+			return m, m.startConnecting(opts)
 		} else {
 			m.err = fmt.Errorf("no target specified")
 			m.view = ViewPortInput
@@ -790,25 +1142,44 @@ func (m Model) updatePortInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	default:
 		// Handle text input
 		var cmd tea.Cmd
-		if m.focusedInput == 0 {
+		switch m.focusedInput {
+		case 0:
 			m.localPortInput, cmd = m.localPortInput.Update(msg)
-		} else {
+		case 1:
 			m.remotePortInput, cmd = m.remotePortInput.Update(msg)
+		default:
+			m.addressInput, cmd = m.addressInput.Update(msg)
 		}
 		return m, cmd
 	}
 	return m, nil
 }
 
+// focusPortInput focuses the local port (0), remote port (1) or address (2) input
+func (m *Model) focusPortInput(i int) {
+	m.focusedInput = i
+	inputs := []*textinput.Model{&m.localPortInput, &m.remotePortInput, &m.addressInput}
+	for j, input := range inputs {
+		if j == i {
+			input.Focus()
+		} else {
+			input.Blur()
+		}
+	}
+}
+
 // Connecting view handlers
 func (m Model) updateConnecting(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "esc":
 		// Cancel connection attempt
-		if m.connectingConnID != "" {
-			m.pfManager.StopPortForward(m.connectingConnID)
+		if m.connectingCancel != nil {
+			if conn, ok := m.connectingConnection(); ok {
+				m.pfManager.StopPortForward(conn.ID)
+			}
+			m.connectingCancel()
 		}
-		m.connectingConnID = ""
+		m.connectingCancel = nil
 		m.view = ViewConnections
 	}
 	return m, nil
@@ -841,6 +1212,15 @@ func (m Model) updateLogs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m Model) updateDetails(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "i":
+		m.viewingDetailsConnID = ""
+		m.view = ViewConnections
+	}
+	return m, nil
+}
+
 // Help view handlers
 func (m Model) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
@@ -931,23 +1311,129 @@ func (m Model) loadServices() tea.Cmd {
 	}
 }
 
-func (m Model) startPortForwardToPodAsync(namespace, pod string, localPort, remotePort int) tea.Cmd {
+func (m Model) loadWorkloads(kind portforward.ResourceType) tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.pfManager.StartPortForwardToPod(context.Background(), namespace, pod, localPort, remotePort)
+		workloads, err := m.k8sClient.GetWorkloads(context.Background(), m.currentNamespace, string(kind))
+		if err != nil {
+			return errMsg{err}
+		}
+		return workloadsMsg(workloads)
+	}
+}
+
+// parsePortInputs pairs the comma-separated local and remote port inputs by
+// position, so "8080,9090" and "http,metrics" give two mappings. A missing
+// remote port defaults to the local one.
+func parsePortInputs(localInput, remoteInput string) ([]portforward.PortMapping, error) {
+	locals := strings.Split(localInput, ",")
+	var remotes []string
+	if strings.TrimSpace(remoteInput) != "" {
+		remotes = strings.Split(remoteInput, ",")
+	}
+	if len(remotes) > len(locals) {
+		return nil, fmt.Errorf("more remote ports than local ports")
+	}
+
+	ports := make([]portforward.PortMapping, 0, len(locals))
+	for i, local := range locals {
+		spec := strings.TrimSpace(local)
+		if i < len(remotes) && strings.TrimSpace(remotes[i]) != "" {
+			spec += ":" + strings.TrimSpace(remotes[i])
+		}
+		p, err := portforward.ParsePortMapping(spec)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// startConnecting shows the connecting view and starts opts
+func (m *Model) startConnecting(opts portforward.ForwardOptions) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.view = ViewConnecting
+	m.connectingOpts = opts
+	m.connectingCancel = cancel
+	return tea.Batch(
+		m.startPortForwardAsync(ctx, cancel, opts),
+		tickCmd(),
+	)
+}
+
+// connectingConnection returns the connection being started. Automatic
+// local ports are only picked while it starts, so its ID isn't known up
+// front then and it's found by its target and ports instead.
+func (m Model) connectingConnection() (*portforward.Connection, bool) {
+	opts := m.connectingOpts
+	requested := opts.PortMappings()
+	auto := false
+	for _, p := range requested {
+		auto = auto || (p.Local == 0 && opts.SocketPath == "")
+	}
+	if !auto {
+		return m.pfManager.GetConnection(portforward.ConnectionID(opts))
+	}
+	for _, conn := range m.pfManager.GetConnections() {
+		info := conn.GetConnectionInfo()
+		if info.Status == portforward.StatusStarting && info.Context == opts.Context &&
+			info.Namespace == opts.Namespace && info.ResourceType == opts.ResourceType &&
+			info.ResourceName == opts.ResourceName && samePorts(info.Ports, requested) {
+			return conn, true
+		}
+	}
+	return nil, false
+}
+
+// samePorts reports whether the port mappings of a connection are the
+// requested ones, automatic local ports matching any port
+func samePorts(ports, requested []portforward.PortMapping) bool {
+	if len(ports) != len(requested) {
+		return false
+	}
+	for i, p := range requested {
+		if p.RemoteString() != ports[i].RemoteString() || (p.Local != 0 && p.Local != ports[i].Local) {
+			return false
+		}
+	}
+	return true
+}
+
+// startPortForwardAsync starts opts, bounding the start by ctx. cancel is
+// called once the start is over.
+func (m Model) startPortForwardAsync(ctx context.Context, cancel context.CancelFunc, opts portforward.ForwardOptions) tea.Cmd {
+	return func() tea.Msg {
+		defer cancel()
+		conn, err := m.pfManager.StartWithOptions(ctx, opts)
 		if err != nil {
 			return portForwardFailed{err: err}
 		}
-		return portForwardStarted{id: fmt.Sprintf("%s/pod/%s:%d->%d", namespace, pod, localPort, remotePort)}
+		return portForwardStarted{id: conn.ID}
 	}
 }
 
-func (m Model) startPortForwardToServiceAsync(namespace, svc string, localPort, remotePort int) tea.Cmd {
+// forwardAllServicesAsync forwards every service port of a namespace,
+// moving taken local ports by the default conflict offset
+func (m Model) forwardAllServicesAsync(namespace string) tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.pfManager.StartPortForwardToService(context.Background(), namespace, svc, localPort, remotePort)
+		ctx := context.Background()
+		plan, err := m.pfManager.PlanNamespace(ctx, portforward.NamespaceOptions{Namespace: namespace})
 		if err != nil {
 			return portForwardFailed{err: err}
 		}
-		return portForwardStarted{id: fmt.Sprintf("%s/svc/%s:%d->%d", namespace, svc, localPort, remotePort)}
+		msg := servicesForwarded{namespace: namespace, total: len(plan.Services), skipped: len(plan.Skipped)}
+		errs := m.pfManager.StartPlan(ctx, plan)
+		for i, err := range errs {
+			if err == nil {
+				msg.started++
+			} else if msg.err == nil {
+				msg.err = fmt.Errorf("%s: %w", plan.Services[i].Service, err)
+			}
+		}
+		// Profiles remember the context, so they don't follow a later switch
+		kubeContext, _ := m.k8sClient.GetCurrentContext()
+		msg.profile = daemon.NamespaceProfile(namespace, plan, errs, "", kubeContext, config.ForwardSpec{})
+		return msg
 	}
 }
 
@@ -1017,15 +1503,23 @@ func DefaultKeyMap() KeyMap {
 }
 
 // Run starts the TUI application
-func Run(k8sClient *k8s.Client, pfManager *portforward.Manager, cfg *config.Config, debugMode bool) error {
-	model := NewModel(k8sClient, pfManager, cfg)
+func Run(k8sClient *k8s.Client, pfManager *portforward.Manager, cfg *config.Config, configPath string, debugMode bool) error {
+	model := NewModel(k8sClient, pfManager, cfg, configPath)
 	model.debugMode = debugMode
 	p := tea.NewProgram(model, tea.WithAltScreen())
 
-	// Set up onChange callback to refresh UI
-	pfManager.SetOnChange(func() {
-		p.Send(connectionsUpdated{})
-	})
+	// Refresh the UI whenever a connection changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ev := range pfManager.Subscribe(ctx) {
+			// Open views refresh their metrics on their own tick
+			if ev.Type == portforward.EventMetricsTick {
+				continue
+			}
+			p.Send(connectionsUpdated{})
+		}
+	}()
 
 	// Load and restore previous session
 	go restorePreviousSession(k8sClient, pfManager, p)
@@ -1047,49 +1541,52 @@ func restorePreviousSession(k8sClient *k8s.Client, pfManager *portforward.Manage
 	p.Send(restorationStarted{total: total})
 	
 	ctx := context.Background()
+	currentContext, _ := k8sClient.GetCurrentContext()
 	
 	for i, saved := range state.Connections {
 		// Update progress
 		p.Send(restorationProgress{current: i + 1, total: total})
 		
-		resourceType := portforward.ResourcePod
-		if saved.ResourceType == "service" {
-			resourceType = portforward.ResourceService
+		opts, err := daemon.SavedOptions(saved)
+		if err != nil {
+			continue
 		}
 		
 		if !saved.WasActive {
 			// Restore as stopped - don't try to connect
-			pfManager.AddStoppedConnection(saved.Namespace, resourceType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+			pfManager.AddStoppedConnection(opts)
 			continue
 		}
 		
 		// Was active - check availability and try to connect
 		available := false
-		if saved.ResourceType == "service" {
+		switch {
+		case saved.Context != "" && saved.Context != currentContext:
+			// Only the current context is browsed; others are checked on start
+			available = true
+		case opts.ResourceType == portforward.ResourceService:
 			_, err := k8sClient.GetService(ctx, saved.Namespace, saved.ResourceName)
 			available = err == nil
-		} else {
+		case opts.ResourceType == portforward.ResourcePod:
 			pod, err := k8sClient.GetPod(ctx, saved.Namespace, saved.ResourceName)
 			available = err == nil && pod.Status == "Running"
+		default:
+			// Workloads are resolved to a pod when the forward starts
+			available = true
 		}
 		
 		if !available {
 			// Resource not available - add as stopped
-			pfManager.AddStoppedConnection(saved.Namespace, resourceType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+			pfManager.AddStoppedConnection(opts)
 			continue
 		}
 		
 		// Try to restore active connection
-		var restoreErr error
-		if saved.ResourceType == "service" {
-			_, restoreErr = pfManager.StartPortForwardToService(ctx, saved.Namespace, saved.ResourceName, saved.LocalPort, saved.RemotePort)
-		} else {
-			_, restoreErr = pfManager.StartPortForwardToPod(ctx, saved.Namespace, saved.ResourceName, saved.LocalPort, saved.RemotePort)
-		}
+		_, restoreErr := pfManager.StartWithOptions(ctx, opts)
 		
 		if restoreErr != nil {
 			// Failed - add as stopped
-			pfManager.AddStoppedConnection(saved.Namespace, resourceType, saved.ResourceName, saved.LocalPort, saved.RemotePort)
+			pfManager.AddStoppedConnection(opts)
 		}
 	}
 	
@@ -1107,14 +1604,7 @@ func saveSessionState(pfManager *portforward.Manager) {
 	}
 	
 	for i, conn := range all {
-		state.Connections[i] = config.SavedConnection{
-			Namespace:    conn.Namespace,
-			ResourceType: conn.ResourceType,
-			ResourceName: conn.ResourceName,
-			LocalPort:    conn.LocalPort,
-			RemotePort:   conn.RemotePort,
-			WasActive:    conn.WasActive,
-		}
+		state.Connections[i] = daemon.SavedConnection(conn)
 	}
 	
 	state.Save()
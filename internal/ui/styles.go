@@ -218,12 +218,16 @@ func StatusIcon(status string) string {
 		return StatusStartingStyle.Render("◐")
 	case "reconnecting":
 		return StatusWarningStyle.Render("⟳")
+	case "degraded":
+		return StatusWarningStyle.Render("◑")
+	case "listening":
+		return StatusStartingStyle.Render("◌")
 	default:
 		return StatusStoppedStyle.Render("?")
 	}
 }
 
-// StatusWarningStyle for reconnecting status
+// StatusWarningStyle for reconnecting and degraded status
 var StatusWarningStyle = lipgloss.NewStyle().
 	Foreground(ColorWarning).
 	Bold(true)
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -28,6 +29,11 @@ func RenderResourceTypeMenu(selected int, width int) string {
 	}{
 		{"🚀", "Pods", "Forward to a specific pod"},
 		{"🌐", "Services", "Forward to a service"},
+		{"📦", "Deployments", "Forward to a ready pod of a deployment"},
+		{"🗄", "StatefulSets", "Forward to a ready pod of a statefulset"},
+		{"🧬", "ReplicaSets", "Forward to a ready pod of a replicaset"},
+		{"🛰", "DaemonSets", "Forward to a ready pod of a daemonset"},
+		{"⚙", "Jobs", "Forward to a running pod of a job"},
 	}
 
 	for i, t := range types {
@@ -43,7 +49,7 @@ func RenderResourceTypeMenu(selected int, width int) string {
 	}
 
 	// Quick keys hint
-	b.WriteString("\n" + HelpDescStyle.Render("   Quick: ") + HelpKeyStyle.Render("p") + HelpDescStyle.Render(" pods  ") + HelpKeyStyle.Render("s") + HelpDescStyle.Render(" services"))
+	b.WriteString("\n" + HelpDescStyle.Render("   Quick: ") + HelpKeyStyle.Render("p") + HelpDescStyle.Render(" pods  ") + HelpKeyStyle.Render("s") + HelpDescStyle.Render(" services  ") + HelpKeyStyle.Render("d") + HelpDescStyle.Render(" deployments"))
 
 	return BoxStyle.Width(width).Render(b.String())
 }
@@ -213,6 +219,62 @@ func RenderServiceList(services []k8s.ServiceInfo, selected int, width int, maxH
 	return BoxStyle.Width(width).Render(b.String())
 }
 
+// RenderWorkloadList renders a list of deployments, statefulsets, ... with scrolling
+func RenderWorkloadList(workloads []k8s.WorkloadInfo, kind portforward.ResourceType, selected int, width int, maxHeight int) string {
+	var b strings.Builder
+
+	title := SubtitleStyle.Render(fmt.Sprintf("📦 Select %s", kind))
+	b.WriteString(title + "\n\n")
+
+	total := len(workloads)
+	if total == 0 {
+		b.WriteString(ListItemStyle.Foreground(ColorMuted).Render(fmt.Sprintf("   No %ss found", kind)))
+		return BoxStyle.Width(width).Render(b.String())
+	}
+
+	// Each workload takes 2 lines, reserve 4 for title + padding + indicators
+	visibleItems := (maxHeight - 4) / 2
+	if visibleItems < 2 {
+		visibleItems = 2
+	}
+
+	offset := calculateOffset(selected, total, visibleItems)
+
+	// Show "more above" indicator
+	if offset > 0 {
+		b.WriteString(ScrollIndicatorStyle.Render(fmt.Sprintf("   ↑ %d more above\n", offset)))
+	}
+
+	endIdx := offset + visibleItems
+	if endIdx > total {
+		endIdx = total
+	}
+
+	for i := offset; i < endIdx; i++ {
+		w := workloads[i]
+		ports := formatPorts(w.Ports)
+		ready := lipgloss.NewStyle().Foreground(ColorMuted).Render(fmt.Sprintf("[%s ready]", w.Ready))
+
+		var item string
+		if i == selected {
+			item = SelectedItemStyle.Render(fmt.Sprintf(" ▶ %s ", w.Name))
+			item += "\n" + ListItemStyle.Render(fmt.Sprintf("     %s %s", ready, ports))
+		} else {
+			item = ListItemStyle.Render(fmt.Sprintf("   %s", w.Name))
+			item += "\n" + ListItemStyle.Foreground(ColorTextDim).Render(fmt.Sprintf("     %s %s", ready, ports))
+		}
+		b.WriteString(item + "\n")
+	}
+
+	// Show "more below" indicator
+	remaining := total - endIdx
+	if remaining > 0 {
+		b.WriteString(ScrollIndicatorStyle.Render(fmt.Sprintf("   ↓ %d more below", remaining)))
+	}
+
+	return BoxStyle.Width(width).Render(b.String())
+}
+
 // RenderConnectionList renders active port-forward connections with scrolling
 func RenderConnectionList(connections []*portforward.Connection, selected int, width int, maxHeight int) string {
 	var b strings.Builder
@@ -221,7 +283,7 @@ func RenderConnectionList(connections []*portforward.Connection, selected int, w
 	activeCount := 0
 	for _, c := range connections {
 		info := c.GetConnectionInfo()
-		if info.Status == portforward.StatusActive {
+		if info.Status == portforward.StatusActive || info.Status == portforward.StatusDegraded || info.Status == portforward.StatusListening {
 			activeCount++
 		}
 	}
@@ -260,12 +322,32 @@ func RenderConnectionList(connections []*portforward.Connection, selected int, w
 		statusIcon := StatusIcon(string(info.Status))
 		duration := formatDuration(info.Duration)
 
-		portMapping := PortStyle.Render(fmt.Sprintf("localhost:%d → %d", info.LocalPort, info.RemotePort))
-		resourcePrefix := "pod"
-		if info.ResourceType == portforward.ResourceService {
-			resourcePrefix = "svc"
+		portMapping := PortStyle.Render(formatPortMappings(info.Ports, info.Addresses))
+		if info.SocketPath != "" {
+			portMapping = PortStyle.Render(fmt.Sprintf("unix:%s → %s", info.SocketPath, info.Ports[0].RemoteString()))
+		}
+		if exposed := portforward.ExposedAddresses(info.Addresses); len(exposed) > 0 {
+			portMapping += lipgloss.NewStyle().Foreground(ColorWarning).Render(" ⚠ " + strings.Join(exposed, ","))
 		}
+		resourcePrefix := info.ResourceType.ShortName()
 		target := NamespaceStyle.Render(info.Namespace) + "/" + resourcePrefix + "/" + PodStyle.Render(info.ResourceName)
+		if info.Context != "" {
+			target += DimStyle.Render(" @" + info.Context)
+		}
+		if info.Balance != portforward.BalanceNone {
+			portMapping += DimStyle.Render(fmt.Sprintf(" ⚖ %s · %d pods", info.Balance, len(info.Backends)))
+		} else if info.ResourceType != portforward.ResourcePod && info.PodName != "" {
+			portMapping += DimStyle.Render(" via " + info.PodName)
+		}
+		if info.Lazy {
+			portMapping += DimStyle.Render(" ⚡ on demand")
+		}
+		if info.Recording != nil {
+			portMapping += lipgloss.NewStyle().Foreground(ColorError).Render(" ⏺ rec")
+		}
+		if info.Faults != nil {
+			portMapping += lipgloss.NewStyle().Foreground(ColorWarning).Render(" ↯ " + info.Faults.String())
+		}
 
 		var item string
 		if i == selected {
@@ -278,6 +360,8 @@ func RenderConnectionList(connections []*portforward.Connection, selected int, w
 
 		if info.Error != "" {
 			item += "\n" + StatusErrorStyle.Render(fmt.Sprintf("     ⚠ %s", info.Error))
+		} else if info.Status == portforward.StatusDegraded {
+			item += "\n" + StatusWarningStyle.Render(fmt.Sprintf("     ◑ probe failing: %s", info.ProbeError))
 		}
 
 		b.WriteString(item + "\n")
@@ -293,7 +377,7 @@ func RenderConnectionList(connections []*portforward.Connection, selected int, w
 }
 
 // RenderPortInput renders port input form
-func RenderPortInput(localInput, remoteInput textinput.Model, width int) string {
+func RenderPortInput(localInput, remoteInput, addressInput textinput.Model, isService bool, balance portforward.BalanceMode, lazy bool, width int) string {
 	var b strings.Builder
 
 	title := SubtitleStyle.Render("🔌 Configure Port Forward")
@@ -304,33 +388,115 @@ func RenderPortInput(localInput, remoteInput textinput.Model, width int) string
 
 	// Local port (on your machine)
 	localLabel := LabelStyle.Render("Local Port:  ")
-	localHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (localhost)")
+	localHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (auto = free port)")
 	b.WriteString(localLabel + localInput.View() + localHint + "\n")
 	
 	// Warning for privileged ports
-	localPort := localInput.Value()
-	if localPort != "" {
-		if port, err := strconv.Atoi(localPort); err == nil && port > 0 && port < 1024 {
-			b.WriteString(warningStyle.Render("   ⚠ Port < 1024 requires sudo") + "\n")
-		} else {
-			b.WriteString("\n")
+	privileged := false
+	for _, localPort := range strings.Split(localInput.Value(), ",") {
+		if port, err := strconv.Atoi(strings.TrimSpace(localPort)); err == nil && port > 0 && port < 1024 {
+			privileged = true
 		}
+	}
+	if privileged {
+		b.WriteString(warningStyle.Render("   ⚠ Port < 1024 requires sudo") + "\n")
 	} else {
 		b.WriteString("\n")
 	}
 
 	// Remote port (in pod/container)
 	remoteLabel := LabelStyle.Render("Remote Port: ")
-	remoteHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (pod/container)")
+	remoteHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (pod/container, number or name)")
 	b.WriteString(remoteLabel + remoteInput.View() + remoteHint + "\n\n")
+
+	// Bind addresses (on your machine)
+	addressLabel := LabelStyle.Render("Address:     ")
+	addressHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (e.g. ::1, 0.0.0.0)")
+	b.WriteString(addressLabel + addressInput.View() + addressHint + "\n")
+
+	// Warning for addresses reachable from other hosts
+	addresses := portforward.DefaultAddresses
+	if value := strings.TrimSpace(addressInput.Value()); value != "" {
+		addresses = strings.Split(value, ",")
+	}
+	var exposed []string
+	for _, addr := range addresses {
+		if addr = strings.TrimSpace(addr); addr != "" && !portforward.IsLoopbackAddress(addr) {
+			exposed = append(exposed, addr)
+		}
+	}
+	if len(exposed) > 0 {
+		b.WriteString(warningStyle.Render("   ⚠ "+strings.Join(exposed, ", ")+" is reachable from other hosts") + "\n\n")
+	} else {
+		b.WriteString("\n")
+	}
+
+	// Load balancing (services only)
+	if isService {
+		mode := "off (single pod)"
+		if balance != portforward.BalanceNone {
+			mode = string(balance)
+		}
+		balanceHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (ctrl+b)")
+		b.WriteString(LabelStyle.Render("Balance:     ") + mode + balanceHint + "\n\n")
+	}
+
+	// Lazy tunnel
+	onDemand := "off (tunnel stays open)"
+	if lazy {
+		onDemand = fmt.Sprintf("on (closes after %s idle)", portforward.DefaultIdleTimeout)
+	}
+	lazyHint := lipgloss.NewStyle().Foreground(ColorMuted).Render(" (ctrl+o)")
+	b.WriteString(LabelStyle.Render("On demand:   ") + onDemand + lazyHint + "\n\n")
 	
-	// Example
-	remotePort := remoteInput.Value()
-	if localPort != "" && remotePort != "" {
-		example := lipgloss.NewStyle().Foreground(ColorSecondary).Render(
-			fmt.Sprintf("   → localhost:%s  ➜  pod:%s", localPort, remotePort))
-		b.WriteString(example)
+	// Example, one line per port mapping
+	if ports, err := parsePortInputs(localInput.Value(), remoteInput.Value()); err == nil {
+		exampleStyle := lipgloss.NewStyle().Foreground(ColorSecondary)
+		host := strings.TrimSpace(addresses[0])
+		for _, p := range ports {
+			b.WriteString(exampleStyle.Render(
+				fmt.Sprintf("   → %s  ➜  pod:%s", net.JoinHostPort(host, p.LocalString()), p.RemoteString())) + "\n")
+		}
 	}
+	b.WriteString(lipgloss.NewStyle().Foreground(ColorMuted).Render("   Separate several ports with commas, e.g. 8080,9090 → http,metrics"))
+
+	return BoxStyle.Width(width).Render(b.String())
+}
+
+// RenderFaultsDialog renders the fault injection dialog of a connection
+// inputs are latency, jitter, bandwidth, reset, drop and stall
+func RenderFaultsDialog(connID string, inputs []textinput.Model, width int) string {
+	var b strings.Builder
+
+	b.WriteString(SubtitleStyle.Render("↯ Inject Network Faults") + "\n")
+	b.WriteString(DimStyle.Render(connID) + "\n\n")
+
+	fields := []struct{ label, hint string }{
+		{"Latency:   ", " (added to every chunk)"},
+		{"Jitter:    ", " (random extra delay, up to)"},
+		{"Bandwidth: ", " (per second, direction and client)"},
+		{"Reset:     ", " (chance per chunk of a reset)"},
+		{"Drop:      ", " (chance a new client is closed)"},
+		{"Stall:     ", " (chance a new client hangs)"},
+	}
+	hintStyle := lipgloss.NewStyle().Foreground(ColorMuted)
+	for i, input := range inputs {
+		b.WriteString(LabelStyle.Render(fields[i].label) + input.View() + hintStyle.Render(fields[i].hint) + "\n")
+	}
+	b.WriteString("\n" + hintStyle.Render("   Empty fields inject nothing; applies to open client connections too"))
+
+	return BoxStyle.Width(width).Render(b.String())
+}
+
+// RenderSaveProfileDialog renders the dialog that saves forwarded namespace
+// services as a profile
+func RenderSaveProfileDialog(description string, forwards int, input textinput.Model, width int) string {
+	var b strings.Builder
+
+	b.WriteString(SubtitleStyle.Render("💾 Save as Profile") + "\n")
+	b.WriteString(DimStyle.Render(fmt.Sprintf("%s, %d forwards", description, forwards)) + "\n\n")
+	b.WriteString(LabelStyle.Render("Name: ") + input.View() + "\n")
+	b.WriteString("\n" + lipgloss.NewStyle().Foreground(ColorMuted).Render("   Start it later with: portfwd profile start <name>"))
 
 	return BoxStyle.Width(width).Render(b.String())
 }
@@ -377,6 +543,95 @@ func RenderLogWindow(logs []string, title string, width int, maxLines int) strin
 		Render(b.String())
 }
 
+// RenderConnectionDetails renders the details pane of a connection,
+// including its traffic metrics
+func RenderConnectionDetails(info portforward.ConnectionInfo, width int) string {
+	var b strings.Builder
+
+	titleStr := lipgloss.NewStyle().
+		Foreground(ColorSecondary).
+		Bold(true).
+		Render(fmt.Sprintf("🔎 %s/%s/%s", info.Namespace, info.ResourceType.ShortName(), info.ResourceName))
+	b.WriteString(titleStr + "\n\n")
+
+	label := LabelStyle.Width(16)
+	row := func(name, value string) {
+		b.WriteString("  " + label.Render(name) + ValueStyle.Render(value) + "\n")
+	}
+
+	ports := formatPortMappings(info.Ports, info.Addresses)
+	if info.SocketPath != "" {
+		ports = fmt.Sprintf("unix:%s → %s", info.SocketPath, info.Ports[0].RemoteString())
+	}
+	row("Status:", StatusIcon(string(info.Status))+" "+string(info.Status))
+	if info.Context != "" {
+		row("Context:", info.Context)
+	}
+	row("Ports:", ports)
+	if info.PodName != "" {
+		row("Pod:", info.PodName)
+	}
+	if info.Balance != portforward.BalanceNone {
+		row("Backends:", fmt.Sprintf("%s (%s)", strings.Join(info.Backends, ", "), info.Balance))
+	}
+	if info.Lazy {
+		row("On demand:", fmt.Sprintf("tunnel closes after %s idle", info.IdleTimeout))
+	}
+	if info.TLS != nil {
+		row("TLS:", info.TLS.String())
+	}
+	if info.Recording != nil {
+		row("Recording:", info.Recording.String())
+	}
+	if info.Faults != nil {
+		row("Faults:", info.Faults.String())
+	}
+	if info.Limits != nil {
+		limits := info.Limits.String()
+		if info.Limits.Budget > 0 {
+			limits += fmt.Sprintf(" (%s used)", portforward.FormatBytes(info.Metrics.BytesSent+info.Metrics.BytesReceived))
+		}
+		row("Limits:", limits)
+	}
+	for i, r := range info.Routes {
+		name := ""
+		if i == 0 {
+			name = "Routes:"
+		}
+		row(name, r.Match()+" → "+r.Target())
+	}
+	row("Uptime:", formatDuration(info.Duration))
+	row("Reconnects:", strconv.Itoa(info.ReconnectCount))
+	if info.Error != "" {
+		b.WriteString("  " + label.Render("Error:") + StatusErrorStyle.Render(info.Error) + "\n")
+	}
+	if info.Probe != nil {
+		row("Probe:", info.Probe.String())
+		if info.ProbeError != "" {
+			b.WriteString("  " + label.Render("Probe error:") + StatusWarningStyle.Render(fmt.Sprintf("%s (%d in a row)", info.ProbeError, info.ProbeFailures)) + "\n")
+		}
+	}
+
+	metrics := info.Metrics
+	lastActivity := "never"
+	if !metrics.LastActivity.IsZero() {
+		lastActivity = formatDuration(time.Since(metrics.LastActivity)) + " ago"
+	}
+	b.WriteString("\n" + SubtitleStyle.Render("Traffic") + "\n")
+	row("Sent:", portforward.FormatBytes(metrics.BytesSent))
+	row("Received:", portforward.FormatBytes(metrics.BytesReceived))
+	row("Connections:", fmt.Sprintf("%d open, %d total", metrics.OpenConns, metrics.TotalConns))
+	row("Errors:", strconv.FormatInt(metrics.Errors, 10))
+	row("Last activity:", lastActivity)
+
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorBorder).
+		Padding(0, 1).
+		Width(width).
+		Render(b.String())
+}
+
 // RenderHelp renders help text based on current view
 func RenderHelp(view string) string {
 	var keys []string
@@ -393,16 +648,24 @@ func RenderHelp(view string) string {
 			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" select"),
 			HelpKeyStyle.Render("p") + HelpDescStyle.Render(" pods"),
 			HelpKeyStyle.Render("s") + HelpDescStyle.Render(" services"),
+			HelpKeyStyle.Render("d") + HelpDescStyle.Render(" deployments"),
 			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" back"),
 		}
 	case "connecting":
 		keys = []string{
 			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" cancel"),
 		}
-	case "namespace", "pod", "service":
+	case "namespace", "pod", "workload":
+		keys = []string{
+			HelpKeyStyle.Render("↑/↓") + HelpDescStyle.Render(" navigate"),
+			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" select"),
+			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" back"),
+		}
+	case "service":
 		keys = []string{
 			HelpKeyStyle.Render("↑/↓") + HelpDescStyle.Render(" navigate"),
 			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" select"),
+			HelpKeyStyle.Render("A") + HelpDescStyle.Render(" forward all"),
 			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" back"),
 		}
 	case "connections":
@@ -414,8 +677,23 @@ func RenderHelp(view string) string {
 			HelpKeyStyle.Render("r") + HelpDescStyle.Render(" reconnect"),
 			HelpKeyStyle.Render("x") + HelpDescStyle.Render(" delete"),
 			HelpKeyStyle.Render("l") + HelpDescStyle.Render(" logs"),
+			HelpKeyStyle.Render("i") + HelpDescStyle.Render(" details"),
+			HelpKeyStyle.Render("R") + HelpDescStyle.Render(" record"),
+			HelpKeyStyle.Render("F") + HelpDescStyle.Render(" faults"),
+		}
+	case "faults":
+		keys = []string{
+			HelpKeyStyle.Render("tab") + HelpDescStyle.Render(" next field"),
+			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" apply"),
+			HelpKeyStyle.Render("ctrl+x") + HelpDescStyle.Render(" clear all"),
+			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" cancel"),
 		}
-	case "logs":
+	case "save_profile":
+		keys = []string{
+			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" save"),
+			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" skip"),
+		}
+	case "logs", "details":
 		keys = []string{
 			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" back"),
 		}
@@ -432,6 +710,8 @@ func RenderHelp(view string) string {
 	case "port_input":
 		keys = []string{
 			HelpKeyStyle.Render("tab") + HelpDescStyle.Render(" next field"),
+			HelpKeyStyle.Render("ctrl+b") + HelpDescStyle.Render(" balance"),
+			HelpKeyStyle.Render("ctrl+o") + HelpDescStyle.Render(" on demand"),
 			HelpKeyStyle.Render("enter") + HelpDescStyle.Render(" confirm"),
 			HelpKeyStyle.Render("esc") + HelpDescStyle.Render(" cancel"),
 		}
@@ -473,6 +753,9 @@ func RenderHelpScreen(width, height int, debugMode bool) string {
 				{"r", "Reconnect stopped connection"},
 				{"x, Delete", "Delete connection from list"},
 				{"l", "View connection logs"},
+				{"i", "View connection details and traffic"},
+				{"R", "Start/stop recording traffic (HAR or raw dumps)"},
+				{"F", "Inject network faults (latency, bandwidth, resets, drops, stalls)"},
 			},
 		},
 		{
@@ -482,12 +765,15 @@ func RenderHelpScreen(width, height int, debugMode bool) string {
 				{"Enter", "Select item"},
 				{"p", "Quick select Pods (resource type)"},
 				{"s", "Quick select Services (resource type)"},
+				{"d", "Quick select Deployments (resource type)"},
+				{"A", "Forward all services of the namespace"},
 			},
 		},
 		{
 			name: "Port Input",
 			keys: [][]string{
 				{"Tab", "Switch between local/remote port"},
+				{"Ctrl+B", "Cycle load balancing (services)"},
 				{"Enter", "Start port-forward"},
 			},
 		},
@@ -769,3 +1055,21 @@ func calculateOffset(selected, total, visibleItems int) int {
 var ScrollIndicatorStyle = lipgloss.NewStyle().
 	Foreground(ColorSecondary).
 	Italic(true)
+
+// formatPortMappings renders port mappings as "localhost:8080 → 80, :9090 → metrics",
+// naming the first bind address unless it's the default loopback one
+func formatPortMappings(ports []portforward.PortMapping, addresses []string) string {
+	host := "localhost"
+	if len(addresses) > 0 && addresses[0] != portforward.DefaultAddresses[0] {
+		host = addresses[0]
+	}
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		if i == 0 {
+			parts[i] = fmt.Sprintf("%s → %s", net.JoinHostPort(host, strconv.Itoa(p.Local)), p.RemoteString())
+		} else {
+			parts[i] = fmt.Sprintf(":%d → %s", p.Local, p.RemoteString())
+		}
+	}
+	return strings.Join(parts, ", ")
+}
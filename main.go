@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/pyqan/portFwd/internal/config"
 	"github.com/pyqan/portFwd/internal/daemon"
+	"github.com/pyqan/portFwd/internal/hosts"
 	"github.com/pyqan/portFwd/internal/k8s"
 	"github.com/pyqan/portFwd/internal/logger"
 	"github.com/pyqan/portFwd/internal/portforward"
@@ -25,9 +28,10 @@ var (
 	version = "1.0.0"
 
 	// Global flags
-	namespace  string
-	configPath string
-	debugMode  bool
+	namespace   string
+	configPath  string
+	debugMode   bool
+	kubeOptions k8s.Options
 )
 
 func main() {
@@ -48,6 +52,12 @@ Features:
 	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Kubernetes namespace")
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Config file path")
 	rootCmd.PersistentFlags().BoolVarP(&debugMode, "debug", "d", false, "Enable debug logging to ~/.config/portfwd/debug.log")
+	rootCmd.PersistentFlags().StringVar(&kubeOptions.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
+	rootCmd.PersistentFlags().StringVar(&kubeOptions.Context, "context", "", "Kubeconfig context to use (default: the current context)")
+	rootCmd.PersistentFlags().StringVar(&kubeOptions.Cluster, "cluster", "", "Kubeconfig cluster to use instead of the context's")
+	rootCmd.PersistentFlags().StringVar(&kubeOptions.User, "user", "", "Kubeconfig user to use instead of the context's")
+	rootCmd.PersistentFlags().StringVar(&kubeOptions.Impersonate, "as", "", "User to impersonate")
+	rootCmd.PersistentFlags().StringArrayVar(&kubeOptions.ImpersonateGroups, "as-group", nil, "Group to impersonate (repeatable)")
 
 	// Add subcommands
 	rootCmd.AddCommand(
@@ -59,6 +69,12 @@ Features:
 		newAddCmd(),
 		newRemoveCmd(),
 		newStatusCmd(),
+		newHostsCmd(),
+		newProxyCmd(),
+		newTLSCmd(),
+		newRecordCmd(),
+		newRecordingsCmd(),
+		newFaultsCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -80,7 +96,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		logger.Debug("main", "Log file: %s", logger.GetLogPath())
 	}
 
-	k8sClient, err := k8s.NewClient()
+	k8sClient, err := k8s.NewClient(kubeOptions)
 	if err != nil {
 		logger.Error("main", "Failed to create Kubernetes client: %v", err)
 		return fmt.Errorf("failed to create Kubernetes client: %w", err)
@@ -94,7 +110,10 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 	}
 	logger.Debug("main", "Config loaded")
 
-	pfManager := portforward.NewManager(k8sClient.GetClientset(), k8sClient.GetRestConfig())
+	pfManager, err := daemon.NewManager(k8sClient, cfg)
+	if err != nil {
+		return err
+	}
 	logger.Debug("main", "Port-forward manager created")
 
 	// Cleanup on exit
@@ -104,52 +123,123 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		logger.Info("main", "PortFwd shutdown complete")
 	}()
 
-	return ui.Run(k8sClient, pfManager, cfg, debugMode)
+	return ui.Run(k8sClient, pfManager, cfg, configPath, debugMode)
 }
 
 // newForwardCmd creates the forward command
 func newForwardCmd() *cobra.Command {
 	var (
-		pod        string
-		service    string
-		localPort  int
-		remotePort int
+		pod         string
+		service     string
+		localPorts  []string
+		remotePorts []string
+		settings    forwardSettings
+		all         allServicesSettings
+		record      bool
+		recordAs    string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "forward",
+		Use:   "forward [TYPE/NAME]",
 		Short: "Start a port-forward",
-		Long:  "Start a port-forward to a pod or service",
+		Long:  "Start a port-forward to a pod, service or workload (deploy, sts, rs, ds, job)",
+		Args:  cobra.MaximumNArgs(1),
 		Example: `  # Forward local port 8080 to pod's port 80
   portfwd forward -n default -p my-pod -l 8080 -r 80
 
+  # Forward to a pod of a deployment (follows pod replacements)
+  portfwd forward deploy/my-app -n default -l 8080 -r 80
+
   # Forward using same port numbers
-  portfwd forward -n default -p my-pod -l 3000 -r 3000`,
+  portfwd forward -n default -p my-pod -l 3000 -r 3000
+
+  # Listen on all interfaces (e.g. for devcontainers and VMs)
+  portfwd forward svc/my-svc -n default -l 8080 -r 80 --address 0.0.0.0
+
+  # Listen on a Unix socket (e.g. psql -h /tmp/pg)
+  portfwd forward svc/postgres -n db -r 5432 --socket /tmp/pg/.s.PGSQL.5432 --socket-mode 0660
+
+  # Let portfwd pick a free local port
+  portfwd forward svc/my-svc -n default -l auto -r 80
+
+  # Forward several ports over one connection (remote ports may be names)
+  portfwd forward deploy/my-app -n default -l 8080 -r http -l 9090 -r metrics -l 5005 -r debug
+
+  # Spread connections over all ready pods of a service
+  portfwd forward -n default -s my-svc -l 8080 -r 80 --balance round-robin
+
+  # Forward in another cluster of the kubeconfig
+  portfwd forward svc/my-svc -n default -l 8081 -r 80 --context staging
+
+  # Forward every service port of a namespace and keep the set as a profile
+  portfwd forward --all-services -n team-a --port-offset 10000 --save-profile team-a
+
+  # Give every service its own loopback IP and its in-cluster names (needs root)
+  sudo portfwd forward --all-services -n team-a --loopback-aliases --hosts
+
+  # Serve several services behind one local HTTP port, routed by path
+  portfwd forward router/frontend -n team-a -l 3000 --route /api=svc/api:8080 --route /=svc/web:80
+
+  # Serve https://localhost:8443 with a certificate from the local CA
+  portfwd forward svc/web -n default -l 8443 -r 80 --tls terminate
+
+  # Speak plain HTTP locally to a pod port that expects TLS
+  portfwd forward svc/api -n default -l 8080 -r 443 --tls originate --tls-ca ./cluster-ca.crt
+
+  # See how a client copes with a slow, flaky network
+  portfwd forward svc/api -n default -l 8080 -r 80 --faults latency=200ms,jitter=50ms,drop=5%
+
+  # Record the traffic, as HAR for HTTP and as raw dumps otherwise
+  portfwd forward svc/api -n default -l 8080 -r 80 --record
+
+  # Protect a shared database: 10 clients at most, 1 MB/s down, 5 GB in total
+  portfwd forward svc/db -n default -l 5432 -r 5432 --max-conns 10 --max-download 1MB --budget 5GB`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if namespace == "" {
 				return fmt.Errorf("namespace is required (-n)")
 			}
-			if pod == "" && service == "" {
-				return fmt.Errorf("either pod (-p) or service (-s) is required")
+			if all.enabled {
+				if len(args) > 0 || pod != "" || service != "" || len(localPorts) > 0 || len(remotePorts) > 0 || settings.socket != "" {
+					return fmt.Errorf("--all-services can't be combined with a target, ports or --socket")
+				}
+				settings.context = kubeOptions.Context
+				return forwardAllServices(namespace, settings, all)
+			}
+			if all.selector != "" || all.saveProfile != "" || all.loopbackAliases || all.hosts {
+				return fmt.Errorf("--selector, --save-profile, --loopback-aliases and --hosts need --all-services")
 			}
-			if localPort == 0 {
-				return fmt.Errorf("local port is required (-l)")
+			if recordAs != "" && !record {
+				return fmt.Errorf("--record-format needs --record")
+			}
+			target, err := forwardTarget(args, pod, service)
+			if err != nil {
+				return err
 			}
-			if remotePort == 0 {
-				remotePort = localPort
+			ports, err := portMappings(localPorts, remotePorts, settings.socket != "")
+			if err != nil {
+				return err
 			}
 
-			k8sClient, err := k8s.NewClient()
+			k8sClient, err := k8s.NewClient(kubeOptions)
 			if err != nil {
 				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
 
-			target := pod
-			if service != "" {
-				target = service
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			pfManager := portforward.NewManager(k8sClient.GetClientset(), k8sClient.GetRestConfig())
+			settings.context = kubeOptions.Context
+			opts, err := forwardOptions(namespace, target, ports, settings)
+			if err != nil {
+				return err
+			}
+
+			pfManager, err := daemon.NewManager(k8sClient, cfg)
+			if err != nil {
+				return err
+			}
 
 			// Handle signals for graceful shutdown
 			ctx, cancel := context.WithCancel(context.Background())
@@ -165,14 +255,40 @@ func newForwardCmd() *cobra.Command {
 				cancel()
 			}()
 
-			fmt.Printf("Starting port-forward: localhost:%d -> %s/%s:%d\n", localPort, namespace, target, remotePort)
+			fmt.Printf("Starting port-forward: %s/%s/%s %s\n", namespace, opts.ResourceType.ShortName(), opts.ResourceName, describePorts(opts))
 
-			conn, err := pfManager.StartPortForward(ctx, namespace, target, localPort, remotePort)
+			conn, err := pfManager.StartWithOptions(ctx, opts)
 			if err != nil {
 				return fmt.Errorf("failed to start port-forward: %w", err)
 			}
 
-			fmt.Printf("✓ Port forward active: localhost:%d\n", localPort)
+			active := conn.Options()
+			if active.SocketPath != "" {
+				fmt.Printf("✓ Port forward active: unix:%s -> %s\n", active.SocketPath, active.Ports[0].RemoteString())
+			} else {
+				for _, p := range active.Ports {
+					for _, addr := range active.Addresses {
+						fmt.Printf("✓ Port forward active: %s -> %s\n", net.JoinHostPort(addr, strconv.Itoa(p.Local)), p.RemoteString())
+					}
+				}
+			}
+			for _, r := range active.Routes {
+				fmt.Printf("  route %s -> %s\n", r.Match(), r.Target())
+			}
+			if active.Faults != nil {
+				fmt.Printf("↯ Injecting faults: %s\n", active.Faults)
+			}
+			if active.Limits != nil {
+				fmt.Printf("  limits %s\n", active.Limits)
+			}
+			if record {
+				dir, err := pfManager.StartRecording(conn.ID, portforward.RecordOptions{Format: portforward.RecordFormat(recordAs)})
+				if err != nil {
+					pfManager.StopAll()
+					return fmt.Errorf("failed to start recording: %w", err)
+				}
+				fmt.Printf("⏺ Recording traffic to %s\n", dir)
+			}
 			fmt.Println("Press Ctrl+C to stop")
 
 			// Wait for context cancellation
@@ -180,6 +296,9 @@ func newForwardCmd() *cobra.Command {
 
 			info := conn.GetConnectionInfo()
 			fmt.Printf("\nPort forward stopped after %s\n", info.Duration)
+			fmt.Printf("Traffic: ↑%s ↓%s over %d connections (%d errors)\n",
+				portforward.FormatBytes(info.Metrics.BytesSent), portforward.FormatBytes(info.Metrics.BytesReceived),
+				info.Metrics.TotalConns, info.Metrics.Errors)
 
 			return nil
 		},
@@ -187,12 +306,220 @@ func newForwardCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&pod, "pod", "p", "", "Pod name")
 	cmd.Flags().StringVarP(&service, "service", "s", "", "Service name")
-	cmd.Flags().IntVarP(&localPort, "local", "l", 0, "Local port")
-	cmd.Flags().IntVarP(&remotePort, "remote", "r", 0, "Remote port (defaults to local port)")
+	cmd.Flags().StringSliceVarP(&localPorts, "local", "l", nil, "Local port, 0 or auto for a free one (repeat for several ports)")
+	cmd.Flags().StringSliceVarP(&remotePorts, "remote", "r", nil, "Remote port number or name, paired with -l by position (defaults to local port)")
+	addForwardFlags(cmd, &settings)
+	cmd.Flags().BoolVar(&all.enabled, "all-services", false, "Forward every TCP port of every service in the namespace")
+	cmd.Flags().StringVar(&all.selector, "selector", "", "With --all-services, only services matching this label selector")
+	cmd.Flags().IntVar(&all.portOffset, "port-offset", 0, "With --all-services, local port = service port + offset")
+	cmd.Flags().StringVar(&all.conflict, "on-conflict", "offset", "With --all-services, how taken local ports are replaced (offset, auto)")
+	cmd.Flags().IntVar(&all.conflictOffset, "conflict-offset", portforward.DefaultConflictOffset, "Step added to a taken local port with --on-conflict offset")
+	cmd.Flags().StringVar(&all.saveProfile, "save-profile", "", "With --all-services, save the started forwards as this profile")
+	cmd.Flags().BoolVar(&all.loopbackAliases, "loopback-aliases", false, "With --all-services, bind every service to its own 127.x.y.z address (Linux)")
+	cmd.Flags().BoolVar(&all.hosts, "hosts", false, "With --loopback-aliases, resolve the services' in-cluster names through the hosts file until exit")
+	cmd.Flags().StringVar(&all.hostsFile, "hosts-file", hosts.DefaultPath, "Hosts file updated by --hosts")
+	cmd.Flags().StringVar(&all.clusterDomain, "cluster-domain", portforward.DefaultClusterDomain, "Cluster domain of the names added by --hosts")
+	cmd.Flags().BoolVar(&record, "record", false, "Record the traffic of every client connection (see portfwd recordings)")
+	cmd.Flags().StringVar(&recordAs, "record-format", "", "With --record, auto (HAR for HTTP/1.x, raw dumps otherwise) or raw")
 
 	return cmd
 }
 
+// allServicesSettings are the flags of forward --all-services
+type allServicesSettings struct {
+	enabled        bool
+	selector       string
+	portOffset     int
+	conflict       string
+	conflictOffset int
+	saveProfile    string
+
+	loopbackAliases bool
+	hosts           bool
+	hostsFile       string
+	clusterDomain   string
+}
+
+// forwardAllServices forwards every service port of a namespace, prints the
+// port mapping and waits for Ctrl+C
+func forwardAllServices(namespace string, settings forwardSettings, all allServicesSettings) error {
+	conflict, err := portforward.ParseConflictStrategy(all.conflict)
+	if err != nil {
+		return err
+	}
+	if all.hosts && !all.loopbackAliases {
+		return fmt.Errorf("--hosts needs --loopback-aliases")
+	}
+	portRange, err := portforward.ParsePortRange(settings.portRange)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.NewClient(kubeOptions)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	pfManager, err := daemon.NewManager(k8sClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Handle signals for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		fmt.Println("\nShutting down...")
+		pfManager.StopAll()
+		cancel()
+	}()
+
+	plan, err := pfManager.PlanNamespace(ctx, portforward.NamespaceOptions{
+		Context:        settings.context,
+		Namespace:      namespace,
+		Selector:       all.selector,
+		PortOffset:     all.portOffset,
+		Conflict:       conflict,
+		ConflictOffset: all.conflictOffset,
+		PortRange:      portRange,
+		Addresses:      settings.addresses,
+
+		LoopbackAliases: all.loopbackAliases,
+	})
+	if err != nil {
+		return err
+	}
+	if len(plan.Services) == 0 {
+		for _, skipped := range plan.Skipped {
+			fmt.Printf("  skipped %s\n", skipped)
+		}
+		return fmt.Errorf("no services to forward in %s", namespace)
+	}
+
+	// The other forward settings apply to every service
+	for i := range plan.Services {
+		sp := &plan.Services[i]
+		opts, err := forwardOptions(namespace, "svc/"+sp.Service, sp.Options.Ports, settings)
+		if err != nil {
+			return err
+		}
+		opts.Addresses = sp.Options.Addresses
+		if opts.TLS != nil && sp.Address != "" {
+			// A generated certificate also covers the service's in-cluster names
+			tlsOpts := *opts.TLS
+			tlsOpts.Hosts = append(append([]string(nil), tlsOpts.Hosts...), portforward.ServiceHostnames(sp.Service, namespace, all.clusterDomain)...)
+			opts.TLS = &tlsOpts
+		}
+		sp.Options = opts
+	}
+
+	fmt.Printf("Starting %d service forwards in %s\n\n", len(plan.Services), namespace)
+	errs := pfManager.StartPlan(ctx, plan)
+
+	fmt.Printf("  %-30s %-20s %-22s %s\n", "SERVICE", "PORT", "LOCAL", "NOTE")
+	started := 0
+	var entries []hosts.Entry
+	for i, sp := range plan.Services {
+		if errs[i] == nil {
+			started++
+			if sp.Address != "" {
+				entries = append(entries, hosts.Entry{
+					IP:    sp.Address,
+					Names: portforward.ServiceHostnames(sp.Service, namespace, all.clusterDomain),
+				})
+			}
+		}
+		local := ""
+		if sp.Address != "" {
+			local = sp.Address + ":"
+		}
+		for _, p := range sp.Ports {
+			port := strconv.Itoa(p.Remote)
+			if p.Name != "" {
+				port += " (" + p.Name + ")"
+			}
+			note := ""
+			switch {
+			case errs[i] != nil:
+				note = "✗ " + errs[i].Error()
+			case p.Local != p.Preferred:
+				note = fmt.Sprintf("%d was taken", p.Preferred)
+			}
+			fmt.Printf("  %-30s %-20s %-22s %s\n", sp.Service, port, local+strconv.Itoa(p.Local), note)
+		}
+	}
+	for _, skipped := range plan.Skipped {
+		fmt.Printf("  skipped %s\n", skipped)
+	}
+	if started == 0 {
+		return fmt.Errorf("no service forwards could be started")
+	}
+	fmt.Printf("\n✓ %d of %d services forwarded\n", started, len(plan.Services))
+
+	if all.saveProfile != "" {
+		// Remember the context the services were found in, also when it's
+		// the current one, so the profile doesn't follow a later switch
+		kubeContext := settings.context
+		if kubeContext == "" {
+			if kubeContext, err = k8sClient.GetCurrentContext(); err != nil {
+				return fmt.Errorf("failed to resolve the current context: %w", err)
+			}
+		}
+		base := config.ForwardSpec{
+			Addresses:   settings.addresses,
+			Balance:     settings.balance,
+			Lazy:        settings.lazy,
+			IdleTimeout: settings.idle,
+		}
+		if settings.tls.Mode != "" {
+			base.TLS = &settings.tls
+		}
+		if settings.limits != (config.LimitsConfig{}) {
+			base.Limits = &settings.limits
+		}
+		profile := daemon.NamespaceProfile(all.saveProfile, plan, errs, all.selector, kubeContext, base)
+		profile.PortRange = settings.portRange
+		cfg.AddProfile(profile)
+		if err := cfg.Save(configPath); err != nil {
+			return fmt.Errorf("failed to save profile: %w", err)
+		}
+		fmt.Printf("✓ Saved as profile '%s'\n", profile.Name)
+	}
+
+	if all.hosts {
+		block := namespace
+		if settings.context != "" {
+			block += "@" + settings.context
+		}
+		if err := hosts.Set(all.hostsFile, block, entries); err != nil {
+			return fmt.Errorf("failed to update hosts file: %w", err)
+		}
+		defer func() {
+			if err := hosts.Remove(all.hostsFile, block); err != nil {
+				fmt.Printf("✗ Failed to clean up %s: %v (run: portfwd hosts clean %s)\n", all.hostsFile, err, block)
+				return
+			}
+			fmt.Printf("✓ Removed the %s entries from %s\n", block, all.hostsFile)
+		}()
+		fmt.Printf("✓ Added %d services to %s\n", len(entries), all.hostsFile)
+	}
+
+	fmt.Println("Press Ctrl+C to stop all forwards")
+	<-ctx.Done()
+
+	return nil
+}
+
 // newListCmd creates the list command
 func newListCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -208,7 +535,7 @@ func newListCmd() *cobra.Command {
 			Short: "List namespaces",
 			Aliases: []string{"ns"},
 			RunE: func(cmd *cobra.Command, args []string) error {
-				k8sClient, err := k8s.NewClient()
+				k8sClient, err := k8s.NewClient(kubeOptions)
 				if err != nil {
 					return err
 				}
@@ -233,7 +560,7 @@ func newListCmd() *cobra.Command {
 					namespace = "default"
 				}
 
-				k8sClient, err := k8s.NewClient()
+				k8sClient, err := k8s.NewClient(kubeOptions)
 				if err != nil {
 					return err
 				}
@@ -260,7 +587,7 @@ func newListCmd() *cobra.Command {
 					namespace = "default"
 				}
 
-				k8sClient, err := k8s.NewClient()
+				k8sClient, err := k8s.NewClient(kubeOptions)
 				if err != nil {
 					return err
 				}
@@ -340,11 +667,14 @@ func newProfileCmd() *cobra.Command {
 				}
 				fmt.Println("\nForwards:")
 				for _, fwd := range profile.Forwards {
-					target := fwd.Pod
-					if fwd.Service != "" {
-						target = fmt.Sprintf("svc/%s", fwd.Service)
+					ports, err := portforward.ParsePortMappings(fwd.Ports, fwd.LocalPort, fwd.RemotePort)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("  %s/%s  %s\n", fwd.Namespace, fwd.Target(), describePorts(portforward.ForwardOptions{Ports: ports, SocketPath: fwd.Socket}))
+					for _, route := range fwd.Routes {
+						fmt.Printf("      route %s\n", route)
 					}
-					fmt.Printf("  %s/%s  localhost:%d -> %d\n", fwd.Namespace, target, fwd.LocalPort, fwd.RemotePort)
 				}
 				return nil
 			},
@@ -364,12 +694,15 @@ func newProfileCmd() *cobra.Command {
 					return err
 				}
 
-				k8sClient, err := k8s.NewClient()
+				k8sClient, err := k8s.NewClient(kubeOptions)
 				if err != nil {
 					return err
 				}
 
-				pfManager := portforward.NewManager(k8sClient.GetClientset(), k8sClient.GetRestConfig())
+				pfManager, err := daemon.NewManager(k8sClient, cfg)
+				if err != nil {
+					return err
+				}
 
 				// Handle signals for graceful shutdown
 				ctx, cancel := context.WithCancel(context.Background())
@@ -388,17 +721,42 @@ func newProfileCmd() *cobra.Command {
 				fmt.Printf("Starting profile: %s\n", profile.Name)
 
 				for _, fwd := range profile.Forwards {
-					target := fwd.Pod
-					if fwd.Service != "" {
-						target = fwd.Service
+					target := fwd.Target()
+
+					ports, err := portforward.ParsePortMappings(fwd.Ports, fwd.LocalPort, fwd.RemotePort)
+					var opts portforward.ForwardOptions
+					if err == nil {
+						settings := forwardSettings{
+							portRange:  profile.PortRange,
+							addresses:  fwd.Addresses,
+							socket:     fwd.Socket,
+							socketMode: fwd.SocketMode,
+							balance:    fwd.Balance,
+							lazy:       fwd.Lazy,
+							idle:       fwd.IdleTimeout,
+							routes:     fwd.Routes,
+							context:    profileContext(profile, fwd),
+						}
+						if fwd.Probe != nil {
+							settings.probe = *fwd.Probe
+						}
+						if fwd.TLS != nil {
+							settings.tls = *fwd.TLS
+						}
+						if fwd.Limits != nil {
+							settings.limits = *fwd.Limits
+						}
+						opts, err = forwardOptions(fwd.Namespace, target, ports, settings)
+					}
+					var conn *portforward.Connection
+					if err == nil {
+						conn, err = pfManager.StartWithOptions(ctx, opts)
 					}
-
-					_, err := pfManager.StartPortForward(ctx, fwd.Namespace, target, fwd.LocalPort, fwd.RemotePort)
 					if err != nil {
 						fmt.Printf("✗ Failed: %s/%s - %v\n", fwd.Namespace, target, err)
 						continue
 					}
-					fmt.Printf("✓ localhost:%d -> %s/%s:%d\n", fwd.LocalPort, fwd.Namespace, target, fwd.RemotePort)
+					fmt.Printf("✓ %s/%s %s\n", fwd.Namespace, target, describePorts(conn.Options()))
 				}
 
 				fmt.Println("\nPress Ctrl+C to stop all forwards")
@@ -434,6 +792,326 @@ func newProfileCmd() *cobra.Command {
 	return cmd
 }
 
+// newProxyCmd creates the proxy command
+func newProxyCmd() *cobra.Command {
+	var opts portforward.ProxyOptions
+
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Run a SOCKS5 proxy into the cluster",
+		Long: `Run a SOCKS5 proxy that opens a port-forward stream for every CONNECT request.
+Targets are service names (svc, svc.ns, svc.ns.svc.cluster.local) with a service port,
+pod.svc.ns for pods behind a headless service, or a pod IP with a pod port.`,
+		Example: `  # Reach any in-cluster HTTP endpoint without declaring forwards
+  portfwd proxy --socks :1080
+  curl --socks5-hostname localhost:1080 http://api.team-a.svc.cluster.local/healthz`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k8sClient, err := k8s.NewClient(kubeOptions)
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
+			}
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			pfManager, err := daemon.NewManager(k8sClient, cfg)
+			if err != nil {
+				return err
+			}
+			opts.Context = kubeOptions.Context
+			opts.Namespace = namespace
+			proxy, err := pfManager.StartProxy(opts)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+
+			fmt.Printf("✓ SOCKS5 proxy listening on %s\n", proxy.Addr())
+			fmt.Println("Press Ctrl+C to stop")
+
+			sigChan := make(chan os.Signal, 1)
+			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+			<-sigChan
+
+			stats := proxy.Stats()
+			fmt.Printf("\nProxy stopped after %d requests (%d errors)\n", stats.Requests, stats.Errors)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Address, "socks", ":1080", "Address to listen on; an empty host means 127.0.0.1")
+	cmd.Flags().StringVar(&opts.ClusterDomain, "cluster-domain", portforward.DefaultClusterDomain, "Cluster domain of service names")
+
+	return cmd
+}
+
+// newHostsCmd creates the hosts command for the blocks added by forward --hosts
+func newHostsCmd() *cobra.Command {
+	var hostsFile string
+
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage portfwd entries in the hosts file",
+		Long:  "List or remove the hosts file entries added by forward --hosts, e.g. after it was killed",
+	}
+	cmd.PersistentFlags().StringVar(&hostsFile, "hosts-file", hosts.DefaultPath, "Hosts file to manage")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List portfwd blocks in the hosts file",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				blocks, err := hosts.Blocks(hostsFile)
+				if err != nil {
+					return err
+				}
+				if len(blocks) == 0 {
+					fmt.Println("No portfwd entries in", hostsFile)
+					return nil
+				}
+				for _, block := range blocks {
+					fmt.Printf("  %s\n", block)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "clean [name]",
+			Short: "Remove one or all portfwd blocks from the hosts file",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if len(args) == 1 {
+					if err := hosts.Remove(hostsFile, args[0]); err != nil {
+						return err
+					}
+					fmt.Printf("Removed '%s' from %s\n", args[0], hostsFile)
+					return nil
+				}
+				removed, err := hosts.RemoveAll(hostsFile)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Removed %d blocks from %s\n", len(removed), hostsFile)
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// newTLSCmd creates the tls command
+func newTLSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Manage the local CA used for TLS termination",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "ca",
+			Short: "Print the path of the local CA certificate, creating it if needed",
+			Long:  "Print the path of the local CA that signs the certificates of --tls terminate. Add it to your browser's or system's trust store once to avoid certificate warnings.",
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ca, path, err := portforward.LocalCA(portforward.DefaultTLSDir())
+				if err != nil {
+					return err
+				}
+				fmt.Println(path)
+				fmt.Fprintf(os.Stderr, "%s, valid until %s\n", ca.Leaf.Subject.CommonName, ca.Leaf.NotAfter.Format("2006-01-02"))
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// newRecordCmd creates the record command for daemon connections
+func newRecordCmd() *cobra.Command {
+	var (
+		format     string
+		maxFileMB  int64
+		maxTotalMB int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "record",
+		Short: "Record the traffic of a daemon connection",
+		Long: `Record the traffic of new client connections of a daemon connection.
+
+Streams that start like an HTTP/1.x request are written as HAR entries, all
+others as timestamped hex dumps. Files are kept per connection under the
+recordings directory next to the daemon log; list them with portfwd recordings.`,
+	}
+
+	send := func(payload daemon.RecordPayload) error {
+		if !daemon.IsDaemonRunning() {
+			return fmt.Errorf("daemon is not running")
+		}
+
+		client := daemon.NewClient()
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		defer client.Close()
+
+		resp, err := client.Record(payload)
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			return fmt.Errorf(resp.Error)
+		}
+
+		fmt.Println(resp.Message)
+		return nil
+	}
+
+	startCmd := &cobra.Command{
+		Use:   "start [id]",
+		Short: "Start recording a connection",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if maxFileMB < 0 || maxTotalMB < 0 {
+				return fmt.Errorf("size limits can't be negative")
+			}
+			return send(daemon.RecordPayload{
+				ID:           args[0],
+				Format:       format,
+				MaxFileSize:  maxFileMB << 20,
+				MaxTotalSize: maxTotalMB << 20,
+			})
+		},
+	}
+	startCmd.Flags().StringVar(&format, "format", "", "auto (HAR for HTTP/1.x, raw dumps otherwise) or raw")
+	startCmd.Flags().Int64Var(&maxFileMB, "max-file-mb", portforward.DefaultRecordMaxFileSize>>20, "Size at which a raw dump stops and a HAR file rotates")
+	startCmd.Flags().Int64Var(&maxTotalMB, "max-total-mb", portforward.DefaultRecordMaxTotalSize>>20, "Size of the connection's recordings before the oldest files are deleted")
+
+	stopCmd := &cobra.Command{
+		Use:   "stop [id]",
+		Short: "Stop recording a connection",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return send(daemon.RecordPayload{ID: args[0], Stop: true})
+		},
+	}
+
+	cmd.AddCommand(startCmd, stopCmd)
+	return cmd
+}
+
+// newRecordingsCmd creates the recordings command
+func newRecordingsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "recordings [id]",
+		Short: "List traffic recordings",
+		Long:  "List the recording files of all connections, or of the connection with the given ID",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := daemon.GetRecordingsDir()
+			files, err := portforward.ListRecordings(dir)
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				var matching []portforward.RecordingFile
+				for _, f := range files {
+					if f.Connection == args[0] {
+						matching = append(matching, f)
+					}
+				}
+				files = matching
+			}
+			if len(files) == 0 {
+				fmt.Printf("No recordings in %s\n", dir)
+				fmt.Println("Start one with: portfwd record start <id>")
+				return nil
+			}
+
+			fmt.Printf("Recordings in %s:\n", dir)
+			connection := ""
+			for _, f := range files {
+				if f.Connection != connection {
+					connection = f.Connection
+					fmt.Printf("\n  %s\n", connection)
+				}
+				fmt.Printf("    %-45s %10s  %s\n", filepath.Base(f.Path), portforward.FormatBytes(f.Size), f.Modified.Format("2006-01-02 15:04:05"))
+			}
+			return nil
+		},
+	}
+}
+
+// newFaultsCmd creates the faults command for daemon connections
+func newFaultsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "faults",
+		Short: "Inject network faults into a daemon connection",
+		Long: `Inject network faults into the client connections of a daemon connection, to
+test how clients cope with a bad network. A profile is a comma-separated list of:
+
+  latency=DURATION   delay added to every chunk in both directions
+  jitter=DURATION    random extra delay of up to this much per chunk
+  bandwidth=SIZE     cap per direction of each client connection, e.g. 64KB
+  reset=PERCENT      chance per chunk that the client connection is reset
+  drop=PERCENT       chance that a new client connection is closed right away
+  stall=PERCENT      chance that a new client connection hangs without an answer
+
+Changes apply to open client connections too.`,
+	}
+
+	send := func(id, faults string) error {
+		if !daemon.IsDaemonRunning() {
+			return fmt.Errorf("daemon is not running")
+		}
+
+		client := daemon.NewClient()
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		defer client.Close()
+
+		resp, err := client.Faults(id, faults)
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			return fmt.Errorf(resp.Error)
+		}
+
+		fmt.Println(resp.Message)
+		return nil
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "set [id] [profile]",
+			Short:   "Replace the fault profile of a connection",
+			Example: `  portfwd faults set "default/svc/api:8080->80" latency=200ms,jitter=50ms,drop=5%`,
+			Args:    cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if _, err := portforward.ParseFaults(args[1]); err != nil {
+					return err
+				}
+				return send(args[0], args[1])
+			},
+		},
+		&cobra.Command{
+			Use:   "clear [id]",
+			Short: "Stop injecting faults into a connection",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return send(args[0], "")
+			},
+		},
+	)
+
+	return cmd
+}
+
 // newVersionCmd creates the version command
 func newVersionCmd() *cobra.Command {
 	return &cobra.Command{
@@ -446,6 +1124,278 @@ func newVersionCmd() *cobra.Command {
 }
 
 // Helper functions
+
+// profileContext returns the kube context of a profile forward: its own,
+// the profile's or the one given with --context
+func profileContext(profile *config.Profile, fwd config.ForwardSpec) string {
+	if fwd.Context != "" {
+		return fwd.Context
+	}
+	if profile.Context != "" {
+		return profile.Context
+	}
+	return kubeOptions.Context
+}
+
+// forwardTarget returns the kubectl-style target given either as TYPE/NAME
+// argument or with the -p/-s flags
+func forwardTarget(args []string, pod, service string) (string, error) {
+	var targets []string
+	if len(args) > 0 {
+		targets = append(targets, args[0])
+	}
+	if pod != "" {
+		targets = append(targets, "pod/"+pod)
+	}
+	if service != "" {
+		targets = append(targets, "svc/"+service)
+	}
+	switch len(targets) {
+	case 0:
+		return "", fmt.Errorf("a target is required: TYPE/NAME, pod (-p) or service (-s)")
+	case 1:
+		return targets[0], nil
+	default:
+		return "", fmt.Errorf("only one target may be given, got %s", strings.Join(targets, ", "))
+	}
+}
+
+// portMappings pairs repeated -l and -r flags by position. A missing remote
+// port defaults to the local one. A Unix socket forward takes a single -r.
+func portMappings(localPorts, remotePorts []string, socket bool) ([]portforward.PortMapping, error) {
+	if socket {
+		if len(localPorts) > 0 {
+			return nil, fmt.Errorf("--socket replaces local ports (-l)")
+		}
+		if len(remotePorts) != 1 {
+			return nil, fmt.Errorf("--socket needs exactly one remote port (-r)")
+		}
+		p, err := portforward.ParsePortMapping("0:" + remotePorts[0])
+		if err != nil {
+			return nil, err
+		}
+		return []portforward.PortMapping{p}, nil
+	}
+	if len(localPorts) == 0 {
+		return nil, fmt.Errorf("local port is required (-l)")
+	}
+	if len(remotePorts) > len(localPorts) {
+		return nil, fmt.Errorf("more remote ports (-r) than local ports (-l)")
+	}
+	ports := make([]portforward.PortMapping, 0, len(localPorts))
+	for i, local := range localPorts {
+		spec := local
+		if i < len(remotePorts) {
+			spec += ":" + remotePorts[i]
+		}
+		p, err := portforward.ParsePortMapping(spec)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// describePorts formats the local side of a started forward
+func describePorts(opts portforward.ForwardOptions) string {
+	if opts.SocketPath != "" {
+		return fmt.Sprintf("unix:%s->%s", opts.SocketPath, opts.Ports[0].RemoteString())
+	}
+	if opts.ResourceType == portforward.ResourceRouter {
+		return fmt.Sprintf("%s (%d routes)", portforward.FormatPortMappings([]portforward.PortMapping{{Local: opts.Ports[0].Local, RemoteName: "http"}}), len(opts.Routes))
+	}
+	return portforward.FormatPortMappings(opts.Ports)
+}
+
+// connectionPorts formats the port mappings the daemon reports for a
+// connection, with the bind addresses when they aren't loopback-only
+func connectionPorts(conn daemon.ConnectionInfo) string {
+	if conn.SocketPath != "" {
+		return fmt.Sprintf("unix:%s->%d", conn.SocketPath, conn.RemotePort)
+	}
+	result := strings.Join(conn.Ports, ",")
+	if ports, err := portforward.ParsePortMappings(conn.Ports, conn.LocalPort, conn.RemotePort); err == nil {
+		result = portforward.FormatPortMappings(ports)
+	}
+	if len(portforward.ExposedAddresses(conn.Addresses)) > 0 {
+		result += " on " + strings.Join(conn.Addresses, ",")
+	}
+	return result
+}
+
+// connectionTraffic summarizes the traffic the daemon reports for a connection
+// as "↑1.2 KB ↓3.4 MB"
+func connectionTraffic(conn daemon.ConnectionInfo) string {
+	return fmt.Sprintf("↑%s ↓%s", portforward.FormatBytes(conn.BytesSent), portforward.FormatBytes(conn.BytesReceived))
+}
+
+// lastActivity formats how long ago a connection last carried traffic
+func lastActivity(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return "never"
+	}
+	return time.Since(t).Truncate(time.Second).String() + " ago"
+}
+
+// idleTimeoutString formats an idle timeout for the daemon, empty for the default
+func idleTimeoutString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// forwardSettings are the optional settings of a forward, shared by the
+// forward and add flags and profile entries
+type forwardSettings struct {
+	portRange  string
+	addresses  []string
+	socket     string
+	socketMode string
+	balance    string
+	probe      config.ProbeConfig // no probe unless Type is set
+	lazy       bool
+	idle       time.Duration
+	routes     []string         // HTTP routes of a router target
+	tls        config.TLSConfig // no TLS unless Mode is set
+	faults     string           // fault profile, e.g. "latency=200ms,drop=5%"
+	limits     config.LimitsConfig
+	context    string           // kube context, the default clients' one if empty
+}
+
+// addForwardFlags registers the flags for settings
+func addForwardFlags(cmd *cobra.Command, settings *forwardSettings) {
+	cmd.Flags().StringVar(&settings.portRange, "port-range", "", "Range automatic local ports are picked from, e.g. 20000-20999")
+	cmd.Flags().StringSliceVar(&settings.addresses, "address", nil, "Local addresses to listen on, e.g. ::1 or 0.0.0.0 (default 127.0.0.1)")
+	cmd.Flags().StringVar(&settings.socket, "socket", "", "Listen on this Unix socket instead of a local port")
+	cmd.Flags().StringVar(&settings.socketMode, "socket-mode", "", "Permissions of the Unix socket (default 0600)")
+	cmd.Flags().StringVar(&settings.balance, "balance", "", "Balance connections over all ready service pods (round-robin, least-conn)")
+	cmd.Flags().StringVar(&settings.probe.Type, "probe", "", "Health-check the forward through its tunnel (tcp, http, grpc)")
+	cmd.Flags().StringVar(&settings.probe.Port, "probe-port", "", "Remote port of the mapping to probe (default: the first one)")
+	cmd.Flags().StringVar(&settings.probe.Path, "probe-path", "", "HTTP probe path (default /)")
+	cmd.Flags().IntVar(&settings.probe.ExpectStatus, "probe-status", 0, "HTTP status the probe expects (default: any 2xx/3xx)")
+	cmd.Flags().StringVar(&settings.probe.Service, "probe-service", "", "gRPC health service to check (default: the whole server)")
+	cmd.Flags().DurationVar(&settings.probe.Interval, "probe-interval", 0, "Time between probes (default 10s)")
+	cmd.Flags().IntVar(&settings.probe.ReconnectAfter, "probe-reconnect-after", 0, "Re-dial the tunnel after this many failed probes in a row (default: never)")
+	cmd.Flags().BoolVar(&settings.lazy, "lazy", false, "Only open the tunnel when a client connects and close it again when idle")
+	cmd.Flags().DurationVar(&settings.idle, "idle-timeout", 0, "Close a lazy tunnel after this long without traffic (default 5m)")
+	cmd.Flags().StringArrayVar(&settings.routes, "route", nil, "HTTP route of a router target, [HOST][/PATH]=TYPE/NAME:PORT (repeat for several)")
+	cmd.Flags().StringVar(&settings.tls.Mode, "tls", "", "Terminate TLS on the local port (terminate) or speak TLS to the pod port (originate)")
+	cmd.Flags().StringVar(&settings.tls.Cert, "tls-cert", "", "Server certificate for terminate (default: generated from the local CA), client certificate for originate")
+	cmd.Flags().StringVar(&settings.tls.Key, "tls-key", "", "Private key of --tls-cert")
+	cmd.Flags().StringVar(&settings.tls.ClientCA, "tls-client-ca", "", "Require client certificates signed by this CA (terminate)")
+	cmd.Flags().StringSliceVar(&settings.tls.Hosts, "tls-host", nil, "Extra names of the generated certificate (terminate)")
+	cmd.Flags().StringVar(&settings.tls.ServerName, "tls-server-name", "", "SNI and expected certificate name of the pod (originate, default <service>.<namespace>.svc)")
+	cmd.Flags().StringVar(&settings.tls.CA, "tls-ca", "", "CA the pod's certificate must chain to (originate, default: system roots)")
+	cmd.Flags().BoolVar(&settings.tls.Insecure, "tls-insecure", false, "Don't verify the pod's certificate (originate)")
+	cmd.Flags().StringVar(&settings.faults, "faults", "", "Inject network faults, e.g. latency=200ms,jitter=50ms,bandwidth=64KB,reset=1%,drop=5%,stall=2%")
+	cmd.Flags().IntVar(&settings.limits.MaxConns, "max-conns", 0, "Refuse client connections beyond this many open at once")
+	cmd.Flags().StringVar(&settings.limits.Upload, "max-upload", "", "Cap traffic from all clients to the pod, bytes per second, e.g. 1MB")
+	cmd.Flags().StringVar(&settings.limits.Download, "max-download", "", "Cap traffic from the pod to all clients, bytes per second, e.g. 1MB")
+	cmd.Flags().StringVar(&settings.limits.Budget, "budget", "", "Refuse client connections once this much data has gone through, e.g. 5GB")
+}
+
+// forwardOptions builds manager options from CLI flags or a profile entry.
+// target is a kubectl-style reference such as "svc/api" or "deploy/api".
+func forwardOptions(namespace, target string, ports []portforward.PortMapping, settings forwardSettings) (portforward.ForwardOptions, error) {
+	resType, name, err := portforward.ParseResourceRef(target)
+	if err != nil {
+		return portforward.ForwardOptions{}, err
+	}
+	opts := portforward.ForwardOptions{
+		Context:      settings.context,
+		Namespace:    namespace,
+		ResourceType: resType,
+		ResourceName: name,
+		Ports:        ports,
+	}
+
+	if opts.PortRange, err = portforward.ParsePortRange(settings.portRange); err != nil {
+		return opts, err
+	}
+	if opts.Addresses, err = portforward.ParseAddresses(settings.addresses); err != nil {
+		return opts, err
+	}
+	if settings.socket != "" {
+		opts.SocketPath = settings.socket
+		if opts.SocketMode, err = portforward.ParseSocketMode(settings.socketMode); err != nil {
+			return opts, err
+		}
+	}
+	if exposed := portforward.ExposedAddresses(opts.Addresses); len(exposed) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠ Listening on %s: the forward is reachable from other hosts\n", strings.Join(exposed, ", "))
+	}
+
+	mode, err := portforward.ParseBalanceMode(settings.balance)
+	if err != nil {
+		return opts, err
+	}
+	if mode != portforward.BalanceNone && resType != portforward.ResourceService {
+		return opts, fmt.Errorf("--balance requires a service")
+	}
+	opts.Balance = mode
+
+	if settings.probe.Type != "" {
+		if err := settings.probe.Validate(); err != nil {
+			return opts, err
+		}
+		opts.Probe = settings.probe.Options()
+	}
+
+	if settings.idle < 0 {
+		return opts, fmt.Errorf("invalid idle timeout %s", settings.idle)
+	}
+	if settings.idle > 0 && !settings.lazy {
+		return opts, fmt.Errorf("--idle-timeout requires --lazy")
+	}
+	if settings.lazy && (opts.Balance != portforward.BalanceNone || opts.Probe != nil) {
+		return opts, fmt.Errorf("--lazy can't be combined with --balance or --probe")
+	}
+	opts.Lazy = settings.lazy
+	opts.IdleTimeout = settings.idle
+
+	if opts.Routes, err = portforward.ParseRoutes(settings.routes); err != nil {
+		return opts, err
+	}
+	if resType == portforward.ResourceRouter && len(opts.Routes) == 0 {
+		return opts, fmt.Errorf("a router needs at least one --route")
+	}
+	if resType != portforward.ResourceRouter && len(opts.Routes) > 0 {
+		return opts, fmt.Errorf("--route needs a router target, e.g. router/web")
+	}
+
+	if settings.tls.Mode != "" {
+		if err := settings.tls.Validate(); err != nil {
+			return opts, err
+		}
+		opts.TLS = settings.tls.Options()
+	} else if settings.tls.Cert != "" || settings.tls.Key != "" || settings.tls.ClientCA != "" || len(settings.tls.Hosts) > 0 || settings.tls.ServerName != "" || settings.tls.CA != "" || settings.tls.Insecure {
+		return opts, fmt.Errorf("the --tls-* flags need --tls terminate or --tls originate")
+	}
+
+	faults, err := portforward.ParseFaults(settings.faults)
+	if err != nil {
+		return opts, err
+	}
+	if !faults.IsZero() {
+		opts.Faults = &faults
+	}
+
+	if err := settings.limits.Validate(); err != nil {
+		return opts, err
+	}
+	limits, err := portforward.ParseLimits(settings.limits.MaxConns, settings.limits.Upload, settings.limits.Download, settings.limits.Budget)
+	if err != nil {
+		return opts, err
+	}
+	if !limits.IsZero() {
+		opts.Limits = &limits
+	}
+	return opts, nil
+}
+
 func formatPorts(ports []k8s.ContainerPort) string {
 	if len(ports) == 0 {
 		return "-"
@@ -470,7 +1420,10 @@ func formatServicePorts(ports []k8s.ServicePort) string {
 
 // newDaemonCmd creates the daemon command
 func newDaemonCmd() *cobra.Command {
-	var foreground bool
+	var (
+		foreground bool
+		socks      string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "daemon",
@@ -489,10 +1442,11 @@ func newDaemonCmd() *cobra.Command {
 			}
 			defer logger.Close()
 
-			return daemon.StartDaemon(foreground)
+			return daemon.StartDaemon(foreground, configPath, kubeOptions, socks)
 		},
 	}
 	startCmd.Flags().BoolVarP(&foreground, "foreground", "f", false, "Run in foreground (don't daemonize)")
+	startCmd.Flags().StringVar(&socks, "socks", "", "Also run a SOCKS5 proxy into the cluster on this address, e.g. :1080")
 
 	stopCmd := &cobra.Command{
 		Use:   "stop",
@@ -535,6 +1489,10 @@ func newDaemonCmd() *cobra.Command {
 			fmt.Printf("PID: %d\n", status.PID)
 			fmt.Printf("Uptime: %s\n", status.Uptime)
 			fmt.Printf("Active Connections: %d\n", len(status.Connections))
+			if status.Proxy != nil {
+				fmt.Printf("SOCKS Proxy: %s (%d requests, %d open, %d errors)\n",
+					status.Proxy.Address, status.Proxy.Requests, status.Proxy.Active, status.Proxy.Errors)
+			}
 
 			if len(status.Connections) > 0 {
 				fmt.Println("\nConnections:")
@@ -544,10 +1502,46 @@ func newDaemonCmd() *cobra.Command {
 						status = "○"
 					} else if conn.Status == "error" {
 						status = "✗"
+					} else if conn.Status == "reconnecting" {
+						status = "⟳"
+					} else if conn.Status == "degraded" {
+						status = "◑"
+					} else if conn.Status == "listening" {
+						status = "◌"
+					}
+					target := fmt.Sprintf("%s/%s/%s", conn.Namespace, conn.ResourceType, conn.ResourceName)
+					if conn.Context != "" {
+						target += "@" + conn.Context
+					}
+					fmt.Printf("  %s %s  %s  [%s]\n",
+						status, target, connectionPorts(conn), conn.Duration)
+					fmt.Printf("      traffic %s  connections %d open / %d total  errors %d  last activity %s\n",
+						connectionTraffic(conn), conn.OpenConns, conn.TotalConns, conn.Errors, lastActivity(conn.LastActivity))
+					if conn.Lazy {
+						fmt.Printf("      on demand, tunnel closes after %s idle\n", conn.IdleTimeout)
+					}
+					for _, route := range conn.Routes {
+						fmt.Printf("      route %s\n", route)
+					}
+					if conn.TLS != "" {
+						fmt.Printf("      tls %s\n", conn.TLS)
+					}
+					if conn.Recording != "" {
+						fmt.Printf("      recording %s\n", conn.Recording)
+					}
+					if conn.Faults != "" {
+						fmt.Printf("      faults %s\n", conn.Faults)
+					}
+					if conn.Limits != "" {
+						fmt.Printf("      limits %s\n", conn.Limits)
+					}
+					if conn.Probe != "" {
+						fmt.Printf("      probe %s", conn.Probe)
+						if conn.ProbeError != "" {
+							fmt.Printf("  failing: %s", conn.ProbeError)
+						}
+						fmt.Println()
 					}
-					fmt.Printf("  %s %s/%s/%s  localhost:%d -> %d  [%s]\n",
-						status, conn.Namespace, conn.ResourceType, conn.ResourceName,
-						conn.LocalPort, conn.RemotePort, conn.Duration)
 				}
 			}
 
@@ -562,21 +1556,32 @@ func newDaemonCmd() *cobra.Command {
 // newAddCmd creates the add command for daemon
 func newAddCmd() *cobra.Command {
 	var (
-		service    string
-		pod        string
-		localPort  int
-		remotePort int
+		service     string
+		pod         string
+		localPorts  []string
+		remotePorts []string
+		settings    forwardSettings
 	)
 
 	cmd := &cobra.Command{
-		Use:   "add",
+		Use:   "add [TYPE/NAME]",
 		Short: "Add port-forward to running daemon",
 		Long:  "Add a new port-forward to the running daemon",
+		Args:  cobra.MaximumNArgs(1),
 		Example: `  # Add service port-forward
   portfwd add -n longhorn-system -s longhorn-frontend -l 8080 -r 80
 
+  # Add statefulset port-forward
+  portfwd add sts/postgres -n databases -l 5432
+
   # Add pod port-forward
-  portfwd add -n default -p my-pod -l 3000 -r 3000`,
+  portfwd add -n default -p my-pod -l 3000 -r 3000
+
+  # Add several ports of one deployment
+  portfwd add deploy/my-app -n default -l 8080 -r http -l 9090 -r metrics
+
+  # Add balanced service port-forward
+  portfwd add -n default -s my-svc -l 8080 -r 80 --balance least-conn`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if !daemon.IsDaemonRunning() {
 				return fmt.Errorf("daemon is not running. Start it with: portfwd daemon start")
@@ -585,14 +1590,18 @@ func newAddCmd() *cobra.Command {
 			if namespace == "" {
 				return fmt.Errorf("namespace is required (-n)")
 			}
-			if pod == "" && service == "" {
-				return fmt.Errorf("either pod (-p) or service (-s) is required")
+			target, err := forwardTarget(args, pod, service)
+			if err != nil {
+				return err
 			}
-			if localPort == 0 {
-				return fmt.Errorf("local port is required (-l)")
+			ports, err := portMappings(localPorts, remotePorts, settings.socket != "")
+			if err != nil {
+				return err
 			}
-			if remotePort == 0 {
-				remotePort = localPort
+			settings.context = kubeOptions.Context
+			opts, err := forwardOptions(namespace, target, ports, settings)
+			if err != nil {
+				return err
 			}
 
 			client := daemon.NewClient()
@@ -601,14 +1610,25 @@ func newAddCmd() *cobra.Command {
 			}
 			defer client.Close()
 
-			resourceType := "pod"
-			resourceName := pod
-			if service != "" {
-				resourceType = "service"
-				resourceName = service
-			}
-
-			resp, err := client.Add(namespace, resourceType, resourceName, localPort, remotePort)
+			resp, err := client.Add(daemon.AddPayload{
+				Context:      opts.Context,
+				Namespace:    opts.Namespace,
+				ResourceType: string(opts.ResourceType),
+				ResourceName: opts.ResourceName,
+				Ports:        portforward.PortMappingStrings(opts.Ports),
+				PortRange:    opts.PortRange.String(),
+				Addresses:    opts.Addresses,
+				SocketPath:   opts.SocketPath,
+				SocketMode:   settings.socketMode,
+				Balance:      string(opts.Balance),
+				Probe:        daemon.NewProbePayload(opts.Probe),
+				Lazy:         opts.Lazy,
+				IdleTimeout:  idleTimeoutString(opts.IdleTimeout),
+				Routes:       portforward.RouteStrings(opts.Routes),
+				TLS:          daemon.NewTLSPayload(opts.TLS),
+				Faults:       settings.faults,
+				Limits:       daemon.NewLimitsPayload(opts.Limits),
+			})
 			if err != nil {
 				return err
 			}
@@ -624,8 +1644,9 @@ func newAddCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&service, "service", "s", "", "Service name")
 	cmd.Flags().StringVarP(&pod, "pod", "p", "", "Pod name")
-	cmd.Flags().IntVarP(&localPort, "local", "l", 0, "Local port")
-	cmd.Flags().IntVarP(&remotePort, "remote", "r", 0, "Remote port (defaults to local)")
+	cmd.Flags().StringSliceVarP(&localPorts, "local", "l", nil, "Local port, 0 or auto for a free one (repeat for several ports)")
+	cmd.Flags().StringSliceVarP(&remotePorts, "remote", "r", nil, "Remote port number or name, paired with -l by position (defaults to local)")
+	addForwardFlags(cmd, &settings)
 
 	return cmd
 }
@@ -704,8 +1725,8 @@ func newStatusCmd() *cobra.Command {
 			}
 
 			fmt.Printf("\nConnections (%d):\n", len(status.Connections))
-			fmt.Println("  ID                                                          LOCAL    REMOTE  STATUS    UPTIME")
-			fmt.Println("  " + strings.Repeat("-", 90))
+			fmt.Println("  ID                                                       PORTS            STATUS    UPTIME   CONNS    TRAFFIC")
+			fmt.Println("  " + strings.Repeat("-", 120))
 			
 			for _, conn := range status.Connections {
 				statusIcon := "●"
@@ -716,6 +1737,12 @@ func newStatusCmd() *cobra.Command {
 					statusIcon = "✗"
 				case "starting":
 					statusIcon = "◐"
+				case "reconnecting":
+					statusIcon = "⟳"
+				case "degraded":
+					statusIcon = "◑"
+				case "listening":
+					statusIcon = "◌"
 				}
 				
 				id := conn.ID
@@ -723,14 +1750,15 @@ func newStatusCmd() *cobra.Command {
 					id = id[:52] + "..."
 				}
 				
-				fmt.Printf("  %-55s  %5d -> %-5d  %s %-8s %s\n",
-					id, conn.LocalPort, conn.RemotePort, statusIcon, conn.Status, conn.Duration)
+				fmt.Printf("  %-55s  %-15s  %s %-8s %-8s %-8s %s\n",
+					id, connectionPorts(conn), statusIcon, conn.Status, conn.Duration,
+					fmt.Sprintf("%d/%d", conn.OpenConns, conn.TotalConns), connectionTraffic(conn))
+				if conn.Faults != "" {
+					fmt.Printf("    ↯ faults %s\n", conn.Faults)
+				}
 			}
 
 			return nil
 		},
 	}
 }
-
-// Unused but keep for potential future use
-var _ = time.Now